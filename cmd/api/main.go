@@ -12,6 +12,7 @@ import (
 
 	"ecommerce_project/internal/app"
 	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/cache"
 	"ecommerce_project/pkg/db"
 	"ecommerce_project/pkg/logger"
 )
@@ -32,10 +33,21 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer db.Close()
+	defer database.Close()
+
+	// Initialize Redis. The API runs without it, rate limiting in the
+	// process and skipping the Redis cache, until it is restarted.
+	redisClient, err := cache.NewConnection(cfg.Redis)
+	if err != nil {
+		logger.Warn("Redis is unavailable", "error", err)
+	}
+	defer cache.Close()
 
 	// Setup router with all dependencies
-	router := app.SetupRouter(database, cfg)
+	router, err := app.SetupRouter(database, redisClient, cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up router: %v", err)
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
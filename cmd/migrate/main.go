@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/logger"
+)
+
+const usage = `Usage: migrate <command> [arguments]
+
+Commands:
+  up [N]         apply all pending migrations, or the next N
+  down [N|all]   revert the last applied migration, the last N, or all
+  status         list migrations and whether they are applied
+  create NAME    create empty up and down files in the migrations directory
+`
+
+func main() {
+	dir := flag.String("dir", "migrations", "migrations directory used by create")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Initialize logger
+	logger.Init()
+	defer logger.Sync()
+
+	command, args := args[0], args[1:]
+
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatalf("create requires a migration name")
+		}
+		up, down, err := db.CreateMigration(*dir, args[0])
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return
+	}
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Migrations are run explicitly below, on the primary only
+	cfg.Database.AutoMigrate = false
+	cfg.Database.ReplicaHosts = nil
+
+	// Initialize database
+	database, err := db.NewConnection(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	migrator, err := db.NewDefaultMigrator(database.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch command {
+	case "up":
+		steps := parseSteps(args, 0)
+		applied, err := migrator.Up(steps)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		steps := parseSteps(args, 1)
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, s := range statuses {
+			name := s.Name
+			if name == "" {
+				name = "(missing files)"
+			}
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, name, applied)
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// parseSteps reads the optional step count of up and down. "all" means
+// every migration.
+func parseSteps(args []string, defaultSteps int) int {
+	if len(args) == 0 {
+		return defaultSteps
+	}
+	if strings.EqualFold(args[0], "all") {
+		return 0
+	}
+
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps <= 0 {
+		log.Fatalf("Invalid number of migrations %q", args[0])
+	}
+	return steps
+}
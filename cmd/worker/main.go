@@ -8,7 +8,11 @@ import (
 	"syscall"
 	"time"
 
+	"ecommerce_project/internal/app"
+	"ecommerce_project/internal/auth"
 	"ecommerce_project/internal/config"
+	"ecommerce_project/internal/notification"
+	"ecommerce_project/internal/order"
 	"ecommerce_project/pkg/db"
 	"ecommerce_project/pkg/logger"
 )
@@ -24,21 +28,37 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// The workers only use the primary
+	cfg.Database.ReplicaHosts = nil
+
 	// Initialize database
 	database, err := db.NewConnection(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer db.Close()
+	defer database.Close()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	authRepo := auth.NewRepository(database.DB)
+	notificationRepo := notification.NewRepository(database.DB)
+	channels, err := notification.NewChannels(notificationRepo, &cfg.Email, &cfg.Notification)
+	if err != nil {
+		log.Fatalf("Failed to set up notification channels: %v", err)
+	}
+	renderer, err := notification.NewRenderer(cfg.App.BaseURL, cfg.App.DefaultLocale, cfg.App.Currency)
+	if err != nil {
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+	notificationService := notification.NewService(notificationRepo, nil, renderer, &cfg.Email, &cfg.Notification, channels)
+	orderService, _ := app.NewOrderServices(database, cfg, notificationService)
+
 	// Start background workers
-	go startEmailWorker(ctx)
-	go startNotificationWorker(ctx)
-	go startInventoryWorker(ctx)
+	go startNotificationWorker(ctx, notificationService)
+	go startInventoryWorker(ctx, orderService)
 	go startOrderProcessingWorker(ctx)
+	go startSessionCleanupWorker(ctx, authRepo)
 
 	logger.Info("Background workers started")
 
@@ -55,66 +75,88 @@ func main() {
 	logger.Info("Workers stopped")
 }
 
-func startEmailWorker(ctx context.Context) {
+// notificationBatchSize is the number of queued notifications claimed per
+// tick
+const notificationBatchSize = 50
+
+func startNotificationWorker(ctx context.Context, notificationService *notification.Service) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Email worker stopped")
+			logger.Info("Notification worker stopped")
 			return
 		case <-ticker.C:
-			// Process email queue
-			logger.Debug("Processing email queue...")
+			// Deliver queued notifications until the outbox has no due
+			// messages left. Several workers can run this concurrently.
+			for {
+				sent, err := notificationService.ProcessOutbox(ctx, notificationBatchSize)
+				if err != nil {
+					logger.Error("Failed to process notification outbox", "error", err)
+					break
+				}
+				if sent > 0 {
+					logger.Debug("Sent queued notifications", "count", sent)
+				}
+				if sent < notificationBatchSize || ctx.Err() != nil {
+					break
+				}
+			}
 		}
 	}
 }
 
-func startNotificationWorker(ctx context.Context) {
-	ticker := time.NewTicker(15 * time.Second)
+func startInventoryWorker(ctx context.Context, orderService *order.Service) {
+	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Notification worker stopped")
+			logger.Info("Inventory worker stopped")
 			return
 		case <-ticker.C:
-			// Process notification queue
-			logger.Debug("Processing notification queue...")
+			// Cancel unpaid orders whose stock reservations expired
+			logger.Debug("Checking inventory levels...")
+			if _, err := orderService.ExpireReservations(ctx); err != nil {
+				logger.Error("Failed to find expired reservations", "error", err)
+			}
 		}
 	}
 }
 
-func startInventoryWorker(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+func startOrderProcessingWorker(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Inventory worker stopped")
+			logger.Info("Order processing worker stopped")
 			return
 		case <-ticker.C:
-			// Check and update inventory
-			logger.Debug("Checking inventory levels...")
+			// Process pending orders
+			logger.Debug("Processing pending orders...")
 		}
 	}
 }
 
-func startOrderProcessingWorker(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+func startSessionCleanupWorker(ctx context.Context, authRepo *auth.Repository) {
+	ticker := time.NewTicker(time.Hour)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Order processing worker stopped")
+			logger.Info("Session cleanup worker stopped")
 			return
 		case <-ticker.C:
-			// Process pending orders
-			logger.Debug("Processing pending orders...")
+			// Delete expired sessions and their refresh tokens
+			if err := authRepo.CleanExpiredTokens(ctx); err != nil {
+				logger.Error("Failed to clean expired sessions", "error", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ecommerce_project/internal/cart"
+	"ecommerce_project/internal/inventory"
+	"ecommerce_project/internal/notification"
+	"ecommerce_project/internal/order"
+	"ecommerce_project/internal/payment"
+	"ecommerce_project/internal/product"
+	"ecommerce_project/internal/user"
+)
+
+// Domain packages declare the narrow repository interfaces they depend on
+// using their own types. The adapters below bridge those interfaces to the
+// concrete repositories of other domains.
+
+// cartProductRepository exposes product.Repository to the cart service
+type cartProductRepository struct {
+	repo *product.Repository
+}
+
+func (a *cartProductRepository) GetVariant(ctx context.Context, variantID int64) (*cart.Variant, error) {
+	v, err := a.repo.GetVariant(ctx, variantID)
+	if err != nil {
+		return nil, err
+	}
+	return &cart.Variant{ID: v.ID, ProductID: v.ProductID, Price: v.Price, IsActive: v.IsActive}, nil
+}
+
+func (a *cartProductRepository) GetDefaultVariant(ctx context.Context, productID int64) (*cart.Variant, error) {
+	v, err := a.repo.GetDefaultVariant(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	return &cart.Variant{ID: v.ID, ProductID: v.ProductID, Price: v.Price, IsActive: v.IsActive}, nil
+}
+
+// orderCartRepository exposes cart.Repository to the order service
+type orderCartRepository struct {
+	repo *cart.Repository
+}
+
+func (a *orderCartRepository) GetOrCreate(ctx context.Context, userID int64) (*order.Cart, error) {
+	c, err := a.repo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &order.Cart{ID: c.ID}, nil
+}
+
+func (a *orderCartRepository) GetItems(ctx context.Context, cartID int64) ([]order.CartItem, error) {
+	items, err := a.repo.GetItems(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]order.CartItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, order.CartItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		})
+	}
+	return result, nil
+}
+
+func (a *orderCartRepository) Clear(ctx context.Context, cartID int64) error {
+	return a.repo.Clear(ctx, cartID)
+}
+
+func (a *orderCartRepository) WithTx(tx *sql.Tx) order.CartRepository {
+	return &orderCartRepository{repo: a.repo.WithTx(tx)}
+}
+
+// orderInventoryRepository exposes inventory.Repository to the order service
+type orderInventoryRepository struct {
+	repo *inventory.Repository
+}
+
+func (a *orderInventoryRepository) CheckStock(ctx context.Context, variantID int64, quantity int) (bool, error) {
+	return a.repo.CheckStock(ctx, variantID, quantity)
+}
+
+func (a *orderInventoryRepository) Reserve(ctx context.Context, orderID, variantID int64, quantity int, expiresAt time.Time) error {
+	return a.repo.Reserve(ctx, orderID, variantID, quantity, expiresAt)
+}
+
+func (a *orderInventoryRepository) CommitReservations(ctx context.Context, orderID int64) error {
+	return a.repo.CommitReservations(ctx, orderID)
+}
+
+func (a *orderInventoryRepository) ReleaseReservations(ctx context.Context, orderID int64) error {
+	return a.repo.ReleaseReservations(ctx, orderID)
+}
+
+func (a *orderInventoryRepository) RestockReservations(ctx context.Context, orderID int64) error {
+	return a.repo.RestockReservations(ctx, orderID)
+}
+
+func (a *orderInventoryRepository) HasReservations(ctx context.Context, orderID int64) (bool, error) {
+	return a.repo.HasReservations(ctx, orderID)
+}
+
+func (a *orderInventoryRepository) LockActiveReservations(ctx context.Context, orderID int64) (bool, error) {
+	return a.repo.LockActiveReservations(ctx, orderID)
+}
+
+func (a *orderInventoryRepository) ExpiredReservationOrders(ctx context.Context) ([]int64, error) {
+	return a.repo.ExpiredReservationOrders(ctx)
+}
+
+func (a *orderInventoryRepository) Restock(ctx context.Context, variantID int64, quantity int) error {
+	return a.repo.Restock(ctx, variantID, quantity)
+}
+
+func (a *orderInventoryRepository) WithTx(tx *sql.Tx) order.InventoryRepository {
+	return &orderInventoryRepository{repo: a.repo.WithTx(tx)}
+}
+
+// orderCheckoutPolicy lets the order service block checkout for users who
+// have not verified their email address when the deployment requires it
+type orderCheckoutPolicy struct {
+	users                *user.Repository
+	requireVerifiedEmail bool
+}
+
+func (a *orderCheckoutPolicy) CanCheckout(ctx context.Context, userID int64) error {
+	if !a.requireVerifiedEmail {
+		return nil
+	}
+
+	u, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !u.EmailVerified {
+		return fmt.Errorf("%w: verify your email address first", order.ErrCheckoutNotAllowed)
+	}
+	return nil
+}
+
+// orderNotifier queues order notifications through the notification outbox
+type orderNotifier struct {
+	notifications *notification.Service
+}
+
+func (a *orderNotifier) OrderPlaced(ctx context.Context, o *order.Order) error {
+	return a.notifications.SendOrderConfirmation(ctx, o.UserID, o.OrderNumber, o.Total)
+}
+
+func (a *orderNotifier) OrderShipped(ctx context.Context, o *order.Order) error {
+	return a.notifications.SendOrderShipped(ctx, o.UserID, o.OrderNumber)
+}
+
+func (a *orderNotifier) WithTx(tx *sql.Tx) order.Notifier {
+	return &orderNotifier{notifications: a.notifications.WithTx(tx)}
+}
+
+// notificationUserDirectory exposes user.Repository to the notification
+// service
+type notificationUserDirectory struct {
+	users *user.Repository
+}
+
+func (a *notificationUserDirectory) GetContact(ctx context.Context, userID int64) (*notification.Contact, error) {
+	u, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &notification.Contact{Email: u.Email, Phone: u.PhoneNumber, Locale: u.Locale}, nil
+}
+
+// orderPaymentService exposes payment.Service to the order service. The
+// payment service also depends on the order service, so the router binds
+// service once both have been constructed.
+type orderPaymentService struct {
+	service *payment.Service
+}
+
+func (a *orderPaymentService) CancelOrderPayment(ctx context.Context, orderID int64, reason string) error {
+	return a.service.CancelOrderPayment(ctx, orderID, reason)
+}
+
+// paymentOrderService exposes the order domain to the payment service. A
+// service bound to a transaction reads and confirms orders inside it.
+type paymentOrderService struct {
+	repo    *order.Repository
+	service *order.Service
+	tx      *sql.Tx
+}
+
+func (a *paymentOrderService) GetOrder(ctx context.Context, orderID int64) (*payment.Order, error) {
+	o, err := a.orderRepo().GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.Order{
+		ID:            o.ID,
+		UserID:        o.UserID,
+		OrderNumber:   o.OrderNumber,
+		Total:         o.Total,
+		Status:        o.Status,
+		PaymentStatus: o.PaymentStatus,
+	}, nil
+}
+
+func (a *paymentOrderService) ConfirmPayment(ctx context.Context, orderID int64) error {
+	var err error
+	if a.tx != nil {
+		err = a.service.ConfirmPaymentTx(ctx, a.tx, orderID)
+	} else {
+		err = a.service.ConfirmPayment(ctx, orderID)
+	}
+	if errors.Is(err, order.ErrReservationExpired) {
+		return fmt.Errorf("%w: %v", payment.ErrReservationExpired, err)
+	}
+	return err
+}
+
+func (a *paymentOrderService) UpdatePaymentStatus(ctx context.Context, orderID int64, status string) error {
+	return a.orderRepo().UpdatePaymentStatus(ctx, orderID, status)
+}
+
+func (a *paymentOrderService) WithTx(tx *sql.Tx) payment.OrderService {
+	return &paymentOrderService{repo: a.repo, service: a.service, tx: tx}
+}
+
+func (a *paymentOrderService) orderRepo() *order.Repository {
+	if a.tx != nil {
+		return a.repo.WithTx(a.tx)
+	}
+	return a.repo
+}
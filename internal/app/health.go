@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/logger"
+)
+
+// healthTimeout bounds each dependency check of the health endpoint
+const healthTimeout = 2 * time.Second
+
+const (
+	healthStatusHealthy   = "healthy"
+	healthStatusDegraded  = "degraded"
+	healthStatusUnhealthy = "unhealthy"
+)
+
+// PoolStatus reports the connectivity and statistics of a database pool.
+// The endpoint is public, so failures are only reported as "down" and their
+// details go to the log.
+type PoolStatus struct {
+	Name               string `json:"name"`
+	Status             string `json:"status"`
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDurationMs     int64  `json:"wait_duration_ms"`
+}
+
+// RedisStatus reports the connectivity and statistics of the Redis pool
+type RedisStatus struct {
+	Status     string `json:"status"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	Timeouts   uint32 `json:"timeouts"`
+}
+
+// HealthResponse is the body of the health endpoint
+type HealthResponse struct {
+	Status   string       `json:"status"`
+	Message  string       `json:"message"`
+	Database []PoolStatus `json:"database"`
+	Redis    *RedisStatus `json:"redis,omitempty"`
+}
+
+// HealthHandler checks the database pools and Redis. It answers 503 when
+// the primary database is unreachable and reports "degraded" when only a
+// replica or Redis is.
+type HealthHandler struct {
+	database *db.DB
+	redis    *redis.Client
+}
+
+// NewHealthHandler creates a health handler; redisClient may be nil
+func NewHealthHandler(database *db.DB, redisClient *redis.Client) *HealthHandler {
+	return &HealthHandler{database: database, redis: redisClient}
+}
+
+// ServeHTTP returns the health status of the API
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	response := HealthResponse{Status: healthStatusHealthy, Message: "E-Commerce API is running"}
+
+	for i, pool := range h.database.Health(ctx) {
+		status := PoolStatus{
+			Name:               pool.Name,
+			Status:             "up",
+			MaxOpenConnections: pool.Stats.MaxOpenConnections,
+			OpenConnections:    pool.Stats.OpenConnections,
+			InUse:              pool.Stats.InUse,
+			Idle:               pool.Stats.Idle,
+			WaitCount:          pool.Stats.WaitCount,
+			WaitDurationMs:     pool.Stats.WaitDuration.Milliseconds(),
+		}
+		if pool.Err != nil {
+			status.Status = "down"
+			logger.Warn("Database pool is unreachable", "pool", pool.Name, "error", pool.Err)
+			if i == 0 {
+				response.Status = healthStatusUnhealthy
+			} else if response.Status == healthStatusHealthy {
+				response.Status = healthStatusDegraded
+			}
+		}
+		response.Database = append(response.Database, status)
+	}
+
+	if h.redis != nil {
+		stats := h.redis.PoolStats()
+		response.Redis = &RedisStatus{
+			Status:     "up",
+			TotalConns: stats.TotalConns,
+			IdleConns:  stats.IdleConns,
+			Timeouts:   stats.Timeouts,
+		}
+		if err := h.redis.Ping(ctx).Err(); err != nil {
+			response.Redis.Status = "down"
+			logger.Warn("Redis is unreachable", "error", err)
+			if response.Status == healthStatusHealthy {
+				response.Status = healthStatusDegraded
+			}
+		}
+	}
+
+	code := http.StatusOK
+	if response.Status == healthStatusUnhealthy {
+		response.Message = "Database is unreachable"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
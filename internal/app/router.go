@@ -1,10 +1,11 @@
 package app
 
 import (
-	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 
 	"ecommerce_project/internal/auth"
 	"ecommerce_project/internal/cart"
@@ -15,13 +16,19 @@ import (
 	"ecommerce_project/internal/order"
 	"ecommerce_project/internal/payment"
 	"ecommerce_project/internal/product"
+	"ecommerce_project/internal/rbac"
 	"ecommerce_project/internal/review"
 	"ecommerce_project/internal/shipping"
 	"ecommerce_project/internal/user"
+	"ecommerce_project/pkg/cache"
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/media"
+	gateway "ecommerce_project/pkg/payment"
+	"ecommerce_project/pkg/storage"
 )
 
 // SetupRouter initializes all routes and dependencies
-func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
+func SetupRouter(database *db.DB, redisClient *redis.Client, cfg *config.Config) (*mux.Router, error) {
 	router := mux.NewRouter()
 
 	// Apply global middleware
@@ -30,28 +37,45 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	router.Use(RecoveryMiddleware)
 
 	// Initialize repositories
-	userRepo := user.NewRepository(db)
-	productRepo := product.NewRepository(db)
-	categoryRepo := category.NewRepository(db)
-	cartRepo := cart.NewRepository(db)
-	orderRepo := order.NewRepository(db)
-	paymentRepo := payment.NewRepository(db)
-	inventoryRepo := inventory.NewRepository(db)
-	reviewRepo := review.NewRepository(db)
-	shippingRepo := shipping.NewRepository(db)
+	userRepo := user.NewRepository(database.DB)
+	productRepo := product.NewRepository(database.DB, database)
+	categoryRepo := category.NewRepository(database.DB)
+	cartRepo := cart.NewRepository(database.DB)
+	inventoryRepo := inventory.NewRepository(database.DB)
+	reviewRepo := review.NewRepository(database.DB)
+	shippingRepo := shipping.NewRepository(database.DB)
+	rbacRepo := rbac.NewRepository(database.DB)
+	authRepo := auth.NewRepository(database.DB)
+	notificationRepo := notification.NewRepository(database.DB)
 
 	// Initialize services
-	authService := auth.NewService(cfg.JWT.Secret, cfg.JWT.ExpiryHours)
-	notificationService := notification.NewService(&cfg.Email)
-	userService := user.NewService(userRepo, authService)
-	productService := product.NewService(productRepo)
-	categoryService := category.NewService(categoryRepo)
-	cartService := cart.NewService(cartRepo, productRepo)
-	orderService := order.NewService(orderRepo, cartRepo, inventoryRepo)
-	paymentService := payment.NewService(paymentRepo, &cfg.Payment)
+	authService := auth.NewService(authRepo, cfg.JWT.Secret, cfg.JWT.ExpiryMinutes, cfg.JWT.RefreshExpiryDays)
+	channels, err := notification.NewChannels(notificationRepo, &cfg.Email, &cfg.Notification)
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := notification.NewRenderer(cfg.App.BaseURL, cfg.App.DefaultLocale, cfg.App.Currency)
+	if err != nil {
+		return nil, err
+	}
+	notificationService := notification.NewService(notificationRepo, &notificationUserDirectory{users: userRepo}, renderer, &cfg.Email, &cfg.Notification, channels)
+	userService := user.NewService(userRepo, authService, notificationService, cfg.App.BaseURL, &cfg.Auth)
+	catalogCache := newCache(&cfg.Cache, redisClient)
+	cacheTTL := time.Duration(cfg.Cache.TTL) * time.Second
+	productSearch := product.NewPostgresSearch(database.DB, database)
+	mediaStorage, err := newStorage(&cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	imageUploader := media.NewUploader(mediaStorage, int64(cfg.Storage.MaxUploadMB)<<20)
+	productService := product.NewService(productRepo, productSearch, imageUploader, catalogCache, cacheTTL)
+	categoryService := category.NewService(categoryRepo, catalogCache, cacheTTL)
+	cartService := cart.NewService(cartRepo, &cartProductRepository{repo: productRepo})
+	orderService, paymentService := NewOrderServices(database, cfg, notificationService)
 	inventoryService := inventory.NewService(inventoryRepo)
 	reviewService := review.NewService(reviewRepo)
 	shippingService := shipping.NewService(shippingRepo)
+	rbacService := rbac.NewService(database.DB, rbacRepo)
 
 	// Initialize handlers
 	userHandler := user.NewHandler(userService)
@@ -63,25 +87,47 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	inventoryHandler := inventory.NewHandler(inventoryService)
 	reviewHandler := review.NewHandler(reviewService)
 	shippingHandler := shipping.NewHandler(shippingService)
+	rbacHandler := rbac.NewHandler(rbacService)
+	notificationHandler := notification.NewHandler(notificationService)
 
 	// Auth middleware
-	authMiddleware := auth.NewMiddleware(authService)
+	authMiddleware := auth.NewMiddleware(authService, rbacService)
+
+	// can wraps an admin handler so that it requires a permission
+	can := func(permission string, handler http.HandlerFunc) http.Handler {
+		return authMiddleware.RequirePermission(permission)(handler)
+	}
+
+	// limit wraps a handler so that it is rate limited by a policy
+	rateLimiter := NewRateLimiter(newTokenBucket(redisClient), &cfg.RateLimit)
+	limit := func(policy string, handler http.HandlerFunc) http.Handler {
+		return rateLimiter.Limit(policy)(handler)
+	}
 
 	// API version prefix
 	api := router.PathPrefix("/api/v1").Subrouter()
 
 	// Health check
-	router.HandleFunc("/health", HealthCheckHandler).Methods("GET")
+	router.Handle("/health", NewHealthHandler(database, redisClient)).Methods("GET")
+
+	// Uploaded media, when it is stored on the API host
+	if local, ok := mediaStorage.(*storage.Local); ok {
+		router.PathPrefix(storage.LocalPrefix).Handler(http.StripPrefix(storage.LocalPrefix, local.Handler())).Methods("GET", "HEAD")
+	}
 
 	// Public routes
-	api.HandleFunc("/auth/signup", userHandler.Signup).Methods("POST")
-	api.HandleFunc("/auth/login", userHandler.Login).Methods("POST")
-	api.HandleFunc("/auth/refresh", userHandler.RefreshToken).Methods("POST")
+	api.Handle("/auth/signup", limit("signup", userHandler.Signup)).Methods("POST")
+	api.Handle("/auth/login", limit("login", userHandler.Login)).Methods("POST")
+	api.Handle("/auth/refresh", limit("refresh", userHandler.RefreshToken)).Methods("POST")
+	api.HandleFunc("/auth/logout", userHandler.Logout).Methods("POST")
+	api.Handle("/auth/verify-email", limit("verify_email", userHandler.VerifyEmail)).Methods("POST")
+	api.Handle("/auth/forgot-password", limit("forgot_password", userHandler.ForgotPassword)).Methods("POST")
+	api.Handle("/auth/reset-password", limit("reset_password", userHandler.ResetPassword)).Methods("POST")
 
 	// Product routes (public)
 	api.HandleFunc("/products", productHandler.List).Methods("GET")
-	api.HandleFunc("/products/{id}", productHandler.GetByID).Methods("GET")
 	api.HandleFunc("/products/search", productHandler.Search).Methods("GET")
+	api.HandleFunc("/products/{id}", productHandler.GetByID).Methods("GET")
 
 	// Category routes (public)
 	api.HandleFunc("/categories", categoryHandler.List).Methods("GET")
@@ -98,6 +144,18 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	protected.HandleFunc("/users/me", userHandler.GetProfile).Methods("GET")
 	protected.HandleFunc("/users/me", userHandler.UpdateProfile).Methods("PUT")
 	protected.HandleFunc("/users/me/password", userHandler.ChangePassword).Methods("PUT")
+	protected.HandleFunc("/users/me/verify-email", userHandler.ResendVerificationEmail).Methods("POST")
+	protected.HandleFunc("/users/me/sessions", userHandler.ListSessions).Methods("GET")
+	protected.HandleFunc("/users/me/sessions", userHandler.RevokeOtherSessions).Methods("DELETE")
+	protected.HandleFunc("/users/me/sessions/{id}", userHandler.RevokeSession).Methods("DELETE")
+
+	// Notification routes
+	api.HandleFunc("/notifications/push/public-key", notificationHandler.GetPushPublicKey).Methods("GET")
+	protected.HandleFunc("/users/me/notification-preferences", notificationHandler.GetPreferences).Methods("GET")
+	protected.HandleFunc("/users/me/notification-preferences", notificationHandler.UpdatePreferences).Methods("PUT")
+	protected.HandleFunc("/users/me/push-subscriptions", notificationHandler.ListPushSubscriptions).Methods("GET")
+	protected.HandleFunc("/users/me/push-subscriptions", notificationHandler.SubscribePush).Methods("POST")
+	protected.HandleFunc("/users/me/push-subscriptions/{id}", notificationHandler.UnsubscribePush).Methods("DELETE")
 
 	// Cart routes
 	protected.HandleFunc("/cart", cartHandler.Get).Methods("GET")
@@ -117,6 +175,7 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	protected.HandleFunc("/payments/{id}", paymentHandler.GetPayment).Methods("GET")
 	api.HandleFunc("/payments/webhook/stripe", paymentHandler.StripeWebhook).Methods("POST")
 	api.HandleFunc("/payments/webhook/bkash", paymentHandler.BkashWebhook).Methods("POST")
+	api.HandleFunc("/payments/bkash/callback", paymentHandler.BkashCallback).Methods("GET")
 
 	// Review routes (protected write)
 	protected.HandleFunc("/reviews", reviewHandler.Create).Methods("POST")
@@ -129,27 +188,101 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *mux.Router {
 	protected.HandleFunc("/shipping/addresses/{id}", shippingHandler.UpdateAddress).Methods("PUT")
 	protected.HandleFunc("/shipping/addresses/{id}", shippingHandler.DeleteAddress).Methods("DELETE")
 
-	// Admin routes (add admin middleware later)
+	// Admin routes. Each route requires the permission for its job, so staff
+	// roles such as inventory_manager and support only reach their own routes.
 	admin := protected.PathPrefix("/admin").Subrouter()
-	// admin.Use(authMiddleware.RequireAdmin) // Implement admin check
 
-	admin.HandleFunc("/products", productHandler.Create).Methods("POST")
-	admin.HandleFunc("/products/{id}", productHandler.Update).Methods("PUT")
-	admin.HandleFunc("/products/{id}", productHandler.Delete).Methods("DELETE")
+	admin.Handle("/products", can(rbac.PermProductsWrite, productHandler.Create)).Methods("POST")
+	admin.Handle("/products/{id}", can(rbac.PermProductsWrite, productHandler.Update)).Methods("PUT")
+	admin.Handle("/products/{id}", can(rbac.PermProductsWrite, productHandler.Delete)).Methods("DELETE")
+	admin.Handle("/products/{id}/options", can(rbac.PermProductsWrite, productHandler.CreateOption)).Methods("POST")
+	admin.Handle("/products/{id}/variants", can(rbac.PermProductsWrite, productHandler.CreateVariant)).Methods("POST")
+	admin.Handle("/products/{id}/variants/{variant_id}", can(rbac.PermProductsWrite, productHandler.UpdateVariant)).Methods("PUT")
+	admin.Handle("/products/{id}/variants/{variant_id}", can(rbac.PermProductsWrite, productHandler.DeleteVariant)).Methods("DELETE")
+	admin.Handle("/products/{id}/images", can(rbac.PermProductsWrite, productHandler.UploadImage)).Methods("POST")
+	admin.Handle("/products/{id}/images/{image_id}", can(rbac.PermProductsWrite, productHandler.UpdateImage)).Methods("PUT")
+	admin.Handle("/products/{id}/images/{image_id}", can(rbac.PermProductsWrite, productHandler.DeleteImage)).Methods("DELETE")
+
+	admin.Handle("/categories", can(rbac.PermCategoriesWrite, categoryHandler.Create)).Methods("POST")
+	admin.Handle("/categories/{id}", can(rbac.PermCategoriesWrite, categoryHandler.Update)).Methods("PUT")
+	admin.Handle("/categories/{id}", can(rbac.PermCategoriesWrite, categoryHandler.Delete)).Methods("DELETE")
+
+	admin.Handle("/orders", can(rbac.PermOrdersRead, orderHandler.AdminList)).Methods("GET")
+	admin.Handle("/orders/{id}/confirm", can(rbac.PermOrdersFulfil, orderHandler.Confirm)).Methods("POST")
+	admin.Handle("/orders/{id}/ship", can(rbac.PermOrdersFulfil, orderHandler.Ship)).Methods("POST")
+	admin.Handle("/orders/{id}/deliver", can(rbac.PermOrdersFulfil, orderHandler.Deliver)).Methods("POST")
+	admin.Handle("/orders/{id}/cancel", can(rbac.PermOrdersCancel, orderHandler.AdminCancel)).Methods("POST")
+
+	admin.Handle("/payments/{id}/refunds", can(rbac.PermPaymentsRead, paymentHandler.ListRefunds)).Methods("GET")
+	admin.Handle("/payments/{id}/refunds", can(rbac.PermPaymentsRefund, paymentHandler.CreateRefund)).Methods("POST")
+
+	admin.Handle("/inventory", can(rbac.PermInventoryRead, inventoryHandler.List)).Methods("GET")
+	admin.Handle("/inventory/{id}", can(rbac.PermInventoryWrite, inventoryHandler.Update)).Methods("PUT")
 
-	admin.HandleFunc("/categories", categoryHandler.Create).Methods("POST")
-	admin.HandleFunc("/categories/{id}", categoryHandler.Update).Methods("PUT")
-	admin.HandleFunc("/categories/{id}", categoryHandler.Delete).Methods("DELETE")
+	admin.Handle("/roles", can(rbac.PermRolesManage, rbacHandler.ListRoles)).Methods("GET")
+	admin.Handle("/users/{id}/roles", can(rbac.PermRolesManage, rbacHandler.GetUserRoles)).Methods("GET")
+	admin.Handle("/users/{id}/roles", can(rbac.PermRolesManage, rbacHandler.GrantRole)).Methods("POST")
+	admin.Handle("/users/{id}/roles/{role}", can(rbac.PermRolesManage, rbacHandler.RevokeRole)).Methods("DELETE")
 
-	admin.HandleFunc("/inventory", inventoryHandler.List).Methods("GET")
-	admin.HandleFunc("/inventory/{id}", inventoryHandler.Update).Methods("PUT")
+	admin.Handle("/notifications/templates", can(rbac.PermNotificationsManage, notificationHandler.ListTemplates)).Methods("GET")
+	admin.Handle("/notifications/templates/{name}/preview", can(rbac.PermNotificationsManage, notificationHandler.PreviewTemplate)).Methods("GET")
+
+	return router, nil
+}
+
+// NewOrderServices creates the order service and the payment service,
+// which depend on each other. The worker uses them to cancel expired orders.
+func NewOrderServices(database *db.DB, cfg *config.Config, notificationService *notification.Service) (*order.Service, *payment.Service) {
+	orderRepo := order.NewRepository(database.DB)
+	paymentRepo := payment.NewRepository(database.DB)
+
+	reservationTTL := time.Duration(cfg.Inventory.ReservationTTLMinutes) * time.Minute
+	orderPayments := &orderPaymentService{}
+	orderService := order.NewService(
+		database.DB,
+		orderRepo,
+		&orderCartRepository{repo: cart.NewRepository(database.DB)},
+		&orderInventoryRepository{repo: inventory.NewRepository(database.DB)},
+		orderPayments,
+		&orderCheckoutPolicy{users: user.NewRepository(database.DB), requireVerifiedEmail: cfg.Auth.RequireVerifiedEmail},
+		&orderNotifier{notifications: notificationService},
+		reservationTTL,
+	)
+
+	stripeClient := gateway.NewStripeClient(cfg.Payment.StripeSecretKey, cfg.Payment.StripeAPIBaseURL)
+	bkashClient := gateway.NewBkashClient(cfg.Payment.BkashAppKey, cfg.Payment.BkashAppSecret, cfg.Payment.BkashUsername, cfg.Payment.BkashPassword, cfg.Payment.BkashBaseURL)
+	paymentService := payment.NewService(database.DB, paymentRepo, &cfg.Payment, cfg.App.Currency, &paymentOrderService{repo: orderRepo, service: orderService}, stripeClient, bkashClient, gateway.NewSNSVerifier(nil))
+	orderPayments.service = paymentService
+
+	return orderService, paymentService
+}
+
+// newCache creates the cache selected by the configuration, or nil when
+// caching is disabled
+func newCache(cfg *config.CacheConfig, redisClient *redis.Client) cache.Cache {
+	switch {
+	case cfg.Driver == config.CacheDriverMemory:
+		return cache.NewMemory()
+	case cfg.Driver == config.CacheDriverRedis && redisClient != nil:
+		return cache.NewRedis(redisClient)
+	default:
+		return nil
+	}
+}
 
-	return router
+// newStorage creates the media storage selected by the configuration
+func newStorage(cfg *config.StorageConfig) (storage.Storage, error) {
+	if cfg.Driver == config.StorageDriverS3 {
+		return storage.NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle, cfg.PublicURL)
+	}
+	return storage.NewLocal(cfg.LocalPath, cfg.PublicURL), nil
 }
 
-// HealthCheckHandler returns the health status of the API
-func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"healthy","message":"E-Commerce API is running"}`))
+// newTokenBucket keeps rate limits in Redis when it is configured, and in
+// the process otherwise
+func newTokenBucket(redisClient *redis.Client) cache.TokenBucket {
+	if redisClient == nil {
+		return cache.NewMemory()
+	}
+	return cache.NewRedis(redisClient)
 }
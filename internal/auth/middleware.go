@@ -2,18 +2,27 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
+	"ecommerce_project/pkg/logger"
 	"ecommerce_project/pkg/utils"
 )
 
 type Middleware struct {
-	service *Service
+	service     *Service
+	permissions PermissionChecker
 }
 
-func NewMiddleware(service *Service) *Middleware {
-	return &Middleware{service: service}
+// PermissionChecker looks up whether a user holds a permission. It is
+// implemented by rbac.Service.
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, userID int64, permission string) (bool, error)
+}
+
+func NewMiddleware(service *Service, permissions PermissionChecker) *Middleware {
+	return &Middleware{service: service, permissions: permissions}
 }
 
 // RequireAuth middleware requires valid JWT token
@@ -35,8 +44,12 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 
 		token := parts[1]
 
-		// Validate token
-		claims, err := m.service.ValidateToken(token)
+		// Validate token and its session
+		claims, err := m.service.Authenticate(r.Context(), token)
+		if errors.Is(err, ErrSessionRevoked) {
+			utils.ErrorResponse(w, http.StatusUnauthorized, "Session has been revoked or has expired")
+			return
+		}
 		if err != nil {
 			utils.ErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
@@ -46,6 +59,7 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "email", claims.Email)
 		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx = context.WithValue(ctx, "session_id", claims.SessionID)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -54,9 +68,8 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 // RequireAdmin middleware requires admin role
 func (m *Middleware) RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role := r.Context().Value("role").(string)
-
-		if role != "admin" {
+		role, ok := r.Context().Value("role").(string)
+		if !ok || role != "admin" {
 			utils.ErrorResponse(w, http.StatusForbidden, "Admin access required")
 			return
 		}
@@ -64,3 +77,31 @@ func (m *Middleware) RequireAdmin(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequirePermission returns middleware that requires the authenticated user
+// to hold permission through one of their roles. It must run after
+// RequireAuth.
+func (m *Middleware) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("user_id").(int64)
+			if !ok {
+				utils.ErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			allowed, err := m.permissions.HasPermission(r.Context(), userID, permission)
+			if err != nil {
+				logger.Error("Failed to check permission", "user_id", userID, "permission", permission, "error", err)
+				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to check permissions")
+				return
+			}
+			if !allowed {
+				utils.ErrorResponse(w, http.StatusForbidden, "Permission "+permission+" required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
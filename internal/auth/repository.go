@@ -1,11 +1,17 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// ErrSessionNotFound is returned when a session does not exist, belongs to
+// another user or is already revoked
+var ErrSessionNotFound = errors.New("session not found")
+
 type Repository struct {
 	db *sql.DB
 }
@@ -14,64 +20,216 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// StoreRefreshToken stores a refresh token
-func (r *Repository) StoreRefreshToken(userID int64, token string, expiresAt time.Time) error {
+// CreateSession creates a new session together with its first refresh token
+func (r *Repository) CreateSession(ctx context.Context, session *Session, tokenHash string) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token, expires_at, created_at)
-		VALUES ($1, $2, $3, $4)
+		WITH session AS (
+			INSERT INTO user_sessions (user_id, user_agent, ip_address, created_at, last_used_at, expires_at)
+			VALUES ($1, $2, $3, $4, $4, $5)
+			RETURNING id, user_id, created_at, last_used_at, expires_at
+		), token AS (
+			INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at, created_at)
+			SELECT user_id, id, $6, expires_at, created_at FROM session
+		)
+		SELECT id, created_at, last_used_at FROM session
 	`
 
-	_, err := r.db.Exec(query, userID, token, expiresAt, time.Now())
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		time.Now(),
+		session.ExpiresAt,
+		tokenHash,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+
 	if err != nil {
-		return fmt.Errorf("failed to store refresh token: %w", err)
+		return fmt.Errorf("failed to create session: %w", err)
 	}
 
 	return nil
 }
 
-// ValidateRefreshToken checks if a refresh token is valid
-func (r *Repository) ValidateRefreshToken(token string) (int64, error) {
+// RotateRefreshToken marks a refresh token as used and stores its
+// replacement in the same session. It returns nil if the token is unknown,
+// expired, already used or belongs to a revoked session. Only one of
+// several concurrent rotations of the same token can succeed.
+func (r *Repository) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time, userAgent, ipAddress string) (*RefreshToken, error) {
 	query := `
-		SELECT user_id, expires_at
+		WITH used AS (
+			UPDATE refresh_tokens rt
+			SET used_at = $4
+			FROM user_sessions s
+			WHERE rt.token_hash = $1
+				AND rt.used_at IS NULL
+				AND rt.expires_at > $4
+				AND s.id = rt.session_id
+				AND s.revoked_at IS NULL
+			RETURNING rt.user_id, rt.session_id
+		), touched AS (
+			UPDATE user_sessions
+			SET last_used_at = $4, expires_at = $3, user_agent = $5, ip_address = $6
+			WHERE id = (SELECT session_id FROM used)
+		)
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at, created_at)
+		SELECT user_id, session_id, $2, $3, $4 FROM used
+		RETURNING id, user_id, session_id, token_hash, expires_at, created_at
+	`
+
+	token := &RefreshToken{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash, newTokenHash, expiresAt, time.Now(), userAgent, ipAddress).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.SessionID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (r *Repository) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, session_id, token_hash, expires_at, used_at, created_at
 		FROM refresh_tokens
-		WHERE token = $1 AND revoked = false
+		WHERE token_hash = $1
 	`
 
-	var userID int64
-	var expiresAt time.Time
+	token := &RefreshToken{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.SessionID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
 
-	err := r.db.QueryRow(query, token).Scan(&userID, &expiresAt)
 	if err == sql.ErrNoRows {
-		return 0, fmt.Errorf("invalid refresh token")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ListActiveSessions retrieves a user's sessions that are neither revoked
+// nor expired, most recently used first
+func (r *Repository) ListActiveSessions(ctx context.Context, userID int64) ([]Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
 	}
+
+	return sessions, rows.Err()
+}
+
+// IsSessionActive reports whether a user's session is neither revoked nor
+// expired
+func (r *Repository) IsSessionActive(ctx context.Context, userID, sessionID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3
+		)
+	`
+
+	var active bool
+	if err := r.db.QueryRowContext(ctx, query, sessionID, userID, time.Now()).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to look up session: %w", err)
+	}
+
+	return active, nil
+}
+
+// RevokeSession revokes one of a user's sessions, which invalidates its
+// refresh tokens and access tokens
+func (r *Repository) RevokeSession(ctx context.Context, userID, sessionID int64, reason string) error {
+	query := `
+		UPDATE user_sessions
+		SET revoked_at = $1, revoke_reason = $2
+		WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), reason, sessionID, userID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to validate refresh token: %w", err)
+		return fmt.Errorf("failed to revoke session: %w", err)
 	}
 
-	if time.Now().After(expiresAt) {
-		return 0, fmt.Errorf("refresh token expired")
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
 	}
 
-	return userID, nil
+	return nil
 }
 
-// RevokeRefreshToken revokes a refresh token
-func (r *Repository) RevokeRefreshToken(token string) error {
-	query := `UPDATE refresh_tokens SET revoked = true WHERE token = $1`
+// RevokeOtherSessions revokes all of a user's sessions except one. Pass 0
+// to revoke every session.
+func (r *Repository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID int64, reason string) error {
+	query := `
+		UPDATE user_sessions
+		SET revoked_at = $1, revoke_reason = $2
+		WHERE user_id = $3 AND id <> $4 AND revoked_at IS NULL
+	`
 
-	_, err := r.db.Exec(query, token)
+	_, err := r.db.ExecContext(ctx, query, time.Now(), reason, userID, keepSessionID)
 	if err != nil {
-		return fmt.Errorf("failed to revoke refresh token: %w", err)
+		return fmt.Errorf("failed to revoke sessions: %w", err)
 	}
 
 	return nil
 }
 
-// CleanExpiredTokens removes expired tokens
-func (r *Repository) CleanExpiredTokens() error {
-	query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
+// CleanExpiredTokens removes expired refresh tokens and sessions
+func (r *Repository) CleanExpiredTokens(ctx context.Context) error {
+	query := `DELETE FROM user_sessions WHERE expires_at < $1`
 
-	_, err := r.db.Exec(query, time.Now())
+	_, err := r.db.ExecContext(ctx, query, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to clean expired tokens: %w", err)
 	}
@@ -1,32 +1,51 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
+
+	"ecommerce_project/pkg/utils"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again. The token's session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	// ErrSessionRevoked is returned for access tokens whose session was
+	// revoked or has expired
+	ErrSessionRevoked = errors.New("session revoked or expired")
 )
 
 type Service struct {
-	secret      string
-	expiryHours int
+	repo              *Repository
+	secret            string
+	expiryMinutes     int
+	refreshExpiryDays int
 }
 
-func NewService(secret string, expiryHours int) *Service {
+func NewService(repo *Repository, secret string, expiryMinutes, refreshExpiryDays int) *Service {
 	return &Service{
-		secret:      secret,
-		expiryHours: expiryHours,
+		repo:              repo,
+		secret:            secret,
+		expiryMinutes:     expiryMinutes,
+		refreshExpiryDays: refreshExpiryDays,
 	}
 }
 
-// GenerateToken generates a new JWT access token
-func (s *Service) GenerateToken(userID int64, email, role string) (string, error) {
+// GenerateToken generates a new JWT access token for a session
+func (s *Service) GenerateToken(userID int64, email, role string, sessionID int64) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
 		"role":    role,
-		"exp":     time.Now().Add(time.Hour * time.Duration(s.expiryHours)).Unix(),
+		"sid":     sessionID,
+		"exp":     time.Now().Add(time.Minute * time.Duration(s.expiryMinutes)).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
@@ -39,11 +58,129 @@ func (s *Service) GenerateToken(userID int64, email, role string) (string, error
 	return signedToken, nil
 }
 
-// GenerateRefreshToken generates a new refresh token
-func (s *Service) GenerateRefreshToken(userID int64) (string, error) {
-	// Generate a UUID as refresh token
-	refreshToken := uuid.New().String()
-	return refreshToken, nil
+// CreateSession starts a new session for a user and returns its first
+// refresh token
+func (s *Service) CreateSession(ctx context.Context, userID int64, userAgent, ipAddress string) (*Session, string, error) {
+	token, hash, err := utils.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	session := &Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: s.refreshExpiry(),
+	}
+	if err := s.repo.CreateSession(ctx, session, hash); err != nil {
+		return nil, "", err
+	}
+
+	return session, token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// session. A refresh token can only be used once: presenting a used token
+// again means it was stolen, so the whole session is revoked.
+func (s *Service) RotateRefreshToken(ctx context.Context, refreshToken, userAgent, ipAddress string) (*RefreshToken, string, error) {
+	newToken, newHash, err := utils.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash := utils.HashToken(refreshToken)
+	rotated, err := s.repo.RotateRefreshToken(ctx, hash, newHash, s.refreshExpiry(), userAgent, ipAddress)
+	if err != nil {
+		return nil, "", err
+	}
+	if rotated != nil {
+		return rotated, newToken, nil
+	}
+
+	existing, err := s.repo.GetRefreshToken(ctx, hash)
+	if err != nil {
+		return nil, "", err
+	}
+	if existing != nil && existing.UsedAt != nil {
+		err := s.repo.RevokeSession(ctx, existing.UserID, existing.SessionID, "refresh token reuse")
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	return nil, "", ErrInvalidRefreshToken
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to
+func (s *Service) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	token, err := s.repo.GetRefreshToken(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrInvalidRefreshToken
+	}
+
+	err = s.repo.RevokeSession(ctx, token.UserID, token.SessionID, "logout")
+	if errors.Is(err, ErrSessionNotFound) {
+		// Already logged out
+		return nil
+	}
+	return err
+}
+
+// ListSessions retrieves a user's active sessions and marks the current one
+func (s *Service) ListSessions(ctx context.Context, userID, currentSessionID int64) ([]Session, error) {
+	sessions, err := s.repo.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of a user's sessions
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	return s.repo.RevokeSession(ctx, userID, sessionID, "revoked by user")
+}
+
+// RevokeOtherSessions revokes all of a user's sessions except the current one
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentSessionID int64) error {
+	return s.repo.RevokeOtherSessions(ctx, userID, currentSessionID, "revoked by user")
+}
+
+// refreshExpiry returns the expiry time of a refresh token issued now
+func (s *Service) refreshExpiry() time.Time {
+	return time.Now().AddDate(0, 0, s.refreshExpiryDays)
+}
+
+// Authenticate validates an access token and checks that its session is
+// still active, so that revoking a session signs its device out at once
+func (s *Service) Authenticate(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before sessions existed cannot be revoked
+	if claims.SessionID == 0 {
+		return nil, ErrSessionRevoked
+	}
+
+	active, err := s.repo.IsSessionActive(ctx, claims.UserID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrSessionRevoked
+	}
+
+	return claims, nil
 }
 
 // ValidateToken validates a JWT token and returns claims
@@ -72,16 +209,17 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 	email := claims["email"].(string)
 	role := claims["role"].(string)
 
+	// Tokens issued before sessions existed carry no session ID and are
+	// rejected by Authenticate
+	var sessionID int64
+	if sid, ok := claims["sid"].(float64); ok {
+		sessionID = int64(sid)
+	}
+
 	return &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
 	}, nil
 }
-
-// ValidateRefreshToken validates a refresh token
-func (s *Service) ValidateRefreshToken(token string) (int64, error) {
-	// This should be implemented with database validation
-	// For now, return an error indicating it needs DB implementation
-	return 0, fmt.Errorf("refresh token validation requires database")
-}
@@ -22,7 +22,7 @@ func NewHandler(service *Service) *Handler {
 func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int64)
 	
-	cart, err := h.service.Get(userID)
+	cart, err := h.service.Get(r.Context(), userID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -46,7 +46,7 @@ func (h *Handler) AddItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if err := h.service.AddItem(userID, &req); err != nil {
+	if err := h.service.AddItem(r.Context(), userID, &req); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -76,7 +76,7 @@ func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if err := h.service.UpdateItem(userID, itemID, &req); err != nil {
+	if err := h.service.UpdateItem(r.Context(), userID, itemID, &req); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -95,7 +95,7 @@ func (h *Handler) RemoveItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if err := h.service.RemoveItem(userID, itemID); err != nil {
+	if err := h.service.RemoveItem(r.Context(), userID, itemID); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -107,7 +107,7 @@ func (h *Handler) RemoveItem(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) Clear(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int64)
 	
-	if err := h.service.Clear(userID); err != nil {
+	if err := h.service.Clear(r.Context(), userID); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -19,6 +19,7 @@ type CartItem struct {
 	ID        int64     `json:"id" db:"id"`
 	CartID    int64     `json:"cart_id" db:"cart_id"`
 	ProductID int64     `json:"product_id" db:"product_id"`
+	VariantID int64     `json:"variant_id" db:"variant_id"`
 	Quantity  int       `json:"quantity" db:"quantity"`
 	Price     float64   `json:"price" db:"price"`
 	Subtotal  float64   `json:"subtotal"`
@@ -26,9 +27,11 @@ type CartItem struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// AddItemRequest represents adding an item to cart
+// AddItemRequest represents adding an item to cart. Products sold in
+// variants need a variant ID; other products only a product ID.
 type AddItemRequest struct {
-	ProductID int64 `json:"product_id" validate:"required"`
+	ProductID int64 `json:"product_id" validate:"required_without=VariantID"`
+	VariantID int64 `json:"variant_id,omitempty"`
 	Quantity  int   `json:"quantity" validate:"required,gt=0"`
 }
 
@@ -1,31 +1,39 @@
 package cart
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/db"
 )
 
 type Repository struct {
-	db *sql.DB
+	db db.DBTX
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
 // GetOrCreate gets or creates a cart for a user
-func (r *Repository) GetOrCreate(userID int64) (*Cart, error) {
+func (r *Repository) GetOrCreate(ctx context.Context, userID int64) (*Cart, error) {
 	// Try to get existing cart
 	query := `SELECT id, user_id, created_at, updated_at FROM carts WHERE user_id = $1`
 	
 	cart := &Cart{}
-	err := r.db.QueryRow(query, userID).Scan(&cart.ID, &cart.UserID, &cart.CreatedAt, &cart.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&cart.ID, &cart.UserID, &cart.CreatedAt, &cart.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
 		// Create new cart
 		createQuery := `INSERT INTO carts (user_id, created_at, updated_at) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`
-		err = r.db.QueryRow(createQuery, userID, time.Now(), time.Now()).Scan(&cart.ID, &cart.CreatedAt, &cart.UpdatedAt)
+		err = r.db.QueryRowContext(ctx, createQuery, userID, time.Now(), time.Now()).Scan(&cart.ID, &cart.CreatedAt, &cart.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create cart: %w", err)
 		}
@@ -41,14 +49,14 @@ func (r *Repository) GetOrCreate(userID int64) (*Cart, error) {
 }
 
 // GetItems retrieves all items in a cart
-func (r *Repository) GetItems(cartID int64) ([]CartItem, error) {
+func (r *Repository) GetItems(ctx context.Context, cartID int64) ([]CartItem, error) {
 	query := `
-		SELECT id, cart_id, product_id, quantity, price, created_at, updated_at
+		SELECT id, cart_id, product_id, variant_id, quantity, price, created_at, updated_at
 		FROM cart_items
 		WHERE cart_id = $1
 	`
 	
-	rows, err := r.db.Query(query, cartID)
+	rows, err := r.db.QueryContext(ctx, query, cartID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart items: %w", err)
 	}
@@ -57,7 +65,7 @@ func (r *Repository) GetItems(cartID int64) ([]CartItem, error) {
 	items := []CartItem{}
 	for rows.Next() {
 		item := CartItem{}
-		err := rows.Scan(&item.ID, &item.CartID, &item.ProductID, &item.Quantity, &item.Price, &item.CreatedAt, &item.UpdatedAt)
+		err := rows.Scan(&item.ID, &item.CartID, &item.ProductID, &item.VariantID, &item.Quantity, &item.Price, &item.CreatedAt, &item.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan cart item: %w", err)
 		}
@@ -68,22 +76,22 @@ func (r *Repository) GetItems(cartID int64) ([]CartItem, error) {
 	return items, nil
 }
 
-// AddItem adds an item to the cart
-func (r *Repository) AddItem(cartID, productID int64, quantity int, price float64) error {
+// AddItem adds quantity units of a product variant to the cart
+func (r *Repository) AddItem(ctx context.Context, cartID, productID, variantID int64, quantity int, price float64) error {
 	// Check if item already exists
 	var existingID int64
 	var existingQuantity int
 	
-	checkQuery := `SELECT id, quantity FROM cart_items WHERE cart_id = $1 AND product_id = $2`
-	err := r.db.QueryRow(checkQuery, cartID, productID).Scan(&existingID, &existingQuantity)
+	checkQuery := `SELECT id, quantity FROM cart_items WHERE cart_id = $1 AND variant_id = $2`
+	err := r.db.QueryRowContext(ctx, checkQuery, cartID, variantID).Scan(&existingID, &existingQuantity)
 	
 	if err == sql.ErrNoRows {
 		// Insert new item
 		insertQuery := `
-			INSERT INTO cart_items (cart_id, product_id, quantity, price, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, price, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 		`
-		_, err = r.db.Exec(insertQuery, cartID, productID, quantity, price, time.Now(), time.Now())
+		_, err = r.db.ExecContext(ctx, insertQuery, cartID, productID, variantID, quantity, price, time.Now(), time.Now())
 		if err != nil {
 			return fmt.Errorf("failed to add item to cart: %w", err)
 		}
@@ -96,7 +104,7 @@ func (r *Repository) AddItem(cartID, productID int64, quantity int, price float6
 	
 	// Update existing item
 	updateQuery := `UPDATE cart_items SET quantity = $1, updated_at = $2 WHERE id = $3`
-	_, err = r.db.Exec(updateQuery, existingQuantity+quantity, time.Now(), existingID)
+	_, err = r.db.ExecContext(ctx, updateQuery, existingQuantity+quantity, time.Now(), existingID)
 	if err != nil {
 		return fmt.Errorf("failed to update cart item: %w", err)
 	}
@@ -105,9 +113,9 @@ func (r *Repository) AddItem(cartID, productID int64, quantity int, price float6
 }
 
 // UpdateItem updates a cart item quantity
-func (r *Repository) UpdateItem(itemID int64, quantity int) error {
+func (r *Repository) UpdateItem(ctx context.Context, itemID int64, quantity int) error {
 	query := `UPDATE cart_items SET quantity = $1, updated_at = $2 WHERE id = $3`
-	_, err := r.db.Exec(query, quantity, time.Now(), itemID)
+	_, err := r.db.ExecContext(ctx, query, quantity, time.Now(), itemID)
 	if err != nil {
 		return fmt.Errorf("failed to update cart item: %w", err)
 	}
@@ -115,9 +123,9 @@ func (r *Repository) UpdateItem(itemID int64, quantity int) error {
 }
 
 // RemoveItem removes an item from the cart
-func (r *Repository) RemoveItem(itemID int64) error {
+func (r *Repository) RemoveItem(ctx context.Context, itemID int64) error {
 	query := `DELETE FROM cart_items WHERE id = $1`
-	_, err := r.db.Exec(query, itemID)
+	_, err := r.db.ExecContext(ctx, query, itemID)
 	if err != nil {
 		return fmt.Errorf("failed to remove cart item: %w", err)
 	}
@@ -125,9 +133,9 @@ func (r *Repository) RemoveItem(itemID int64) error {
 }
 
 // Clear removes all items from a cart
-func (r *Repository) Clear(cartID int64) error {
+func (r *Repository) Clear(ctx context.Context, cartID int64) error {
 	query := `DELETE FROM cart_items WHERE cart_id = $1`
-	_, err := r.db.Exec(query, cartID)
+	_, err := r.db.ExecContext(ctx, query, cartID)
 	if err != nil {
 		return fmt.Errorf("failed to clear cart: %w", err)
 	}
@@ -1,7 +1,7 @@
 package cart
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 )
 
@@ -10,13 +10,17 @@ type Service struct {
 	productRepo ProductRepository
 }
 
+// ProductRepository looks up the product variants added to carts
 type ProductRepository interface {
-	GetByID(id int64) (*Product, error)
+	GetVariant(ctx context.Context, variantID int64) (*Variant, error)
+	GetDefaultVariant(ctx context.Context, productID int64) (*Variant, error)
 }
 
-type Product struct {
-	ID    int64
-	Price float64
+type Variant struct {
+	ID        int64
+	ProductID int64
+	Price     float64
+	IsActive  bool
 }
 
 func NewService(repo *Repository, productRepo ProductRepository) *Service {
@@ -27,13 +31,13 @@ func NewService(repo *Repository, productRepo ProductRepository) *Service {
 }
 
 // Get retrieves a user's cart
-func (s *Service) Get(userID int64) (*Cart, error) {
-	cart, err := s.repo.GetOrCreate(userID)
+func (s *Service) Get(ctx context.Context, userID int64) (*Cart, error) {
+	cart, err := s.repo.GetOrCreate(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 	
-	items, err := s.repo.GetItems(cart.ID)
+	items, err := s.repo.GetItems(ctx, cart.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -51,41 +55,49 @@ func (s *Service) Get(userID int64) (*Cart, error) {
 }
 
 // AddItem adds an item to the cart
-func (s *Service) AddItem(userID int64, req *AddItemRequest) error {
+func (s *Service) AddItem(ctx context.Context, userID int64, req *AddItemRequest) error {
 	// Get or create cart
-	cart, err := s.repo.GetOrCreate(userID)
+	cart, err := s.repo.GetOrCreate(ctx, userID)
 	if err != nil {
 		return err
 	}
 	
-	// Get product to verify existence and get price
-	product, err := s.productRepo.GetByID(req.ProductID)
+	// Get the variant to verify it is for sale and get its price
+	var variant *Variant
+	if req.VariantID > 0 {
+		variant, err = s.productRepo.GetVariant(ctx, req.VariantID)
+	} else {
+		variant, err = s.productRepo.GetDefaultVariant(ctx, req.ProductID)
+	}
 	if err != nil {
-		return fmt.Errorf("product not found")
+		return err
+	}
+	if !variant.IsActive || (req.ProductID > 0 && variant.ProductID != req.ProductID) {
+		return fmt.Errorf("variant not found")
 	}
 	
 	// Add item to cart
-	return s.repo.AddItem(cart.ID, req.ProductID, req.Quantity, product.Price)
+	return s.repo.AddItem(ctx, cart.ID, variant.ProductID, variant.ID, req.Quantity, variant.Price)
 }
 
 // UpdateItem updates a cart item
-func (s *Service) UpdateItem(userID, itemID int64, req *UpdateItemRequest) error {
+func (s *Service) UpdateItem(ctx context.Context, userID, itemID int64, req *UpdateItemRequest) error {
 	// Verify cart ownership (simplified, should verify item belongs to user's cart)
-	return s.repo.UpdateItem(itemID, req.Quantity)
+	return s.repo.UpdateItem(ctx, itemID, req.Quantity)
 }
 
 // RemoveItem removes an item from the cart
-func (s *Service) RemoveItem(userID, itemID int64) error {
+func (s *Service) RemoveItem(ctx context.Context, userID, itemID int64) error {
 	// Verify cart ownership (simplified, should verify item belongs to user's cart)
-	return s.repo.RemoveItem(itemID)
+	return s.repo.RemoveItem(ctx, itemID)
 }
 
 // Clear clears all items from the cart
-func (s *Service) Clear(userID int64) error {
-	cart, err := s.repo.GetOrCreate(userID)
+func (s *Service) Clear(ctx context.Context, userID int64) error {
+	cart, err := s.repo.GetOrCreate(ctx, userID)
 	if err != nil {
 		return err
 	}
 	
-	return s.repo.Clear(cart.ID)
+	return s.repo.Clear(ctx, cart.ID)
 }
@@ -20,7 +20,7 @@ func NewHandler(service *Service) *Handler {
 
 // List retrieves all categories
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.service.List()
+	categories, err := h.service.List(r.Context())
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -38,7 +38,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category, err := h.service.GetByID(id)
+	category, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
 		return
@@ -60,7 +60,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category, err := h.service.Create(&req)
+	category, err := h.service.Create(r.Context(), &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -84,7 +84,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category, err := h.service.Update(id, &req)
+	category, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -102,7 +102,7 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(id); err != nil {
+	if err := h.service.Delete(r.Context(), id); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
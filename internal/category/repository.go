@@ -1,6 +1,7 @@
 package category
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -15,14 +16,15 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 // Create creates a new category
-func (r *Repository) Create(category *Category) error {
+func (r *Repository) Create(ctx context.Context, category *Category) error {
 	query := `
 		INSERT INTO categories (name, slug, description, parent_id, image_url, is_active, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		category.Name,
 		category.Slug,
@@ -42,7 +44,7 @@ func (r *Repository) Create(category *Category) error {
 }
 
 // GetByID retrieves a category by ID
-func (r *Repository) GetByID(id int64) (*Category, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Category, error) {
 	query := `
 		SELECT id, name, slug, description, parent_id, image_url, is_active, created_at, updated_at
 		FROM categories
@@ -50,7 +52,7 @@ func (r *Repository) GetByID(id int64) (*Category, error) {
 	`
 
 	category := &Category{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&category.ID,
 		&category.Name,
 		&category.Slug,
@@ -73,7 +75,7 @@ func (r *Repository) GetByID(id int64) (*Category, error) {
 }
 
 // List retrieves all active categories
-func (r *Repository) List() ([]*Category, error) {
+func (r *Repository) List(ctx context.Context) ([]*Category, error) {
 	query := `
 		SELECT id, name, slug, description, parent_id, image_url, is_active, created_at, updated_at
 		FROM categories
@@ -81,7 +83,7 @@ func (r *Repository) List() ([]*Category, error) {
 		ORDER BY name ASC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list categories: %w", err)
 	}
@@ -111,14 +113,15 @@ func (r *Repository) List() ([]*Category, error) {
 }
 
 // Update updates a category
-func (r *Repository) Update(category *Category) error {
+func (r *Repository) Update(ctx context.Context, category *Category) error {
 	query := `
 		UPDATE categories
 		SET name = $1, slug = $2, description = $3, parent_id = $4, image_url = $5, is_active = $6, updated_at = $7
 		WHERE id = $8
 	`
 
-	_, err := r.db.Exec(
+	_, err := r.db.ExecContext(
+		ctx,
 		query,
 		category.Name,
 		category.Slug,
@@ -138,10 +141,10 @@ func (r *Repository) Update(category *Category) error {
 }
 
 // Delete soft deletes a category
-func (r *Repository) Delete(id int64) error {
+func (r *Repository) Delete(ctx context.Context, id int64) error {
 	query := `UPDATE categories SET is_active = false, updated_at = $1 WHERE id = $2`
 
-	_, err := r.db.Exec(query, time.Now(), id)
+	_, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete category: %w", err)
 	}
@@ -1,15 +1,29 @@
 package category
 
+import (
+	"context"
+	"time"
+
+	"ecommerce_project/pkg/cache"
+)
+
+// listKey caches the category list
+const listKey = "categories:list"
+
 type Service struct {
-	repo *Repository
+	repo     *Repository
+	cache    cache.Cache
+	cacheTTL time.Duration
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+// NewService creates a category service. The category list is cached in
+// store for cacheTTL; a nil store disables caching.
+func NewService(repo *Repository, store cache.Cache, cacheTTL time.Duration) *Service {
+	return &Service{repo: repo, cache: store, cacheTTL: cacheTTL}
 }
 
 // Create creates a new category
-func (s *Service) Create(req *CreateCategoryRequest) (*Category, error) {
+func (s *Service) Create(ctx context.Context, req *CreateCategoryRequest) (*Category, error) {
 	category := &Category{
 		Name:        req.Name,
 		Slug:        req.Slug,
@@ -19,26 +33,38 @@ func (s *Service) Create(req *CreateCategoryRequest) (*Category, error) {
 		IsActive:    true,
 	}
 
-	if err := s.repo.Create(category); err != nil {
+	if err := s.repo.Create(ctx, category); err != nil {
 		return nil, err
 	}
 
+	cache.Invalidate(ctx, s.cache, listKey)
+
 	return category, nil
 }
 
 // GetByID retrieves a category by ID
-func (s *Service) GetByID(id int64) (*Category, error) {
-	return s.repo.GetByID(id)
+func (s *Service) GetByID(ctx context.Context, id int64) (*Category, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
 // List retrieves all categories
-func (s *Service) List() ([]*Category, error) {
-	return s.repo.List()
+func (s *Service) List(ctx context.Context) ([]*Category, error) {
+	var categories []*Category
+	err := cache.Remember(ctx, s.cache, listKey, s.cacheTTL, &categories, func() error {
+		var err error
+		categories, err = s.repo.List(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return categories, nil
 }
 
 // Update updates a category
-func (s *Service) Update(id int64, req *UpdateCategoryRequest) (*Category, error) {
-	category, err := s.repo.GetByID(id)
+func (s *Service) Update(ctx context.Context, id int64, req *UpdateCategoryRequest) (*Category, error) {
+	category, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -63,14 +89,22 @@ func (s *Service) Update(id int64, req *UpdateCategoryRequest) (*Category, error
 		category.IsActive = *req.IsActive
 	}
 
-	if err := s.repo.Update(category); err != nil {
+	if err := s.repo.Update(ctx, category); err != nil {
 		return nil, err
 	}
 
+	cache.Invalidate(ctx, s.cache, listKey)
+
 	return category, nil
 }
 
 // Delete deletes a category
-func (s *Service) Delete(id int64) error {
-	return s.repo.Delete(id)
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	cache.Invalidate(ctx, s.cache, listKey)
+
+	return nil
 }
@@ -1,148 +1,528 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// Deployment environments. Each may have a profile next to the config
+// file, such as config/app.production.yaml.
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentTest        = "test"
+	EnvironmentStaging     = "staging"
+	EnvironmentProduction  = "production"
+)
+
+// minProductionSecretLength is the shortest JWT secret accepted in
+// production
+const minProductionSecretLength = 32
+
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Payment  PaymentConfig
-	Email    EmailConfig
+	App          AppConfig          `yaml:"app"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Redis        RedisConfig        `yaml:"redis"`
+	Cache        CacheConfig        `yaml:"cache"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Payment      PaymentConfig      `yaml:"payment"`
+	Email        EmailConfig        `yaml:"email"`
+	Notification NotificationConfig `yaml:"notification"`
+	Inventory    InventoryConfig    `yaml:"inventory"`
+	Storage      StorageConfig      `yaml:"storage"`
+}
+
+// AppConfig holds settings of the customer-facing site
+type AppConfig struct {
+	// BaseURL is the storefront URL used to build links in emails
+	BaseURL string `yaml:"base_url"`
+	// DefaultLocale is the language of notifications for users without a
+	// locale of their own
+	DefaultLocale string `yaml:"default_locale"`
+	// Currency is the ISO 4217 code of the currency prices are in
+	Currency string `yaml:"currency"`
 }
 
 type ServerConfig struct {
-	Port         string
-	Environment  string
-	ReadTimeout  int
-	WriteTimeout int
-	IdleTimeout  int
+	Port         string `yaml:"port"`
+	Environment  string `yaml:"environment"`
+	ReadTimeout  int    `yaml:"read_timeout"`
+	WriteTimeout int    `yaml:"write_timeout"`
+	IdleTimeout  int    `yaml:"idle_timeout"`
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+	SSLMode  string `yaml:"sslmode"`
+	// QueryTimeout is how many seconds Postgres lets a single statement
+	// run before cancelling it; 0 disables the limit
+	QueryTimeout int `yaml:"query_timeout"`
+	// AutoMigrate applies pending migrations when connecting
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// Connection pool limits; lifetimes are in seconds and 0 means
+	// connections are reused forever
+	MaxOpenConns    int `yaml:"max_open_conns"`
+	MaxIdleConns    int `yaml:"max_idle_conns"`
+	ConnMaxLifetime int `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime int `yaml:"conn_max_idle_time"`
+	// ReplicaHosts are host[:port] addresses of read replicas sharing the
+	// primary's credentials and database name
+	ReplicaHosts []string `yaml:"replica_hosts"`
 }
 
 type RedisConfig struct {
-	Host     string
-	Port     string
-	Password string
-	DB       int
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// Cache drivers
+const (
+	// CacheDriverRedis shares cached entries between API instances
+	CacheDriverRedis = "redis"
+	// CacheDriverMemory caches inside each API process
+	CacheDriverMemory = "memory"
+	// CacheDriverNone disables caching
+	CacheDriverNone = "none"
+)
+
+// CacheConfig selects where catalog reads are cached and for how long
+type CacheConfig struct {
+	Driver string `yaml:"driver"`
+	// TTL is how many seconds products and categories stay cached;
+	// changes made through the API invalidate them earlier
+	TTL int `yaml:"ttl"`
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpiryHours int
+	Secret            string `yaml:"secret"`
+	ExpiryMinutes     int    `yaml:"expiry_minutes"`
+	RefreshExpiryDays int    `yaml:"refresh_expiry_days"`
+}
+
+// AuthConfig holds account verification and recovery settings
+type AuthConfig struct {
+	EmailVerificationTTLHours int `yaml:"email_verification_ttl_hours"`
+	PasswordResetTTLMinutes   int `yaml:"password_reset_ttl_minutes"`
+	// RequireVerifiedEmail blocks checkout for users who have not verified
+	// their email address
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+	// LockoutThreshold is how many consecutive failed logins lock an
+	// account; 0 disables the lockout. The first lock lasts
+	// LockoutSeconds and every further failure doubles it, up to
+	// LockoutMaxSeconds.
+	LockoutThreshold  int `yaml:"lockout_threshold"`
+	LockoutSeconds    int `yaml:"lockout_seconds"`
+	LockoutMaxSeconds int `yaml:"lockout_max_seconds"`
+}
+
+// Rate limit keys, identifying whose requests share a bucket
+const (
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyUser   = "user"
+	RateLimitKeyAPIKey = "api_key"
+)
+
+// RateLimitConfig holds the request rate limits of the API, by policy
+// name as used in the router
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// TrustProxy takes the client IP from the X-Forwarded-For header set
+	// by a reverse proxy in front of the API
+	TrustProxy bool                       `yaml:"trust_proxy"`
+	Policies   map[string]RateLimitPolicy `yaml:"policies"`
+}
+
+// RateLimitPolicy allows Requests per Period seconds and bursts of up to
+// Requests. Key is ip, user or api_key; requests without a user or API key
+// are limited by IP.
+type RateLimitPolicy struct {
+	Requests int    `yaml:"requests"`
+	Period   int    `yaml:"period"`
+	Key      string `yaml:"key"`
 }
 
 type PaymentConfig struct {
-	StripeSecretKey string
-	StripePublicKey string
-	BkashAppKey     string
-	BkashAppSecret  string
-	BkashUsername   string
-	BkashPassword   string
+	StripeSecretKey      string `yaml:"stripe_secret_key"`
+	StripePublicKey      string `yaml:"stripe_public_key"`
+	StripeAPIBaseURL     string `yaml:"stripe_api_base_url"`
+	StripeWebhookSecret  string `yaml:"stripe_webhook_secret"`
+	BkashAppKey          string `yaml:"bkash_app_key"`
+	BkashAppSecret       string `yaml:"bkash_app_secret"`
+	BkashUsername        string `yaml:"bkash_username"`
+	BkashPassword        string `yaml:"bkash_password"`
+	BkashBaseURL         string `yaml:"bkash_base_url"`
+	BkashCallbackURL     string `yaml:"bkash_callback_url"`
+	BkashWebhookTopicARN string `yaml:"bkash_webhook_topic_arn"`
 }
 
+// SMTP connection security modes
+const (
+	// SMTPTLSStartTLS upgrades a plain connection with STARTTLS and fails
+	// if the server does not offer it
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit connects with TLS from the start, usually on port 465
+	SMTPTLSImplicit = "tls"
+	// SMTPTLSNone sends in plaintext; only for local mail catchers
+	SMTPTLSNone = "none"
+)
+
 type EmailConfig struct {
-	SMTPHost     string
-	SMTPPort     string
-	SMTPUsername string
-	SMTPPassword string
-	FromEmail    string
-	FromName     string
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	SMTPTLSMode  string `yaml:"smtp_tls_mode"`
+	// SMTPBatchSize is how many emails a bulk send delivers over one
+	// connection before reconnecting
+	SMTPBatchSize int    `yaml:"smtp_batch_size"`
+	FromEmail     string `yaml:"from_email"`
+	FromName      string `yaml:"from_name"`
+	// MaxAttempts is how often the worker tries to deliver a queued
+	// notification before dead-lettering it
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// Notification sinks
+const (
+	// NotificationSinkLive delivers through SMTP, Twilio and Web Push
+	NotificationSinkLive = "live"
+	// NotificationSinkLog writes notifications to the application log
+	NotificationSinkLog = "log"
+	// NotificationSinkFile appends notifications to NotificationConfig.SinkPath
+	NotificationSinkFile = "file"
+)
+
+// NotificationConfig selects where notifications are delivered and holds
+// the SMS and Web Push credentials. SMS and push are disabled in the live
+// sink until their credentials are set.
+type NotificationConfig struct {
+	Sink             string `yaml:"sink"`
+	SinkPath         string `yaml:"sink_path"`
+	TwilioAccountSID string `yaml:"twilio_account_sid"`
+	TwilioAuthToken  string `yaml:"twilio_auth_token"`
+	TwilioFromNumber string `yaml:"twilio_from_number"`
+	TwilioBaseURL    string `yaml:"twilio_base_url"`
+	VAPIDPublicKey   string `yaml:"vapid_public_key"`
+	VAPIDPrivateKey  string `yaml:"vapid_private_key"`
+	VAPIDSubject     string `yaml:"vapid_subject"`
+	PushTTLHours     int    `yaml:"push_ttl_hours"`
+}
+
+type InventoryConfig struct {
+	ReservationTTLMinutes int `yaml:"reservation_ttl_minutes"`
 }
 
-// Load reads configuration from environment variables
+// Storage drivers
+const (
+	// StorageDriverLocal writes uploads to a directory served under /media/
+	StorageDriverLocal = "local"
+	// StorageDriverS3 writes uploads to an S3-compatible bucket
+	StorageDriverS3 = "s3"
+)
+
+// StorageConfig selects where uploaded media such as product images is
+// stored and how large uploads may be
+type StorageConfig struct {
+	Driver    string `yaml:"driver"`
+	LocalPath string `yaml:"local_path"`
+	// PublicURL is the URL stored files are served from, such as a CDN.
+	// It defaults to /media on the API host for local storage and to the
+	// bucket URL for S3.
+	PublicURL string `yaml:"public_url"`
+	// S3Endpoint defaults to AWS; set it for other S3-compatible services
+	S3Endpoint  string `yaml:"s3_endpoint"`
+	S3Region    string `yaml:"s3_region"`
+	S3Bucket    string `yaml:"s3_bucket"`
+	S3AccessKey string `yaml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key"`
+	// S3PathStyle addresses the bucket in the path rather than the host
+	// name, as MinIO and most self-hosted services expect
+	S3PathStyle bool `yaml:"s3_path_style"`
+	// MaxUploadMB bounds the size of an uploaded file
+	MaxUploadMB int `yaml:"max_upload_mb"`
+}
+
+// Load reads configuration from the YAML file, the profile of the
+// environment and environment variables, in increasing precedence, and
+// validates it
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	cfg := &Config{
+	cfg := defaults()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit || path == "" {
+		path, explicit = DefaultConfigFile, false
+	}
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+
+	environment := getEnv("ENVIRONMENT", cfg.Server.Environment)
+	if err := cfg.loadFile(profilePath(path, environment), false); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// defaults returns the configuration used for settings that neither the
+// YAML files nor the environment set
+func defaults() *Config {
+	return &Config{
+		App: AppConfig{
+			BaseURL:       "http://localhost:3000",
+			DefaultLocale: "en",
+			Currency:      "USD",
+		},
 		Server: ServerConfig{
-			Port:         getEnv("SERVER_PORT", "8080"),
-			Environment:  getEnv("ENVIRONMENT", "development"),
-			ReadTimeout:  getEnvAsInt("SERVER_READ_TIMEOUT", 10),
-			WriteTimeout: getEnvAsInt("SERVER_WRITE_TIMEOUT", 10),
-			IdleTimeout:  getEnvAsInt("SERVER_IDLE_TIMEOUT", 120),
+			Port:         "8080",
+			Environment:  EnvironmentDevelopment,
+			ReadTimeout:  10,
+			WriteTimeout: 10,
+			IdleTimeout:  120,
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			DBName:   getEnv("DB_NAME", "ecommerce"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:            "localhost",
+			Port:            "5432",
+			User:            "postgres",
+			DBName:          "ecommerce",
+			SSLMode:         "disable",
+			QueryTimeout:    15,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 1800,
+			ConnMaxIdleTime: 300,
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     getEnv("REDIS_PORT", "6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvAsInt("REDIS_DB", 0),
+			Host: "localhost",
+			Port: "6379",
+		},
+		Cache: CacheConfig{
+			Driver: CacheDriverRedis,
+			TTL:    300,
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "your-secret-key"),
-			ExpiryHours: getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+			ExpiryMinutes:     15,
+			RefreshExpiryDays: 30,
+		},
+		Auth: AuthConfig{
+			EmailVerificationTTLHours: 24,
+			PasswordResetTTLMinutes:   60,
+			LockoutThreshold:          5,
+			LockoutSeconds:            60,
+			LockoutMaxSeconds:         3600,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Policies: map[string]RateLimitPolicy{
+				"login":           {Requests: 10, Period: 60, Key: RateLimitKeyIP},
+				"signup":          {Requests: 5, Period: 3600, Key: RateLimitKeyIP},
+				"refresh":         {Requests: 30, Period: 60, Key: RateLimitKeyIP},
+				"forgot_password": {Requests: 5, Period: 3600, Key: RateLimitKeyIP},
+				"verify_email":    {Requests: 10, Period: 60, Key: RateLimitKeyIP},
+				"reset_password":  {Requests: 10, Period: 60, Key: RateLimitKeyIP},
+			},
 		},
 		Payment: PaymentConfig{
-			StripeSecretKey: getEnv("STRIPE_SECRET_KEY", ""),
-			StripePublicKey: getEnv("STRIPE_PUBLIC_KEY", ""),
-			BkashAppKey:     getEnv("BKASH_APP_KEY", ""),
-			BkashAppSecret:  getEnv("BKASH_APP_SECRET", ""),
-			BkashUsername:   getEnv("BKASH_USERNAME", ""),
-			BkashPassword:   getEnv("BKASH_PASSWORD", ""),
+			BkashBaseURL: "https://tokenized.sandbox.bka.sh/v1.2.0-beta",
 		},
 		Email: EmailConfig{
-			SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-			SMTPPort:     getEnv("SMTP_PORT", "587"),
-			SMTPUsername: getEnv("SMTP_USERNAME", ""),
-			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-			FromEmail:    getEnv("FROM_EMAIL", "noreply@ecommerce.com"),
-			FromName:     getEnv("FROM_NAME", "E-Commerce"),
+			SMTPHost:      "smtp.gmail.com",
+			SMTPPort:      "587",
+			SMTPTLSMode:   SMTPTLSStartTLS,
+			SMTPBatchSize: 100,
+			FromEmail:     "noreply@ecommerce.com",
+			FromName:      "E-Commerce",
+			MaxAttempts:   8,
+		},
+		Notification: NotificationConfig{
+			Sink:         NotificationSinkLive,
+			SinkPath:     "notifications.log",
+			VAPIDSubject: "mailto:noreply@ecommerce.com",
+			PushTTLHours: 24,
+		},
+		Inventory: InventoryConfig{
+			ReservationTTLMinutes: 30,
+		},
+		Storage: StorageConfig{
+			Driver:      StorageDriverLocal,
+			LocalPath:   "uploads",
+			S3Region:    "us-east-1",
+			MaxUploadMB: 10,
 		},
 	}
+}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+// Validate checks if all required configurations are set. Secrets must
+// be real values outside development and test, and production also
+// requires the payment keys.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
 	}
 
-	return cfg, nil
-}
+	switch c.Server.Environment {
+	case EnvironmentDevelopment, EnvironmentTest, EnvironmentStaging, EnvironmentProduction:
+	default:
+		fail("ENVIRONMENT must be one of development, test, staging or production")
+	}
+	production := c.Server.IsProduction()
 
-// Validate checks if all required configurations are set
-func (c *Config) Validate() error {
 	if c.Database.Password == "" {
-		return fmt.Errorf("DB_PASSWORD is required")
+		fail("DB_PASSWORD is required")
 	}
-	if c.JWT.Secret == "" || c.JWT.Secret == "your-secret-key" {
-		return fmt.Errorf("JWT_SECRET must be set to a secure value")
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
 	}
-	return nil
-}
 
-// Helper functions
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	switch {
+	case c.JWT.Secret == "":
+		fail("JWT_SECRET is required")
+	case isPlaceholder(c.JWT.Secret) && c.Server.Environment != EnvironmentDevelopment && c.Server.Environment != EnvironmentTest:
+		fail("JWT_SECRET must be set to a secure value")
+	case production && len(c.JWT.Secret) < minProductionSecretLength:
+		fail("JWT_SECRET must be at least %d characters in production", minProductionSecretLength)
 	}
-	return defaultValue
+
+	if c.Auth.LockoutThreshold > 0 && (c.Auth.LockoutSeconds <= 0 || c.Auth.LockoutMaxSeconds < c.Auth.LockoutSeconds) {
+		fail("LOGIN_LOCKOUT_SECONDS must be positive and at most LOGIN_LOCKOUT_MAX_SECONDS")
+	}
+	for name, policy := range c.RateLimit.Policies {
+		if policy.Requests <= 0 || policy.Period <= 0 {
+			fail("rate limit policy %s needs positive requests and period", name)
+		}
+		switch policy.Key {
+		case RateLimitKeyIP, RateLimitKeyUser, RateLimitKeyAPIKey:
+		default:
+			fail("rate limit policy %s must be keyed by ip, user or api_key", name)
+		}
+	}
+
+	switch c.Cache.Driver {
+	case CacheDriverRedis, CacheDriverMemory, CacheDriverNone:
+	default:
+		fail("CACHE_DRIVER must be one of redis, memory or none")
+	}
+
+	switch c.Email.SMTPTLSMode {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		fail("SMTP_TLS_MODE must be one of starttls, tls or none")
+	}
+	switch c.Notification.Sink {
+	case NotificationSinkLive, NotificationSinkLog, NotificationSinkFile:
+	default:
+		fail("NOTIFICATION_SINK must be one of live, log or file")
+	}
+
+	switch c.Storage.Driver {
+	case StorageDriverLocal:
+		if c.Storage.LocalPath == "" {
+			fail("STORAGE_LOCAL_PATH is required for local storage")
+		}
+	case StorageDriverS3:
+		if c.Storage.S3Bucket == "" || c.Storage.S3Region == "" {
+			fail("S3_BUCKET and S3_REGION are required for s3 storage")
+		}
+		if c.Storage.S3AccessKey == "" || c.Storage.S3SecretKey == "" {
+			fail("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for s3 storage")
+		}
+	default:
+		fail("STORAGE_DRIVER must be one of local or s3")
+	}
+	if c.Storage.MaxUploadMB <= 0 {
+		fail("MEDIA_MAX_UPLOAD_MB must be positive")
+	}
+
+	if production {
+		if c.Notification.Sink != NotificationSinkLive {
+			fail("NOTIFICATION_SINK must be live in production")
+		}
+
+		if isPlaceholder(c.Payment.StripeSecretKey) {
+			fail("STRIPE_SECRET_KEY is required in production")
+		} else if strings.HasPrefix(c.Payment.StripeSecretKey, "sk_test_") {
+			fail("STRIPE_SECRET_KEY must be a live key in production")
+		}
+		if isPlaceholder(c.Payment.StripeWebhookSecret) {
+			fail("STRIPE_WEBHOOK_SECRET is required in production")
+		}
+		if c.Payment.StripeAPIBaseURL != "" && urlHost(c.Payment.StripeAPIBaseURL) != "api.stripe.com" {
+			fail("STRIPE_API_BASE_URL must be empty or the Stripe API in production")
+		}
+
+		// bKash is optional, but once enabled it needs all of its settings
+		if c.Payment.BkashAppKey != "" {
+			if isPlaceholder(c.Payment.BkashAppKey) {
+				fail("BKASH_APP_KEY must be set to a real value in production")
+			}
+			for _, setting := range []struct{ key, value string }{
+				{"BKASH_APP_SECRET", c.Payment.BkashAppSecret},
+				{"BKASH_USERNAME", c.Payment.BkashUsername},
+				{"BKASH_PASSWORD", c.Payment.BkashPassword},
+				{"BKASH_CALLBACK_URL", c.Payment.BkashCallbackURL},
+				{"BKASH_WEBHOOK_TOPIC_ARN", c.Payment.BkashWebhookTopicARN},
+			} {
+				if isPlaceholder(setting.value) {
+					fail("%s is required in production when bKash is enabled", setting.key)
+				}
+			}
+			// The client falls back to the sandbox without a base URL
+			if host := urlHost(c.Payment.BkashBaseURL); host == "" || strings.Contains(host, "sandbox") {
+				fail("BKASH_BASE_URL must be the bKash production API in production")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// IsProduction reports whether the server runs in production
+func (c *ServerConfig) IsProduction() bool {
+	return c.Environment == EnvironmentProduction
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := os.Getenv(key)
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+// urlHost returns the lower-cased host of a URL, or "" if it has none
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
 	}
-	return defaultValue
+	return strings.ToLower(u.Hostname())
+}
+
+// isPlaceholder reports whether a secret is unset or still one of the
+// example values shipped in app.yaml and .env.example
+func isPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	return value == "" ||
+		strings.HasSuffix(value, "...") ||
+		strings.HasPrefix(lower, "your-") ||
+		strings.HasPrefix(lower, "your_") ||
+		strings.Contains(lower, "change-in-production") ||
+		strings.Contains(lower, "change_this_in_production")
 }
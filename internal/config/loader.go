@@ -0,0 +1,230 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is read when CONFIG_FILE is not set
+const DefaultConfigFile = "config/app.yaml"
+
+// loadFile merges a YAML file into the configuration. Settings missing
+// from the file keep their values. A missing file is an error only when
+// required.
+func (c *Config) loadFile(path string, required bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// profilePath returns the profile of an environment next to the config
+// file, for example config/app.production.yaml
+func profilePath(path, environment string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + environment + ext
+}
+
+// applyEnv overrides the configuration with the environment variables
+// that are set
+func (c *Config) applyEnv() error {
+	env := &envReader{}
+
+	env.string("APP_BASE_URL", &c.App.BaseURL)
+	env.string("APP_DEFAULT_LOCALE", &c.App.DefaultLocale)
+	env.string("APP_CURRENCY", &c.App.Currency)
+
+	env.string("SERVER_PORT", &c.Server.Port)
+	env.string("ENVIRONMENT", &c.Server.Environment)
+	env.int("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout)
+	env.int("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	env.int("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+
+	env.string("DB_HOST", &c.Database.Host)
+	env.string("DB_PORT", &c.Database.Port)
+	env.string("DB_USER", &c.Database.User)
+	env.string("DB_PASSWORD", &c.Database.Password)
+	env.string("DB_NAME", &c.Database.DBName)
+	env.string("DB_SSLMODE", &c.Database.SSLMode)
+	env.int("DB_QUERY_TIMEOUT", &c.Database.QueryTimeout)
+	env.bool("DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+	env.int("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	env.int("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	env.int("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	env.int("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	env.slice("DB_REPLICA_HOSTS", &c.Database.ReplicaHosts)
+
+	env.string("REDIS_HOST", &c.Redis.Host)
+	env.string("REDIS_PORT", &c.Redis.Port)
+	env.string("REDIS_PASSWORD", &c.Redis.Password)
+	env.int("REDIS_DB", &c.Redis.DB)
+
+	env.string("CACHE_DRIVER", &c.Cache.Driver)
+	env.int("CACHE_TTL", &c.Cache.TTL)
+
+	env.string("JWT_SECRET", &c.JWT.Secret)
+	env.int("JWT_EXPIRY_MINUTES", &c.JWT.ExpiryMinutes)
+	env.int("JWT_REFRESH_EXPIRY_DAYS", &c.JWT.RefreshExpiryDays)
+
+	env.int("EMAIL_VERIFICATION_TTL_HOURS", &c.Auth.EmailVerificationTTLHours)
+	env.int("PASSWORD_RESET_TTL_MINUTES", &c.Auth.PasswordResetTTLMinutes)
+	env.bool("REQUIRE_VERIFIED_EMAIL", &c.Auth.RequireVerifiedEmail)
+	env.int("LOGIN_LOCKOUT_THRESHOLD", &c.Auth.LockoutThreshold)
+	env.int("LOGIN_LOCKOUT_SECONDS", &c.Auth.LockoutSeconds)
+	env.int("LOGIN_LOCKOUT_MAX_SECONDS", &c.Auth.LockoutMaxSeconds)
+
+	env.bool("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	env.bool("RATE_LIMIT_TRUST_PROXY", &c.RateLimit.TrustProxy)
+	for name, policy := range c.RateLimit.Policies {
+		env.rate("RATE_LIMIT_"+strings.ToUpper(name), &policy)
+		c.RateLimit.Policies[name] = policy
+	}
+
+	env.string("STRIPE_SECRET_KEY", &c.Payment.StripeSecretKey)
+	env.string("STRIPE_PUBLIC_KEY", &c.Payment.StripePublicKey)
+	env.string("STRIPE_API_BASE_URL", &c.Payment.StripeAPIBaseURL)
+	env.string("STRIPE_WEBHOOK_SECRET", &c.Payment.StripeWebhookSecret)
+	env.string("BKASH_APP_KEY", &c.Payment.BkashAppKey)
+	env.string("BKASH_APP_SECRET", &c.Payment.BkashAppSecret)
+	env.string("BKASH_USERNAME", &c.Payment.BkashUsername)
+	env.string("BKASH_PASSWORD", &c.Payment.BkashPassword)
+	env.string("BKASH_BASE_URL", &c.Payment.BkashBaseURL)
+	env.string("BKASH_CALLBACK_URL", &c.Payment.BkashCallbackURL)
+	env.string("BKASH_WEBHOOK_TOPIC_ARN", &c.Payment.BkashWebhookTopicARN)
+
+	env.string("SMTP_HOST", &c.Email.SMTPHost)
+	env.string("SMTP_PORT", &c.Email.SMTPPort)
+	env.string("SMTP_USERNAME", &c.Email.SMTPUsername)
+	env.string("SMTP_PASSWORD", &c.Email.SMTPPassword)
+	env.string("SMTP_TLS_MODE", &c.Email.SMTPTLSMode)
+	env.int("SMTP_BATCH_SIZE", &c.Email.SMTPBatchSize)
+	env.string("FROM_EMAIL", &c.Email.FromEmail)
+	env.string("FROM_NAME", &c.Email.FromName)
+	env.int("EMAIL_MAX_ATTEMPTS", &c.Email.MaxAttempts)
+
+	env.string("NOTIFICATION_SINK", &c.Notification.Sink)
+	env.string("NOTIFICATION_SINK_PATH", &c.Notification.SinkPath)
+	env.string("TWILIO_ACCOUNT_SID", &c.Notification.TwilioAccountSID)
+	env.string("TWILIO_AUTH_TOKEN", &c.Notification.TwilioAuthToken)
+	env.string("TWILIO_FROM_NUMBER", &c.Notification.TwilioFromNumber)
+	env.string("TWILIO_BASE_URL", &c.Notification.TwilioBaseURL)
+	env.string("VAPID_PUBLIC_KEY", &c.Notification.VAPIDPublicKey)
+	env.string("VAPID_PRIVATE_KEY", &c.Notification.VAPIDPrivateKey)
+	env.string("VAPID_SUBJECT", &c.Notification.VAPIDSubject)
+	env.int("PUSH_TTL_HOURS", &c.Notification.PushTTLHours)
+
+	env.int("INVENTORY_RESERVATION_TTL_MINUTES", &c.Inventory.ReservationTTLMinutes)
+
+	env.string("STORAGE_DRIVER", &c.Storage.Driver)
+	env.string("STORAGE_LOCAL_PATH", &c.Storage.LocalPath)
+	env.string("STORAGE_PUBLIC_URL", &c.Storage.PublicURL)
+	env.string("S3_ENDPOINT", &c.Storage.S3Endpoint)
+	env.string("S3_REGION", &c.Storage.S3Region)
+	env.string("S3_BUCKET", &c.Storage.S3Bucket)
+	env.string("S3_ACCESS_KEY_ID", &c.Storage.S3AccessKey)
+	env.string("S3_SECRET_ACCESS_KEY", &c.Storage.S3SecretKey)
+	env.bool("S3_PATH_STYLE", &c.Storage.S3PathStyle)
+	env.int("MEDIA_MAX_UPLOAD_MB", &c.Storage.MaxUploadMB)
+
+	return errors.Join(env.errs...)
+}
+
+// envReader sets configuration values from non-empty environment
+// variables and collects the ones that fail to parse
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) string(key string, target *string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
+	}
+}
+
+func (e *envReader) int(key string, target *int) {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer", key))
+		return
+	}
+	*target = value
+}
+
+func (e *envReader) bool(key string, target *bool) {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be true or false", key))
+		return
+	}
+	*target = value
+}
+
+// rate reads a limit written as requests/seconds, such as 10/60
+func (e *envReader) rate(key string, target *RateLimitPolicy) {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return
+	}
+	requestsStr, periodStr, _ := strings.Cut(valueStr, "/")
+	requests, err := strconv.Atoi(requestsStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be written as requests/seconds", key))
+		return
+	}
+	period, err := strconv.Atoi(periodStr)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be written as requests/seconds", key))
+		return
+	}
+	target.Requests, target.Period = requests, period
+}
+
+// slice reads a comma-separated list
+func (e *envReader) slice(key string, target *[]string) {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return
+	}
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	*target = values
+}
+
+// getEnv returns an environment variable, or defaultValue if it is empty
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -2,11 +2,13 @@ package inventory
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"ecommerce_project/pkg/pagination"
 	"ecommerce_project/pkg/utils"
 )
 
@@ -20,28 +22,23 @@ func NewHandler(service *Service) *Handler {
 
 // List retrieves all inventory records (admin only)
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	limit := 50
-	offset := 0
-
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
-		}
+	page, err := pagination.Parse(r.URL.Query(), 50)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil {
-			offset = parsed
-		}
+	inventories, meta, err := h.service.List(r.Context(), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	inventories, err := h.service.List(limit, offset)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Inventory retrieved successfully", inventories)
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Inventory retrieved successfully", inventories, meta)
 }
 
 // Update updates inventory (admin only)
@@ -64,7 +61,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	inventory, err := h.service.Update(id, &req)
+	inventory, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -4,10 +4,11 @@ import (
 	"time"
 )
 
-// Inventory represents product inventory
+// Inventory represents the stock of a product variant
 type Inventory struct {
 	ID        int64     `json:"id" db:"id"`
 	ProductID int64     `json:"product_id" db:"product_id"`
+	VariantID int64     `json:"variant_id" db:"variant_id"`
 	Quantity  int       `json:"quantity" db:"quantity"`
 	Reserved  int       `json:"reserved" db:"reserved"`
 	Available int       `json:"available"`
@@ -18,3 +19,17 @@ type Inventory struct {
 type UpdateInventoryRequest struct {
 	Quantity int `json:"quantity" validate:"required,gte=0"`
 }
+
+// Reservation holds stock for an order until its payment is confirmed,
+// the order is cancelled or the reservation expires
+type Reservation struct {
+	ID        int64     `json:"id" db:"id"`
+	OrderID   int64     `json:"order_id" db:"order_id"`
+	ProductID int64     `json:"product_id" db:"product_id"`
+	VariantID int64     `json:"variant_id" db:"variant_id"`
+	Quantity  int       `json:"quantity" db:"quantity"`
+	Status    string    `json:"status" db:"status"` // active, committed, released, restocked
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -1,31 +1,41 @@
 package inventory
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/pagination"
 )
 
 type Repository struct {
-	db *sql.DB
+	db db.DBTX
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// GetByProductID retrieves inventory for a product
-func (r *Repository) GetByProductID(productID int64) (*Inventory, error) {
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
+// GetByVariantID retrieves inventory for a product variant
+func (r *Repository) GetByVariantID(ctx context.Context, variantID int64) (*Inventory, error) {
 	query := `
-		SELECT id, product_id, quantity, reserved, updated_at
+		SELECT id, product_id, variant_id, quantity, reserved, updated_at
 		FROM inventory
-		WHERE product_id = $1
+		WHERE variant_id = $1
 	`
 
 	inventory := &Inventory{}
-	err := r.db.QueryRow(query, productID).Scan(
+	err := r.db.QueryRowContext(ctx, query, variantID).Scan(
 		&inventory.ID,
 		&inventory.ProductID,
+		&inventory.VariantID,
 		&inventory.Quantity,
 		&inventory.Reserved,
 		&inventory.UpdatedAt,
@@ -42,18 +52,27 @@ func (r *Repository) GetByProductID(productID int64) (*Inventory, error) {
 	return inventory, nil
 }
 
-// List retrieves all inventory records
-func (r *Repository) List(limit, offset int) ([]*Inventory, error) {
-	query := `
-		SELECT id, product_id, quantity, reserved, updated_at
-		FROM inventory
-		ORDER BY product_id ASC
-		LIMIT $1 OFFSET $2
-	`
+// List retrieves a page of inventory records by product and variant, and
+// the cursor of the next page, which is nil on the last page
+func (r *Repository) List(ctx context.Context, page *pagination.Page) ([]*Inventory, *pagination.Cursor, error) {
+	query := `SELECT id, product_id, variant_id, quantity, reserved, updated_at FROM inventory`
+	args := []interface{}{}
 
-	rows, err := r.db.Query(query, limit, offset)
+	if page.Cursor != nil {
+		productID, err := page.Cursor.Int()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, productID, page.Cursor.ID)
+		query += " WHERE (product_id, variant_id) > ($1, $2)"
+	}
+
+	args = append(args, page.FetchLimit(), page.Offset)
+	query += fmt.Sprintf(" ORDER BY product_id ASC, variant_id ASC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list inventory: %w", err)
+		return nil, nil, fmt.Errorf("failed to list inventory: %w", err)
 	}
 	defer rows.Close()
 
@@ -63,23 +82,43 @@ func (r *Repository) List(limit, offset int) ([]*Inventory, error) {
 		err := rows.Scan(
 			&inventory.ID,
 			&inventory.ProductID,
+			&inventory.VariantID,
 			&inventory.Quantity,
 			&inventory.Reserved,
 			&inventory.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan inventory: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan inventory: %w", err)
 		}
 		inventory.Available = inventory.Quantity - inventory.Reserved
 		inventories = append(inventories, inventory)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list inventory: %w", err)
+	}
 
-	return inventories, nil
+	if !page.HasMore(len(inventories)) {
+		return inventories, nil, nil
+	}
+	inventories = inventories[:page.Limit]
+	last := inventories[len(inventories)-1]
+
+	return inventories, pagination.IntCursor(last.ProductID, last.VariantID), nil
+}
+
+// Count returns the number of inventory records
+func (r *Repository) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM inventory`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count inventory: %w", err)
+	}
+
+	return count, nil
 }
 
 // CheckStock checks if sufficient stock is available
-func (r *Repository) CheckStock(productID int64, quantity int) (bool, error) {
-	inventory, err := r.GetByProductID(productID)
+func (r *Repository) CheckStock(ctx context.Context, variantID int64, quantity int) (bool, error) {
+	inventory, err := r.GetByVariantID(ctx, variantID)
 	if err != nil {
 		return false, err
 	}
@@ -88,14 +127,14 @@ func (r *Repository) CheckStock(productID int64, quantity int) (bool, error) {
 }
 
 // ReduceStock reduces inventory stock
-func (r *Repository) ReduceStock(productID int64, quantity int) error {
+func (r *Repository) ReduceStock(ctx context.Context, variantID int64, quantity int) error {
 	query := `
 		UPDATE inventory
 		SET quantity = quantity - $1, updated_at = $2
-		WHERE product_id = $3 AND quantity >= $1
+		WHERE variant_id = $3 AND quantity >= $1
 	`
 
-	result, err := r.db.Exec(query, quantity, time.Now(), productID)
+	result, err := r.db.ExecContext(ctx, query, quantity, time.Now(), variantID)
 	if err != nil {
 		return fmt.Errorf("failed to reduce stock: %w", err)
 	}
@@ -112,18 +151,211 @@ func (r *Repository) ReduceStock(productID int64, quantity int) error {
 	return nil
 }
 
+// Restock adds quantity units back to a variant's stock
+func (r *Repository) Restock(ctx context.Context, variantID int64, quantity int) error {
+	query := `
+		UPDATE inventory
+		SET quantity = quantity + $1, updated_at = $2
+		WHERE variant_id = $3
+	`
+
+	_, err := r.db.ExecContext(ctx, query, quantity, time.Now(), variantID)
+	if err != nil {
+		return fmt.Errorf("failed to restock: %w", err)
+	}
+
+	return nil
+}
+
 // Update updates inventory quantity
-func (r *Repository) Update(id int64, quantity int) error {
+func (r *Repository) Update(ctx context.Context, id int64, quantity int) error {
 	query := `
 		UPDATE inventory
 		SET quantity = $1, updated_at = $2
 		WHERE id = $3
 	`
 
-	_, err := r.db.Exec(query, quantity, time.Now(), id)
+	_, err := r.db.ExecContext(ctx, query, quantity, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to update inventory: %w", err)
 	}
 
 	return nil
 }
+
+// Reserve holds quantity units of a variant for an order until expiresAt
+func (r *Repository) Reserve(ctx context.Context, orderID, variantID int64, quantity int, expiresAt time.Time) error {
+	query := `
+		UPDATE inventory
+		SET reserved = reserved + $1, updated_at = $2
+		WHERE variant_id = $3 AND quantity - reserved >= $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, quantity, time.Now(), variantID)
+	if err != nil {
+		return fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("insufficient stock")
+	}
+
+	insertQuery := `
+		INSERT INTO inventory_reservations (order_id, product_id, variant_id, quantity, status, expires_at, created_at, updated_at)
+		SELECT $1, product_id, id, $3, 'active', $4, $5, $6 FROM product_variants WHERE id = $2
+	`
+
+	_, err = r.db.ExecContext(ctx, insertQuery, orderID, variantID, quantity, expiresAt, time.Now(), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	return nil
+}
+
+// CommitReservations turns an order's active reservations into real stock
+// decrements
+func (r *Repository) CommitReservations(ctx context.Context, orderID int64) error {
+	query := `
+		WITH committed AS (
+			UPDATE inventory_reservations
+			SET status = 'committed', updated_at = $2
+			WHERE order_id = $1 AND status = 'active'
+			RETURNING variant_id, quantity
+		)
+		UPDATE inventory i
+		SET quantity = i.quantity - c.quantity, reserved = i.reserved - c.quantity, updated_at = $2
+		FROM (SELECT variant_id, SUM(quantity) AS quantity FROM committed GROUP BY variant_id) c
+		WHERE i.variant_id = c.variant_id
+	`
+
+	_, err := r.db.ExecContext(ctx, query, orderID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to commit reservations: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseReservations returns an order's active reservations to available
+// stock
+func (r *Repository) ReleaseReservations(ctx context.Context, orderID int64) error {
+	query := `
+		WITH released AS (
+			UPDATE inventory_reservations
+			SET status = 'released', updated_at = $2
+			WHERE order_id = $1 AND status = 'active'
+			RETURNING variant_id, quantity
+		)
+		UPDATE inventory i
+		SET reserved = i.reserved - r.quantity, updated_at = $2
+		FROM (SELECT variant_id, SUM(quantity) AS quantity FROM released GROUP BY variant_id) r
+		WHERE i.variant_id = r.variant_id
+	`
+
+	_, err := r.db.ExecContext(ctx, query, orderID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to release reservations: %w", err)
+	}
+
+	return nil
+}
+
+// RestockReservations puts the stock of an order's committed reservations
+// back into inventory
+func (r *Repository) RestockReservations(ctx context.Context, orderID int64) error {
+	query := `
+		WITH restocked AS (
+			UPDATE inventory_reservations
+			SET status = 'restocked', updated_at = $2
+			WHERE order_id = $1 AND status = 'committed'
+			RETURNING variant_id, quantity
+		)
+		UPDATE inventory i
+		SET quantity = i.quantity + r.quantity, updated_at = $2
+		FROM (SELECT variant_id, SUM(quantity) AS quantity FROM restocked GROUP BY variant_id) r
+		WHERE i.variant_id = r.variant_id
+	`
+
+	_, err := r.db.ExecContext(ctx, query, orderID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to restock reservations: %w", err)
+	}
+
+	return nil
+}
+
+// HasReservations reports whether any reservations were made for an order.
+// Orders placed before reservations existed decremented stock directly.
+func (r *Repository) HasReservations(ctx context.Context, orderID int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM inventory_reservations WHERE order_id = $1)`
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, orderID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check reservations: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ExpiredReservationOrders returns the IDs of pending orders with active
+// reservations past their expiry that are unpaid, because no payment was
+// made or the last one failed. Orders confirmed by an admin keep
+// their reservations until they are paid or cancelled.
+func (r *Repository) ExpiredReservationOrders(ctx context.Context) ([]int64, error) {
+	query := `
+		SELECT DISTINCT r.order_id
+		FROM inventory_reservations r
+		JOIN orders o ON o.id = r.order_id
+		WHERE r.status = 'active' AND r.expires_at < $1
+			AND o.status = 'pending' AND o.payment_status IN ('pending', 'failed')
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired reservations: %w", err)
+	}
+	defer rows.Close()
+
+	orderIDs := []int64{}
+	for rows.Next() {
+		var orderID int64
+		if err := rows.Scan(&orderID); err != nil {
+			return nil, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find expired reservations: %w", err)
+	}
+
+	return orderIDs, nil
+}
+
+// LockActiveReservations locks an order's active reservations until the
+// end of the transaction and reports whether it has any
+func (r *Repository) LockActiveReservations(ctx context.Context, orderID int64) (bool, error) {
+	query := `SELECT id FROM inventory_reservations WHERE order_id = $1 AND status = 'active' FOR UPDATE`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock reservations: %w", err)
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to lock reservations: %w", err)
+	}
+
+	return found, nil
+}
@@ -1,5 +1,12 @@
 package inventory
 
+import (
+	"context"
+
+	"ecommerce_project/pkg/pagination"
+	"ecommerce_project/pkg/utils"
+)
+
 type Service struct {
 	repo *Repository
 }
@@ -8,23 +15,30 @@ func NewService(repo *Repository) *Service {
 	return &Service{repo: repo}
 }
 
-// GetByProductID retrieves inventory for a product
-func (s *Service) GetByProductID(productID int64) (*Inventory, error) {
-	return s.repo.GetByProductID(productID)
+// GetByVariantID retrieves inventory for a product variant
+func (s *Service) GetByVariantID(ctx context.Context, variantID int64) (*Inventory, error) {
+	return s.repo.GetByVariantID(ctx, variantID)
 }
 
-// List retrieves all inventory records
-func (s *Service) List(limit, offset int) ([]*Inventory, error) {
-	if limit == 0 {
-		limit = 50
+// List retrieves a page of inventory records with the total number of
+// records
+func (s *Service) List(ctx context.Context, page *pagination.Page) ([]*Inventory, utils.Pagination, error) {
+	inventories, next, err := s.repo.List(ctx, page)
+	if err != nil {
+		return nil, utils.Pagination{}, err
+	}
+
+	total, err := s.repo.Count(ctx)
+	if err != nil {
+		return nil, utils.Pagination{}, err
 	}
 
-	return s.repo.List(limit, offset)
+	return inventories, page.Meta(total, next), nil
 }
 
 // Update updates inventory quantity
-func (s *Service) Update(id int64, req *UpdateInventoryRequest) (*Inventory, error) {
-	if err := s.repo.Update(id, req.Quantity); err != nil {
+func (s *Service) Update(ctx context.Context, id int64, req *UpdateInventoryRequest) (*Inventory, error) {
+	if err := s.repo.Update(ctx, id, req.Quantity); err != nil {
 		return nil, err
 	}
 
@@ -36,11 +50,11 @@ func (s *Service) Update(id int64, req *UpdateInventoryRequest) (*Inventory, err
 }
 
 // CheckStock checks if sufficient stock is available
-func (s *Service) CheckStock(productID int64, quantity int) (bool, error) {
-	return s.repo.CheckStock(productID, quantity)
+func (s *Service) CheckStock(ctx context.Context, variantID int64, quantity int) (bool, error) {
+	return s.repo.CheckStock(ctx, variantID, quantity)
 }
 
 // ReduceStock reduces inventory stock
-func (s *Service) ReduceStock(productID int64, quantity int) error {
-	return s.repo.ReduceStock(productID, quantity)
+func (s *Service) ReduceStock(ctx context.Context, variantID int64, quantity int) error {
+	return s.repo.ReduceStock(ctx, variantID, quantity)
 }
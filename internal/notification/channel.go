@@ -0,0 +1,231 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/email"
+	"ecommerce_project/pkg/logger"
+	"ecommerce_project/pkg/push"
+	"ecommerce_project/pkg/sms"
+)
+
+// ErrUndeliverable is returned by channels when retrying a message cannot
+// succeed. Such messages are dead-lettered immediately.
+var ErrUndeliverable = errors.New("notification is undeliverable")
+
+// Channel delivers queued messages of one kind. The recipient and body of
+// a message are in the channel's format: an email address and HTML, a
+// phone number and plain text, or a push subscription ID and a JSON
+// payload.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, msg *OutboxMessage) error
+}
+
+// Mailer delivers email with an optional plain-text alternative. It is
+// implemented by pkg/email.SMTPClient.
+type Mailer interface {
+	SendEmail(to, subject, htmlBody, textBody string) error
+}
+
+// SMSSender delivers text messages. It is implemented by
+// pkg/sms.TwilioClient.
+type SMSSender interface {
+	SendSMS(to, body string) error
+}
+
+// PushSender delivers Web Push messages. It is implemented by
+// pkg/push.Client.
+type PushSender interface {
+	Send(sub *push.Subscription, payload []byte) error
+}
+
+// EmailChannel sends email through a Mailer
+type EmailChannel struct {
+	mailer Mailer
+}
+
+func NewEmailChannel(mailer Mailer) *EmailChannel {
+	return &EmailChannel{mailer: mailer}
+}
+
+func (c *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+// Send sends the email. A recipient or message the server refuses with a
+// 5xx reply is undeliverable.
+func (c *EmailChannel) Send(ctx context.Context, msg *OutboxMessage) error {
+	err := c.mailer.SendEmail(msg.Recipient, msg.Subject, msg.Body, msg.TextBody)
+	if errors.Is(err, email.ErrRejected) {
+		return fmt.Errorf("%w: %v", ErrUndeliverable, err)
+	}
+	return err
+}
+
+// SMSChannel sends text messages through an SMSSender
+type SMSChannel struct {
+	sender SMSSender
+}
+
+func NewSMSChannel(sender SMSSender) *SMSChannel {
+	return &SMSChannel{sender: sender}
+}
+
+func (c *SMSChannel) Name() string {
+	return ChannelSMS
+}
+
+func (c *SMSChannel) Send(ctx context.Context, msg *OutboxMessage) error {
+	err := c.sender.SendSMS(msg.Recipient, msg.Body)
+	if errors.Is(err, sms.ErrRejected) {
+		return fmt.Errorf("%w: %v", ErrUndeliverable, err)
+	}
+	return err
+}
+
+// PushChannel sends Web Push notifications to a stored subscription.
+// Subscriptions the push service reports as gone are deleted.
+type PushChannel struct {
+	repo   *Repository
+	sender PushSender
+}
+
+func NewPushChannel(repo *Repository, sender PushSender) *PushChannel {
+	return &PushChannel{repo: repo, sender: sender}
+}
+
+func (c *PushChannel) Name() string {
+	return ChannelPush
+}
+
+func (c *PushChannel) Send(ctx context.Context, msg *OutboxMessage) error {
+	id, err := strconv.ParseInt(msg.Recipient, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid push subscription %q", ErrUndeliverable, msg.Recipient)
+	}
+
+	sub, err := c.repo.GetPushSubscription(ctx, id)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return fmt.Errorf("%w: %v", ErrUndeliverable, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = c.sender.Send(&push.Subscription{
+		Endpoint: sub.Endpoint,
+		P256dh:   sub.P256dh,
+		Auth:     sub.Auth,
+	}, []byte(msg.Body))
+
+	if errors.Is(err, push.ErrSubscriptionGone) {
+		if err := c.repo.DeleteExpiredPushSubscription(ctx, sub.ID); err != nil {
+			logger.Error("Failed to delete expired push subscription", "subscription_id", sub.ID, "error", err)
+		}
+		return fmt.Errorf("%w: %v", ErrUndeliverable, err)
+	}
+	return err
+}
+
+// LogChannel is a development sink that records messages instead of
+// delivering them. Without a file only the outbox ID is logged; with one the
+// full messages are appended to it as JSON lines.
+type LogChannel struct {
+	name string
+	path string
+	mu   *sync.Mutex
+}
+
+// NewLogChannel creates a sink standing in for the named channel. It logs
+// messages when path is empty.
+func NewLogChannel(name, path string) *LogChannel {
+	return &LogChannel{name: name, path: path, mu: &sync.Mutex{}}
+}
+
+func (c *LogChannel) Name() string {
+	return c.name
+}
+
+func (c *LogChannel) Send(ctx context.Context, msg *OutboxMessage) error {
+	if c.path == "" {
+		logger.Info("Notification",
+			"notification_id", msg.ID,
+			"channel", c.name,
+			"event", msg.Event,
+		)
+		return nil
+	}
+
+	line, err := json.Marshal(map[string]interface{}{
+		"time":      time.Now().Format(time.RFC3339),
+		"channel":   c.name,
+		"event":     msg.Event,
+		"recipient": msg.Recipient,
+		"subject":   msg.Subject,
+		"body":      msg.Body,
+		"text_body": msg.TextBody,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification sink: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write notification sink: %w", err)
+	}
+
+	return nil
+}
+
+// NewChannels builds the channels selected by the configuration. The log
+// and file sinks stand in for every channel. The live sink always sends
+// email; SMS and push are only available once Twilio and VAPID
+// credentials are configured.
+func NewChannels(repo *Repository, emailConfig *config.EmailConfig, cfg *config.NotificationConfig) ([]Channel, error) {
+	switch cfg.Sink {
+	case config.NotificationSinkLog, config.NotificationSinkFile:
+		path := ""
+		if cfg.Sink == config.NotificationSinkFile {
+			path = cfg.SinkPath
+		}
+		mu := &sync.Mutex{}
+		channels := make([]Channel, 0, len(channelNames))
+		for _, name := range channelNames {
+			channels = append(channels, &LogChannel{name: name, path: path, mu: mu})
+		}
+		return channels, nil
+	}
+
+	channels := []Channel{NewEmailChannel(email.NewSMTPClient(emailConfig))}
+
+	if cfg.TwilioAccountSID != "" {
+		channels = append(channels, NewSMSChannel(sms.NewTwilioClient(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFromNumber, cfg.TwilioBaseURL)))
+	}
+
+	if cfg.VAPIDPrivateKey != "" {
+		client, err := push.NewClient(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey, cfg.VAPIDSubject, time.Duration(cfg.PushTTLHours)*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, NewPushChannel(repo, client))
+	}
+
+	return channels, nil
+}
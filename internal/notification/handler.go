@@ -0,0 +1,174 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"ecommerce_project/pkg/utils"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// GetPreferences lists the authenticated user's notification preferences
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	preferences, err := h.service.GetPreferences(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Notification preferences retrieved successfully", preferences)
+}
+
+// UpdatePreferences opts the authenticated user in or out of notifications
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	var req UpdatePreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	preferences, err := h.service.UpdatePreferences(r.Context(), userID, &req)
+	if errors.Is(err, ErrInvalidPreference) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Notification preferences updated successfully", preferences)
+}
+
+// GetPushPublicKey returns the VAPID public key browsers subscribe with
+func (h *Handler) GetPushPublicKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.service.PushPublicKey()
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Push public key retrieved successfully", map[string]string{
+		"public_key": key,
+	})
+}
+
+// ListPushSubscriptions lists the browsers subscribed for the authenticated
+// user
+func (h *Handler) ListPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	subscriptions, err := h.service.ListPushSubscriptions(r.Context(), userID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Push subscriptions retrieved successfully", subscriptions)
+}
+
+// SubscribePush registers a browser for push notifications
+func (h *Handler) SubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	var req CreatePushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub, err := h.service.SubscribePush(r.Context(), userID, &req, r.UserAgent())
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Push subscription created successfully", sub)
+}
+
+// UnsubscribePush removes one of the authenticated user's push
+// subscriptions
+func (h *Handler) UnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	vars := mux.Vars(r)
+	subscriptionID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid subscription ID")
+		return
+	}
+
+	err = h.service.UnsubscribePush(r.Context(), userID, subscriptionID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Push subscription deleted successfully", nil)
+}
+
+// ListTemplates lists the notification templates and their locales (admin
+// only)
+func (h *Handler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	utils.SuccessResponse(w, http.StatusOK, "Notification templates retrieved successfully", h.service.ListTemplates())
+}
+
+// PreviewTemplate renders a template with sample data (admin only). The
+// locale query parameter selects the variant; format=html or format=text
+// returns that part on its own instead of JSON.
+func (h *Handler) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	query := r.URL.Query()
+
+	msg, err := h.service.PreviewTemplate(name, query.Get("locale"))
+	if errors.Is(err, ErrTemplateNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch query.Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(msg.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(msg.Text))
+	default:
+		utils.SuccessResponse(w, http.StatusOK, "Notification template rendered successfully", msg)
+	}
+}
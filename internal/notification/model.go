@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"time"
+)
+
+// Outbox message statuses
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
+)
+
+// Delivery channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelPush  = "push"
+)
+
+// channelNames lists the channels in the order they are offered to users
+var channelNames = []string{ChannelEmail, ChannelSMS, ChannelPush}
+
+// Event types users are notified about
+const (
+	// EventAccount covers sign up, email verification and password reset
+	EventAccount     = "account"
+	EventOrderPlaced = "order_placed"
+	// Users can opt in or out of the events below
+	EventOrderShipped = "order_shipped"
+	EventPriceDrop    = "price_drop"
+	EventMarketing    = "marketing"
+)
+
+// EventType describes how an event is delivered by default
+type EventType struct {
+	// Mandatory events are always sent over their default channels and
+	// cannot be switched off
+	Mandatory bool
+	// Defaults lists the channels used until the user chooses otherwise
+	Defaults map[string]bool
+}
+
+// eventTypes holds every event the service can send. Marketing is opt-in.
+var eventTypes = map[string]EventType{
+	EventAccount:      {Mandatory: true, Defaults: map[string]bool{ChannelEmail: true}},
+	EventOrderPlaced:  {Mandatory: true, Defaults: map[string]bool{ChannelEmail: true}},
+	EventOrderShipped: {Defaults: map[string]bool{ChannelEmail: true, ChannelPush: true}},
+	EventPriceDrop:    {Defaults: map[string]bool{ChannelEmail: true}},
+	EventMarketing:    {Defaults: map[string]bool{}},
+}
+
+// configurableEvents lists the events shown in the preferences API
+var configurableEvents = []string{EventOrderShipped, EventPriceDrop, EventMarketing}
+
+// OutboxMessage is a notification waiting in the outbox. Messages are
+// written by the API, possibly in the same transaction as the change they
+// announce, and delivered by the worker through the channel they name.
+type OutboxMessage struct {
+	ID            int64      `json:"id" db:"id"`
+	Channel       string     `json:"channel" db:"channel"`
+	Event         string     `json:"event" db:"event"`
+	Recipient     string     `json:"recipient" db:"recipient"`
+	Subject       string     `json:"subject" db:"subject"`
+	Body          string     `json:"-" db:"body"`
+	TextBody      string     `json:"-" db:"text_body"`   // plain-text alternative of an HTML email
+	Status        string     `json:"status" db:"status"` // pending, sending, sent, dead
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Message is a rendered notification for every channel
+type Message struct {
+	// Locale is the locale the message was rendered in
+	Locale string `json:"locale"`
+	// Subject is the email subject and the push notification title
+	Subject string `json:"subject"`
+	// HTML is the email body
+	HTML string `json:"html"`
+	// Text is the plain-text email alternative and the SMS and push
+	// notification body
+	Text string `json:"text"`
+	// URL is opened when the push notification is clicked
+	URL string `json:"url,omitempty"`
+}
+
+// Contact holds where a user can be reached and in which language
+type Contact struct {
+	Email  string
+	Phone  string
+	Locale string
+}
+
+// Preference is whether a user receives an event over a channel
+type Preference struct {
+	Event   string `json:"event" db:"event"`
+	Channel string `json:"channel" db:"channel"`
+	Enabled bool   `json:"enabled" db:"enabled"`
+}
+
+// PreferenceUpdate represents one entry of an update preferences request
+type PreferenceUpdate struct {
+	Event   string `json:"event" validate:"required"`
+	Channel string `json:"channel" validate:"required"`
+	Enabled *bool  `json:"enabled" validate:"required"`
+}
+
+// UpdatePreferencesRequest represents the update notification preferences
+// request payload
+type UpdatePreferencesRequest struct {
+	Preferences []PreferenceUpdate `json:"preferences" validate:"required,min=1,dive"`
+}
+
+// PushSubscription is a browser subscribed to Web Push notifications
+type PushSubscription struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Endpoint  string    `json:"endpoint" db:"endpoint"`
+	P256dh    string    `json:"-" db:"p256dh"`
+	Auth      string    `json:"-" db:"auth"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// CreatePushSubscriptionRequest is the PushSubscription.toJSON() of the
+// browser
+type CreatePushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" validate:"required,url,startswith=https://"`
+	Keys     struct {
+		P256dh string `json:"p256dh" validate:"required"`
+		Auth   string `json:"auth" validate:"required"`
+	} `json:"keys"`
+}
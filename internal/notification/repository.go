@@ -0,0 +1,340 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"ecommerce_project/pkg/db"
+)
+
+// ErrSubscriptionNotFound is returned when a push subscription does not
+// exist or belongs to another user
+var ErrSubscriptionNotFound = errors.New("push subscription not found")
+
+type Repository struct {
+	db db.DBTX
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
+// Enqueue adds a message to the outbox
+func (r *Repository) Enqueue(ctx context.Context, msg *OutboxMessage) error {
+	query := `
+		INSERT INTO notification_outbox (channel, event, recipient, subject, body, text_body, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, $8, $8)
+		RETURNING id, status, next_attempt_at, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		msg.Channel,
+		msg.Event,
+		msg.Recipient,
+		msg.Subject,
+		msg.Body,
+		msg.TextBody,
+		StatusPending,
+		time.Now(),
+	).Scan(&msg.ID, &msg.Status, &msg.NextAttemptAt, &msg.CreatedAt, &msg.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to enqueue notification: %w", err)
+	}
+
+	return nil
+}
+
+// Claim locks up to limit messages that are due for delivery and leases
+// them to the caller until lease has passed. Rows locked by another worker
+// are skipped, and messages whose lease ran out, because the worker that
+// claimed them died, are claimed again.
+func (r *Repository) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	query := `
+		UPDATE notification_outbox
+		SET status = $1, attempts = attempts + 1, locked_until = $2, updated_at = $3
+		WHERE id IN (
+			SELECT id
+			FROM notification_outbox
+			WHERE (status = $4 AND next_attempt_at <= $3)
+				OR (status = $1 AND locked_until < $3)
+			ORDER BY next_attempt_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, channel, event, recipient, subject, body, text_body, status, attempts, next_attempt_at, locked_until, last_error, created_at, updated_at
+	`
+
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, StatusSending, now.Add(lease), now, StatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+	for rows.Next() {
+		var msg OutboxMessage
+		err := rows.Scan(
+			&msg.ID,
+			&msg.Channel,
+			&msg.Event,
+			&msg.Recipient,
+			&msg.Subject,
+			&msg.Body,
+			&msg.TextBody,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LockedUntil,
+			&msg.LastError,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkSent marks a message as delivered. The bodies are dropped because
+// they may contain single-use links.
+func (r *Repository) MarkSent(ctx context.Context, id int64) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = $1, body = '', text_body = '', locked_until = NULL, last_error = '', sent_at = $2, updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := r.db.ExecContext(ctx, query, StatusSent, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt
+func (r *Repository) MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = $1, locked_until = NULL, last_error = $2, next_attempt_at = $3, updated_at = $4
+		WHERE id = $5
+	`
+
+	_, err := r.db.ExecContext(ctx, query, StatusPending, lastError, nextAttemptAt, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification failed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDead moves a message that keeps failing to the dead-letter state
+func (r *Repository) MarkDead(ctx context.Context, id int64, lastError string) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = $1, locked_until = NULL, last_error = $2, updated_at = $3
+		WHERE id = $4
+	`
+
+	_, err := r.db.ExecContext(ctx, query, StatusDead, lastError, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification dead: %w", err)
+	}
+
+	return nil
+}
+
+// GetPreferences returns the preferences a user has set. Events and
+// channels without a row use the defaults of their event type.
+func (r *Repository) GetPreferences(ctx context.Context, userID int64) ([]Preference, error) {
+	query := `
+		SELECT event, channel, enabled
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	preferences := []Preference{}
+	for rows.Next() {
+		var p Preference
+		if err := rows.Scan(&p.Event, &p.Channel, &p.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		preferences = append(preferences, p)
+	}
+
+	return preferences, rows.Err()
+}
+
+// SetPreferences stores a user's preferences in a single statement, so an
+// update is applied completely or not at all
+func (r *Repository) SetPreferences(ctx context.Context, userID int64, preferences []Preference) error {
+	events := make([]string, 0, len(preferences))
+	channels := make([]string, 0, len(preferences))
+	enabled := make([]bool, 0, len(preferences))
+	for _, p := range preferences {
+		events = append(events, p.Event)
+		channels = append(channels, p.Channel)
+		enabled = append(enabled, p.Enabled)
+	}
+
+	query := `
+		INSERT INTO notification_preferences (user_id, event, channel, enabled, updated_at)
+		SELECT $1, t.event, t.channel, t.enabled, $5
+		FROM unnest($2::text[], $3::text[], $4::boolean[]) AS t(event, channel, enabled)
+		ON CONFLICT (user_id, event, channel)
+		DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, pq.StringArray(events), pq.StringArray(channels), pq.BoolArray(enabled), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set notification preferences: %w", err)
+	}
+
+	return nil
+}
+
+// SavePushSubscription stores a push subscription. A browser that
+// subscribes again, possibly for another user, replaces its old keys.
+func (r *Repository) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+	query := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (endpoint)
+		DO UPDATE SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth, user_agent = EXCLUDED.user_agent
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		sub.UserID,
+		sub.Endpoint,
+		sub.P256dh,
+		sub.Auth,
+		sub.UserAgent,
+		time.Now(),
+	).Scan(&sub.ID, &sub.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save push subscription: %w", err)
+	}
+
+	return nil
+}
+
+// GetPushSubscription retrieves a push subscription by ID
+func (r *Repository) GetPushSubscription(ctx context.Context, id int64) (*PushSubscription, error) {
+	query := `
+		SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions
+		WHERE id = $1
+	`
+
+	sub := &PushSubscription{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.Endpoint,
+		&sub.P256dh,
+		&sub.Auth,
+		&sub.UserAgent,
+		&sub.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// ListPushSubscriptions lists the browsers a user subscribed
+func (r *Repository) ListPushSubscriptions(ctx context.Context, userID int64) ([]PushSubscription, error) {
+	query := `
+		SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []PushSubscription{}
+	for rows.Next() {
+		var sub PushSubscription
+		err := rows.Scan(
+			&sub.ID,
+			&sub.UserID,
+			&sub.Endpoint,
+			&sub.P256dh,
+			&sub.Auth,
+			&sub.UserAgent,
+			&sub.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan push subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// DeletePushSubscription removes one of a user's push subscriptions
+func (r *Repository) DeletePushSubscription(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+	if rows == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredPushSubscription removes a subscription the push service
+// no longer accepts
+func (r *Repository) DeleteExpiredPushSubscription(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+
+	return nil
+}
@@ -1,77 +1,439 @@
 package notification
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
 	"ecommerce_project/internal/config"
 	"ecommerce_project/pkg/logger"
+	"ecommerce_project/pkg/push"
+)
+
+// Outbox delivery settings
+const (
+	// outboxLease is how long a claimed message is reserved for the worker
+	// that claimed it
+	outboxLease = 5 * time.Minute
+	// retryBaseDelay is the delay after the first failed delivery; it
+	// doubles with every further failure up to retryMaxDelay
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
+var (
+	// ErrInvalidPreference is returned for preferences of unknown or
+	// mandatory events and of unavailable channels
+	ErrInvalidPreference = errors.New("invalid notification preference")
+	// ErrPushUnavailable is returned when push notifications are not
+	// configured
+	ErrPushUnavailable = errors.New("push notifications are not available")
 )
 
 type Service struct {
-	emailConfig *config.EmailConfig
+	repo               *Repository
+	users              UserDirectory
+	renderer           *Renderer
+	emailConfig        *config.EmailConfig
+	notificationConfig *config.NotificationConfig
+	channels           map[string]Channel
+}
+
+// UserDirectory looks up how to reach a user. The worker only delivers
+// queued messages and may pass nil.
+type UserDirectory interface {
+	GetContact(ctx context.Context, userID int64) (*Contact, error)
+}
+
+func NewService(repo *Repository, users UserDirectory, renderer *Renderer, emailConfig *config.EmailConfig, notificationConfig *config.NotificationConfig, channels []Channel) *Service {
+	byName := make(map[string]Channel, len(channels))
+	for _, channel := range channels {
+		byName[channel.Name()] = channel
+	}
+
+	return &Service{
+		repo:               repo,
+		users:              users,
+		renderer:           renderer,
+		emailConfig:        emailConfig,
+		notificationConfig: notificationConfig,
+		channels:           byName,
+	}
 }
 
-func NewService(emailConfig *config.EmailConfig) *Service {
+// WithTx returns a copy of the service that enqueues notifications inside
+// tx, so that they are only sent if the transaction commits
+func (s *Service) WithTx(tx *sql.Tx) *Service {
 	return &Service{
-		emailConfig: emailConfig,
+		repo:               s.repo.WithTx(tx),
+		users:              s.users,
+		renderer:           s.renderer,
+		emailConfig:        s.emailConfig,
+		notificationConfig: s.notificationConfig,
+		channels:           s.channels,
 	}
 }
 
-// SendEmail sends an email notification
-func (s *Service) SendEmail(to, subject, body string) error {
-	logger.Info("Sending email",
-		"to", to,
-		"subject", subject,
+// Notify renders a template in the user's locale and queues it for every
+// channel over which the user receives event. Mandatory events use their
+// default channels; other events follow the user's preferences. A "URL"
+// in data is opened when a push notification is clicked. The worker
+// delivers the queued messages with ProcessOutbox.
+func (s *Service) Notify(ctx context.Context, userID int64, event, templateName string, data map[string]interface{}) error {
+	channels, err := s.enabledChannels(ctx, userID, event)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	contact, err := s.users.GetContact(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.renderer.Render(templateName, contact.Locale, data)
+	if err != nil {
+		return err
+	}
+	if url, ok := data["URL"].(string); ok {
+		msg.URL = url
+	}
+
+	for _, channel := range channels {
+		switch channel {
+		case ChannelEmail:
+			err = s.enqueue(ctx, ChannelEmail, event, contact.Email, msg.Subject, msg.HTML, msg.Text)
+		case ChannelSMS:
+			if contact.Phone == "" {
+				continue
+			}
+			err = s.enqueue(ctx, ChannelSMS, event, contact.Phone, msg.Subject, msg.Text, "")
+		case ChannelPush:
+			err = s.enqueuePush(ctx, userID, event, msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enqueue writes a message for one channel to the outbox
+func (s *Service) enqueue(ctx context.Context, channel, event, recipient, subject, body, textBody string) error {
+	msg := &OutboxMessage{
+		Channel:   channel,
+		Event:     event,
+		Recipient: recipient,
+		Subject:   subject,
+		Body:      body,
+		TextBody:  textBody,
+	}
+	if err := s.repo.Enqueue(ctx, msg); err != nil {
+		return err
+	}
+
+	// Recipients are personal data and stay out of the log; the outbox row
+	// has them
+	logger.Info("Queued notification",
+		"notification_id", msg.ID,
+		"channel", channel,
+		"event", event,
 	)
+	return nil
+}
 
-	// Placeholder for actual email sending implementation
-	// In production, use SMTP or a service like SendGrid
+// enqueuePush queues msg for every browser the user subscribed
+func (s *Service) enqueuePush(ctx context.Context, userID int64, event string, msg *Message) error {
+	subscriptions, err := s.repo.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"title": msg.Subject,
+		"body":  msg.Text,
+		"url":   msg.URL,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscriptions {
+		if err := s.enqueue(ctx, ChannelPush, event, strconv.FormatInt(sub.ID, 10), msg.Subject, string(payload), ""); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// SendOrderConfirmation sends order confirmation email
-func (s *Service) SendOrderConfirmation(to, orderNumber string, amount float64) error {
-	subject := "Order Confirmation"
-	body := generateOrderConfirmationEmail(orderNumber, amount)
-	return s.SendEmail(to, subject, body)
+// enabledChannels returns the available channels over which the user
+// receives event
+func (s *Service) enabledChannels(ctx context.Context, userID int64, event string) ([]string, error) {
+	eventType, ok := eventTypes[event]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification event %q", event)
+	}
+
+	enabled := make(map[string]bool, len(channelNames))
+	for channel, on := range eventType.Defaults {
+		enabled[channel] = on
+	}
+
+	if !eventType.Mandatory {
+		preferences, err := s.repo.GetPreferences(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range preferences {
+			if p.Event == event {
+				enabled[p.Channel] = p.Enabled
+			}
+		}
+	}
+
+	channels := []string{}
+	for _, channel := range channelNames {
+		if _, available := s.channels[channel]; available && enabled[channel] {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels, nil
 }
 
-// SendPasswordReset sends password reset email
-func (s *Service) SendPasswordReset(to, resetToken string) error {
-	subject := "Password Reset Request"
-	body := generatePasswordResetEmail(resetToken)
-	return s.SendEmail(to, subject, body)
+// GetPreferences returns whether the user receives each configurable event
+// over each available channel
+func (s *Service) GetPreferences(ctx context.Context, userID int64) ([]Preference, error) {
+	stored, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	choices := make(map[[2]string]bool, len(stored))
+	for _, p := range stored {
+		choices[[2]string{p.Event, p.Channel}] = p.Enabled
+	}
+
+	preferences := []Preference{}
+	for _, event := range configurableEvents {
+		for _, channel := range channelNames {
+			if _, available := s.channels[channel]; !available {
+				continue
+			}
+
+			enabled, chosen := choices[[2]string{event, channel}]
+			if !chosen {
+				enabled = eventTypes[event].Defaults[channel]
+			}
+			preferences = append(preferences, Preference{Event: event, Channel: channel, Enabled: enabled})
+		}
+	}
+
+	return preferences, nil
 }
 
-// SendWelcome sends welcome email
-func (s *Service) SendWelcome(to, name string) error {
-	subject := "Welcome to E-Commerce"
-	body := generateWelcomeEmail(name)
-	return s.SendEmail(to, subject, body)
+// UpdatePreferences opts the user in or out of events per channel and
+// returns the resulting preferences
+func (s *Service) UpdatePreferences(ctx context.Context, userID int64, req *UpdatePreferencesRequest) ([]Preference, error) {
+	// Later entries for the same event and channel win
+	index := make(map[[2]string]int, len(req.Preferences))
+	preferences := make([]Preference, 0, len(req.Preferences))
+	for _, update := range req.Preferences {
+		eventType, ok := eventTypes[update.Event]
+		if !ok || eventType.Mandatory {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidPreference, update.Event)
+		}
+		if _, available := s.channels[update.Channel]; !available {
+			return nil, fmt.Errorf("%w: unknown channel %q", ErrInvalidPreference, update.Channel)
+		}
+
+		p := Preference{Event: update.Event, Channel: update.Channel, Enabled: *update.Enabled}
+		key := [2]string{p.Event, p.Channel}
+		if i, seen := index[key]; seen {
+			preferences[i] = p
+			continue
+		}
+		index[key] = len(preferences)
+		preferences = append(preferences, p)
+	}
+
+	if err := s.repo.SetPreferences(ctx, userID, preferences); err != nil {
+		return nil, err
+	}
+
+	return s.GetPreferences(ctx, userID)
 }
 
-// SendSMS sends an SMS notification (placeholder)
-func (s *Service) SendSMS(phone, message string) error {
-	logger.Info("Sending SMS",
-		"phone", phone,
-		"message", message,
-	)
+// PushPublicKey returns the VAPID public key browsers subscribe with
+func (s *Service) PushPublicKey() (string, error) {
+	if _, available := s.channels[ChannelPush]; !available || s.notificationConfig.VAPIDPublicKey == "" {
+		return "", ErrPushUnavailable
+	}
+	return s.notificationConfig.VAPIDPublicKey, nil
+}
 
-	// Placeholder for actual SMS sending implementation
-	// In production, use a service like Twilio
+// SubscribePush stores a browser's push subscription for the user
+func (s *Service) SubscribePush(ctx context.Context, userID int64, req *CreatePushSubscriptionRequest, userAgent string) (*PushSubscription, error) {
+	if _, available := s.channels[ChannelPush]; !available {
+		return nil, ErrPushUnavailable
+	}
 
-	return nil
+	if err := (&push.Subscription{Endpoint: req.Endpoint, P256dh: req.Keys.P256dh, Auth: req.Keys.Auth}).Validate(); err != nil {
+		return nil, err
+	}
+
+	sub := &PushSubscription{
+		UserID:    userID,
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: userAgent,
+	}
+	if err := s.repo.SavePushSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
 }
 
-// SendPushNotification sends a push notification (placeholder)
-func (s *Service) SendPushNotification(userID int64, title, message string) error {
-	logger.Info("Sending push notification",
-		"user_id", userID,
-		"title", title,
-		"message", message,
-	)
+// ListPushSubscriptions lists the browsers the user subscribed
+func (s *Service) ListPushSubscriptions(ctx context.Context, userID int64) ([]PushSubscription, error) {
+	return s.repo.ListPushSubscriptions(ctx, userID)
+}
 
-	// Placeholder for actual push notification implementation
-	// In production, use a service like Firebase Cloud Messaging
+// UnsubscribePush removes one of the user's push subscriptions
+func (s *Service) UnsubscribePush(ctx context.Context, userID, subscriptionID int64) error {
+	return s.repo.DeletePushSubscription(ctx, userID, subscriptionID)
+}
 
-	return nil
+// ProcessOutbox delivers up to batchSize queued messages and returns how
+// many were sent. Failed deliveries are retried with exponential backoff;
+// after the configured number of attempts, or when the channel reports the
+// message as undeliverable, a message is dead-lettered. Once ctx is
+// cancelled no further messages are sent; those left claimed are retried
+// when their lease expires.
+func (s *Service) ProcessOutbox(ctx context.Context, batchSize int) (int, error) {
+	messages, err := s.repo.Claim(ctx, batchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+
+	// Record the outcome of a delivery even if ctx is cancelled meanwhile,
+	// so that a sent message is not sent again
+	record := context.WithoutCancel(ctx)
+
+	sent := 0
+	for i := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		msg := &messages[i]
+
+		var sendErr error
+		if channel, ok := s.channels[msg.Channel]; ok {
+			sendErr = channel.Send(ctx, msg)
+		} else {
+			sendErr = fmt.Errorf("channel %q is not configured", msg.Channel)
+		}
+
+		if sendErr == nil {
+			if err := s.repo.MarkSent(record, msg.ID); err != nil {
+				logger.Error("Failed to mark notification sent", "notification_id", msg.ID, "error", err)
+			}
+			sent++
+			continue
+		}
+
+		if errors.Is(sendErr, ErrUndeliverable) || msg.Attempts >= s.emailConfig.MaxAttempts {
+			logger.Error("Notification dead-lettered", "notification_id", msg.ID, "channel", msg.Channel, "attempts", msg.Attempts, "error", sendErr)
+			if err := s.repo.MarkDead(record, msg.ID, sendErr.Error()); err != nil {
+				logger.Error("Failed to dead-letter notification", "notification_id", msg.ID, "error", err)
+			}
+			continue
+		}
+
+		next := time.Now().Add(RetryDelay(msg.Attempts))
+		logger.Info("Notification delivery failed, retrying", "notification_id", msg.ID, "channel", msg.Channel, "attempts", msg.Attempts, "next_attempt_at", next, "error", sendErr)
+		if err := s.repo.MarkFailed(record, msg.ID, sendErr.Error(), next); err != nil {
+			logger.Error("Failed to reschedule notification", "notification_id", msg.ID, "error", err)
+		}
+	}
+
+	return sent, nil
+}
+
+// ListTemplates lists the notification templates and their locales
+func (s *Service) ListTemplates() []TemplateInfo {
+	return s.renderer.Templates()
+}
+
+// PreviewTemplate renders a template with sample data
+func (s *Service) PreviewTemplate(name, locale string) (*Message, error) {
+	return s.renderer.Render(name, locale, s.renderer.SampleData(name))
+}
+
+// SendOrderConfirmation sends the order confirmation
+func (s *Service) SendOrderConfirmation(ctx context.Context, userID int64, orderNumber string, amount float64) error {
+	return s.Notify(ctx, userID, EventOrderPlaced, TemplateOrderConfirmation, map[string]interface{}{
+		"OrderNumber": orderNumber,
+		"Total":       amount,
+		"URL":         s.renderer.baseURL + "/orders/" + orderNumber,
+	})
+}
+
+// SendOrderShipped tells the user that their order is on its way
+func (s *Service) SendOrderShipped(ctx context.Context, userID int64, orderNumber string) error {
+	return s.Notify(ctx, userID, EventOrderShipped, TemplateOrderShipped, map[string]interface{}{
+		"OrderNumber": orderNumber,
+		"URL":         s.renderer.baseURL + "/orders/" + orderNumber,
+	})
+}
+
+// SendPasswordReset sends password reset email. resetURL carries the
+// single-use reset token; expiresIn is shown to the user.
+func (s *Service) SendPasswordReset(ctx context.Context, userID int64, resetURL string, expiresIn time.Duration) error {
+	return s.Notify(ctx, userID, EventAccount, TemplatePasswordReset, map[string]interface{}{
+		"URL":       resetURL,
+		"ExpiresIn": expiresIn,
+	})
+}
+
+// SendEmailVerification sends the link that verifies a user's email address
+func (s *Service) SendEmailVerification(ctx context.Context, userID int64, name, verifyURL string, expiresIn time.Duration) error {
+	return s.Notify(ctx, userID, EventAccount, TemplateEmailVerification, map[string]interface{}{
+		"Name":      name,
+		"URL":       verifyURL,
+		"ExpiresIn": expiresIn,
+	})
+}
+
+// SendWelcome sends welcome email
+func (s *Service) SendWelcome(ctx context.Context, userID int64, name string) error {
+	return s.Notify(ctx, userID, EventAccount, TemplateWelcome, map[string]interface{}{
+		"Name": name,
+	})
+}
+
+// RetryDelay returns how long to wait after the given number of failed
+// attempts
+func RetryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
 }
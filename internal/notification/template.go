@@ -1,51 +1,297 @@
 package notification
 
 import (
+	"bytes"
+	"embed"
+	"errors"
 	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Template names
+const (
+	TemplateWelcome           = "welcome"
+	TemplateEmailVerification = "email_verification"
+	TemplatePasswordReset     = "password_reset"
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplateOrderShipped      = "order_shipped"
 )
 
-// generateOrderConfirmationEmail generates order confirmation email body
-func generateOrderConfirmationEmail(orderNumber string, amount float64) string {
-	return fmt.Sprintf(`
-		<html>
-		<body>
-			<h2>Order Confirmation</h2>
-			<p>Thank you for your order!</p>
-			<p><strong>Order Number:</strong> %s</p>
-			<p><strong>Total Amount:</strong> $%.2f</p>
-			<p>We'll send you a shipping confirmation email as soon as your order ships.</p>
-		</body>
-		</html>
-	`, orderNumber, amount)
-}
-
-// generatePasswordResetEmail generates password reset email body
-func generatePasswordResetEmail(resetToken string) string {
-	return fmt.Sprintf(`
-		<html>
-		<body>
-			<h2>Password Reset Request</h2>
-			<p>You requested a password reset for your account.</p>
-			<p>Click the link below to reset your password:</p>
-			<a href="https://example.com/reset-password?token=%s">Reset Password</a>
-			<p>If you didn't request this, please ignore this email.</p>
-			<p>This link will expire in 24 hours.</p>
-		</body>
-		</html>
-	`, resetToken)
-}
-
-// generateWelcomeEmail generates welcome email body
-func generateWelcomeEmail(name string) string {
-	return fmt.Sprintf(`
-		<html>
-		<body>
-			<h2>Welcome to E-Commerce!</h2>
-			<p>Hi %s,</p>
-			<p>Thank you for signing up. We're excited to have you!</p>
-			<p>Start shopping now and enjoy exclusive deals.</p>
-			<a href="https://example.com/shop">Start Shopping</a>
-		</body>
-		</html>
-	`, name)
+// templateBlocks are the blocks every template file defines
+var templateBlocks = []string{"subject", "html", "text"}
+
+// ErrTemplateNotFound is returned for unknown template names
+var ErrTemplateNotFound = errors.New("notification template not found")
+
+//go:embed templates/*/*.tmpl
+var templateFiles embed.FS
+
+// Renderer renders the embedded notification templates. Each template is a
+// file templates/<locale>/<name>.tmpl defining a "subject", an "html" and a
+// "text" block. The html block is rendered with html/template and the other
+// two with text/template.
+type Renderer struct {
+	baseURL       string
+	defaultLocale string
+	currency      string
+	locales       map[string]*localeTemplates
+}
+
+// localeTemplates holds the parsed templates of one locale by name
+type localeTemplates struct {
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+// TemplateInfo lists the locales a template is available in
+type TemplateInfo struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+// NewRenderer parses the embedded templates. baseURL is the storefront URL
+// and currency the ISO 4217 code amounts are shown in unless the data
+// names another one. Every template must exist in defaultLocale, which is
+// used when the user's locale has no variant of a template.
+func NewRenderer(baseURL, defaultLocale, currencyCode string) (*Renderer, error) {
+	if _, err := currency.ParseISO(currencyCode); err != nil {
+		return nil, fmt.Errorf("invalid currency %q: %w", currencyCode, err)
+	}
+
+	r := &Renderer{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		defaultLocale: defaultLocale,
+		currency:      currencyCode,
+		locales:       make(map[string]*localeTemplates),
+	}
+
+	files, err := fs.Glob(templateFiles, "templates/*/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		locale := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		if err := r.parse(file, locale, name); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults, ok := r.locales[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("no notification templates for default locale %q", defaultLocale)
+	}
+	for locale, templates := range r.locales {
+		for name := range templates.text {
+			if _, ok := defaults.text[name]; !ok {
+				return nil, fmt.Errorf("template %s/%s has no %s variant", locale, name, defaultLocale)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// parse parses one template file with both template engines
+func (r *Renderer) parse(file, locale, name string) error {
+	content, err := templateFiles.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	funcs := templateFuncs(locale)
+
+	text, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(funcs)).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", file, err)
+	}
+	html, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs)).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", file, err)
+	}
+
+	for _, block := range templateBlocks {
+		if text.Lookup(block) == nil {
+			return fmt.Errorf("template %s does not define %q", file, block)
+		}
+	}
+
+	templates, ok := r.locales[locale]
+	if !ok {
+		templates = &localeTemplates{
+			html: make(map[string]*htmltemplate.Template),
+			text: make(map[string]*texttemplate.Template),
+		}
+		r.locales[locale] = templates
+	}
+	templates.html[name] = html
+	templates.text[name] = text
+
+	return nil
+}
+
+// Render renders a template in the best matching locale. data is passed to
+// the template together with BaseURL and, unless set, Currency.
+func (r *Renderer) Render(name, locale string, data map[string]interface{}) (*Message, error) {
+	locale = r.resolve(name, locale)
+	templates, ok := r.locales[locale]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	values := map[string]interface{}{
+		"BaseURL":  r.baseURL,
+		"Currency": r.currency,
+	}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := templates.text[name].ExecuteTemplate(&subject, "subject", values); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	if err := templates.html[name].ExecuteTemplate(&html, "html", values); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	if err := templates.text[name].ExecuteTemplate(&text, "text", values); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+
+	return &Message{
+		Locale:  locale,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()),
+	}, nil
+}
+
+// resolve picks the locale to render a template in: the exact locale, then
+// its base language ("bn" for "bn-BD"), then the default locale
+func (r *Renderer) resolve(name, locale string) string {
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-"); found {
+		candidates = append(candidates, base)
+	}
+
+	for _, candidate := range candidates {
+		if templates, ok := r.locales[strings.ToLower(candidate)]; ok {
+			if _, ok := templates.text[name]; ok {
+				return strings.ToLower(candidate)
+			}
+		}
+	}
+
+	if _, ok := r.locales[r.defaultLocale].text[name]; !ok {
+		return ""
+	}
+	return r.defaultLocale
+}
+
+// Templates lists the templates and their locales sorted by name
+func (r *Renderer) Templates() []TemplateInfo {
+	byName := make(map[string][]string)
+	for locale, templates := range r.locales {
+		for name := range templates.text {
+			byName[name] = append(byName[name], locale)
+		}
+	}
+
+	infos := make([]TemplateInfo, 0, len(byName))
+	for name, locales := range byName {
+		sort.Strings(locales)
+		infos = append(infos, TemplateInfo{Name: name, Locales: locales})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+// SampleData returns data to preview a template with
+func (r *Renderer) SampleData(name string) map[string]interface{} {
+	switch name {
+	case TemplateWelcome:
+		return map[string]interface{}{"Name": "Jane"}
+	case TemplateEmailVerification:
+		return map[string]interface{}{
+			"Name":      "Jane",
+			"URL":       r.baseURL + "/verify-email?token=sample",
+			"ExpiresIn": 24 * time.Hour,
+		}
+	case TemplatePasswordReset:
+		return map[string]interface{}{
+			"URL":       r.baseURL + "/reset-password?token=sample",
+			"ExpiresIn": time.Hour,
+		}
+	case TemplateOrderConfirmation:
+		return map[string]interface{}{
+			"OrderNumber": "ORD-20240101-0001",
+			"Total":       1234.5,
+			"URL":         r.baseURL + "/orders/ORD-20240101-0001",
+		}
+	case TemplateOrderShipped:
+		return map[string]interface{}{
+			"OrderNumber": "ORD-20240101-0001",
+			"URL":         r.baseURL + "/orders/ORD-20240101-0001",
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// durationUnits holds the singular and plural hour and minute units per
+// language
+var durationUnits = map[string][4]string{
+	"en": {"hour", "hours", "minute", "minutes"},
+	"bn": {"ঘণ্টা", "ঘণ্টা", "মিনিট", "মিনিট"},
+}
+
+// templateFuncs returns the template functions formatting for locale:
+//
+//	money    formats an amount in an ISO 4217 currency: {{money .Total .Currency}}
+//	duration formats a link lifetime such as "24 hours": {{duration .ExpiresIn}}
+func templateFuncs(locale string) map[string]interface{} {
+	tag := language.Make(locale)
+	printer := message.NewPrinter(tag)
+
+	base, _ := tag.Base()
+	units, ok := durationUnits[base.String()]
+	if !ok {
+		units = durationUnits["en"]
+	}
+
+	return map[string]interface{}{
+		"money": func(amount float64, code string) (string, error) {
+			unit, err := currency.ParseISO(code)
+			if err != nil {
+				return "", err
+			}
+			return printer.Sprint(currency.Symbol(unit.Amount(amount))), nil
+		},
+		"duration": func(d time.Duration) string {
+			if d >= time.Hour && d%time.Hour == 0 {
+				hours := int(d / time.Hour)
+				if hours == 1 {
+					return printer.Sprintf("%d %s", hours, units[0])
+				}
+				return printer.Sprintf("%d %s", hours, units[1])
+			}
+
+			minutes := int(d / time.Minute)
+			if minutes == 1 {
+				return printer.Sprintf("%d %s", minutes, units[2])
+			}
+			return printer.Sprintf("%d %s", minutes, units[3])
+		},
+	}
 }
@@ -2,11 +2,13 @@ package order
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"ecommerce_project/pkg/pagination"
 	"ecommerce_project/pkg/utils"
 )
 
@@ -22,28 +24,23 @@ func NewHandler(service *Service) *Handler {
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int64)
 
-	limit := 20
-	offset := 0
-
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
-		}
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil {
-			offset = parsed
-		}
+	orders, meta, err := h.service.List(r.Context(), userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	orders, err := h.service.List(userID, limit, offset)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Orders retrieved successfully", orders)
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Orders retrieved successfully", orders, meta)
 }
 
 // Create creates a new order
@@ -61,7 +58,11 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.service.Create(userID, &req)
+	order, err := h.service.Create(r.Context(), userID, &req)
+	if errors.Is(err, ErrCheckoutNotAllowed) {
+		utils.ErrorResponse(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -81,7 +82,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.service.GetByID(orderID, userID)
+	order, err := h.service.GetByID(r.Context(), orderID, userID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
 		return
@@ -101,10 +102,130 @@ func (h *Handler) Cancel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Cancel(orderID, userID); err != nil {
+	// The reason is optional, so an empty body is accepted
+	var req CancelOrderRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.Cancel(r.Context(), orderID, userID, req.Reason); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	utils.SuccessResponse(w, http.StatusOK, "Order cancelled successfully", nil)
 }
+
+// AdminList retrieves orders across all users (admin only)
+func (h *Handler) AdminList(w http.ResponseWriter, r *http.Request) {
+	filter := &OrderFilter{
+		Status: r.URL.Query().Get("status"),
+	}
+
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		if parsed, err := strconv.ParseInt(userID, 10, 64); err == nil {
+			filter.UserID = parsed
+		}
+	}
+
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, meta, err := h.service.ListAll(r.Context(), filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Orders retrieved successfully", orders, meta)
+}
+
+// Confirm confirms a pending order (admin only)
+func (h *Handler) Confirm(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, StatusConfirmed, "Order confirmed successfully")
+}
+
+// Ship marks a confirmed order as shipped (admin only)
+func (h *Handler) Ship(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, StatusShipped, "Order shipped successfully")
+}
+
+// Deliver marks a shipped order as delivered (admin only)
+func (h *Handler) Deliver(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, StatusDelivered, "Order delivered successfully")
+}
+
+// AdminCancel cancels any order (admin only). A reason is required.
+func (h *Handler) AdminCancel(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int64)
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	var req AdminCancelOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, err := h.service.AdminCancel(r.Context(), orderID, adminID, req.Reason)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Order cancelled successfully", order)
+}
+
+// transition applies an admin status change to the order in the URL
+func (h *Handler) transition(w http.ResponseWriter, r *http.Request, status, message string) {
+	adminID := r.Context().Value("user_id").(int64)
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	// The reason is optional, so an empty body is accepted
+	var req TransitionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	order, err := h.service.Transition(r.Context(), orderID, status, adminID, req.Reason)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, message, order)
+}
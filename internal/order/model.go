@@ -10,7 +10,7 @@ type Order struct {
 	UserID        int64       `json:"user_id" db:"user_id"`
 	OrderNumber   string      `json:"order_number" db:"order_number"`
 	Status        string      `json:"status" db:"status"` // pending, confirmed, shipped, delivered, cancelled
-	PaymentStatus string      `json:"payment_status" db:"payment_status"` // pending, paid, failed, refunded
+	PaymentStatus string      `json:"payment_status" db:"payment_status"` // pending, paid, failed, partially_refunded, refunded
 	Subtotal      float64     `json:"subtotal" db:"subtotal"`
 	Tax           float64     `json:"tax" db:"tax"`
 	ShippingCost  float64     `json:"shipping_cost" db:"shipping_cost"`
@@ -18,6 +18,7 @@ type Order struct {
 	ShippingAddress string    `json:"shipping_address" db:"shipping_address"`
 	BillingAddress  string    `json:"billing_address" db:"billing_address"`
 	Items         []OrderItem `json:"items"`
+	History       []StatusHistory `json:"history,omitempty"`
 	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time   `json:"updated_at" db:"updated_at"`
 }
@@ -27,12 +28,25 @@ type OrderItem struct {
 	ID        int64     `json:"id" db:"id"`
 	OrderID   int64     `json:"order_id" db:"order_id"`
 	ProductID int64     `json:"product_id" db:"product_id"`
+	VariantID int64     `json:"variant_id" db:"variant_id"`
 	Quantity  int       `json:"quantity" db:"quantity"`
 	Price     float64   `json:"price" db:"price"`
 	Subtotal  float64   `json:"subtotal" db:"subtotal"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// StatusHistory records a single order status transition
+type StatusHistory struct {
+	ID         int64     `json:"id" db:"id"`
+	OrderID    int64     `json:"order_id" db:"order_id"`
+	FromStatus string    `json:"from_status,omitempty" db:"from_status"`
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	ActorType  string    `json:"actor_type" db:"actor_type"` // customer, admin, system
+	ActorID    *int64    `json:"actor_id,omitempty" db:"actor_id"`
+	Reason     string    `json:"reason,omitempty" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
 // CreateOrderRequest represents creating an order
 type CreateOrderRequest struct {
 	ShippingAddressID int64  `json:"shipping_address_id" validate:"required"`
@@ -40,10 +54,23 @@ type CreateOrderRequest struct {
 	PaymentMethod     string `json:"payment_method" validate:"required"`
 }
 
+// CancelOrderRequest represents cancelling an order
+type CancelOrderRequest struct {
+	Reason string `json:"reason,omitempty" validate:"max=500"`
+}
+
+// AdminCancelOrderRequest represents an admin cancelling an order
+type AdminCancelOrderRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// TransitionRequest represents an admin status change
+type TransitionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
 // OrderFilter represents filtering options
 type OrderFilter struct {
 	UserID int64
 	Status string
-	Limit  int
-	Offset int
 }
@@ -1,28 +1,38 @@
 package order
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/pagination"
 )
 
 type Repository struct {
-	db *sql.DB
+	db db.DBTX
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
 // Create creates a new order
-func (r *Repository) Create(order *Order) error {
+func (r *Repository) Create(ctx context.Context, order *Order) error {
 	query := `
 		INSERT INTO orders (user_id, order_number, status, payment_status, subtotal, tax, shipping_cost, total, shipping_address, billing_address, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		order.UserID,
 		order.OrderNumber,
@@ -46,17 +56,19 @@ func (r *Repository) Create(order *Order) error {
 }
 
 // CreateItem creates an order item
-func (r *Repository) CreateItem(item *OrderItem) error {
+func (r *Repository) CreateItem(ctx context.Context, item *OrderItem) error {
 	query := `
-		INSERT INTO order_items (order_id, product_id, quantity, price, subtotal, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO order_items (order_id, product_id, variant_id, quantity, price, subtotal, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		item.OrderID,
 		item.ProductID,
+		item.VariantID,
 		item.Quantity,
 		item.Price,
 		item.Subtotal,
@@ -71,15 +83,25 @@ func (r *Repository) CreateItem(item *OrderItem) error {
 }
 
 // GetByID retrieves an order by ID
-func (r *Repository) GetByID(id int64) (*Order, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Order, error) {
+	return r.getByID(ctx, id, "")
+}
+
+// GetForUpdate retrieves an order and locks it until the end of the
+// transaction the repository is bound to
+func (r *Repository) GetForUpdate(ctx context.Context, id int64) (*Order, error) {
+	return r.getByID(ctx, id, " FOR UPDATE")
+}
+
+func (r *Repository) getByID(ctx context.Context, id int64, lock string) (*Order, error) {
 	query := `
 		SELECT id, user_id, order_number, status, payment_status, subtotal, tax, shipping_cost, total, shipping_address, billing_address, created_at, updated_at
 		FROM orders
 		WHERE id = $1
-	`
+	` + lock
 
 	order := &Order{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&order.ID,
 		&order.UserID,
 		&order.OrderNumber,
@@ -103,7 +125,7 @@ func (r *Repository) GetByID(id int64) (*Order, error) {
 	}
 
 	// Get order items
-	items, err := r.GetItems(order.ID)
+	items, err := r.GetItems(ctx, order.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -113,14 +135,14 @@ func (r *Repository) GetByID(id int64) (*Order, error) {
 }
 
 // GetItems retrieves all items for an order
-func (r *Repository) GetItems(orderID int64) ([]OrderItem, error) {
+func (r *Repository) GetItems(ctx context.Context, orderID int64) ([]OrderItem, error) {
 	query := `
-		SELECT id, order_id, product_id, quantity, price, subtotal, created_at
+		SELECT id, order_id, product_id, COALESCE(variant_id, 0), quantity, price, subtotal, created_at
 		FROM order_items
 		WHERE order_id = $1
 	`
 
-	rows, err := r.db.Query(query, orderID)
+	rows, err := r.db.QueryContext(ctx, query, orderID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order items: %w", err)
 	}
@@ -129,7 +151,7 @@ func (r *Repository) GetItems(orderID int64) ([]OrderItem, error) {
 	items := []OrderItem{}
 	for rows.Next() {
 		item := OrderItem{}
-		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.Subtotal, &item.CreatedAt)
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.VariantID, &item.Quantity, &item.Price, &item.Subtotal, &item.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order item: %w", err)
 		}
@@ -139,40 +161,46 @@ func (r *Repository) GetItems(orderID int64) ([]OrderItem, error) {
 	return items, nil
 }
 
-// List retrieves orders with filtering
-func (r *Repository) List(filter *OrderFilter) ([]*Order, error) {
-	query := `SELECT id, user_id, order_number, status, payment_status, subtotal, tax, shipping_cost, total, shipping_address, billing_address, created_at, updated_at FROM orders WHERE 1=1`
+// orderConditions returns the WHERE clause selecting the orders matching
+// filter and its arguments
+func orderConditions(filter *OrderFilter) (string, []interface{}) {
+	where := " WHERE 1=1"
 	args := []interface{}{}
-	argPosition := 1
 
 	if filter.UserID > 0 {
-		query += fmt.Sprintf(" AND user_id = $%d", argPosition)
 		args = append(args, filter.UserID)
-		argPosition++
+		where += fmt.Sprintf(" AND user_id = $%d", len(args))
 	}
 
 	if filter.Status != "" {
-		query += fmt.Sprintf(" AND status = $%d", argPosition)
 		args = append(args, filter.Status)
-		argPosition++
+		where += fmt.Sprintf(" AND status = $%d", len(args))
 	}
 
-	query += " ORDER BY created_at DESC"
+	return where, args
+}
+
+// List retrieves a page of orders matching filter, newest first, and the
+// cursor of the next page, which is nil on the last page
+func (r *Repository) List(ctx context.Context, filter *OrderFilter, page *pagination.Page) ([]*Order, *pagination.Cursor, error) {
+	where, args := orderConditions(filter)
+	query := `SELECT id, user_id, order_number, status, payment_status, subtotal, tax, shipping_cost, total, shipping_address, billing_address, created_at, updated_at FROM orders` + where
 
-	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argPosition)
-		args = append(args, filter.Limit)
-		argPosition++
+	if page.Cursor != nil {
+		after, err := page.Cursor.Time()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, after, page.Cursor.ID)
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
 	}
 
-	if filter.Offset > 0 {
-		query += fmt.Sprintf(" OFFSET $%d", argPosition)
-		args = append(args, filter.Offset)
-	}
+	args = append(args, page.FetchLimit(), page.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list orders: %w", err)
+		return nil, nil, fmt.Errorf("failed to list orders: %w", err)
 	}
 	defer rows.Close()
 
@@ -195,30 +223,154 @@ func (r *Repository) List(filter *OrderFilter) ([]*Order, error) {
 			&order.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan order: %w", err)
 		}
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list orders: %w", err)
+	}
 
-	return orders, nil
+	if !page.HasMore(len(orders)) {
+		return orders, nil, nil
+	}
+	orders = orders[:page.Limit]
+	last := orders[len(orders)-1]
+
+	return orders, pagination.TimeCursor(last.CreatedAt, last.ID), nil
 }
 
-// UpdateStatus updates an order's status
-func (r *Repository) UpdateStatus(orderID int64, status string) error {
-	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3`
-	_, err := r.db.Exec(query, status, time.Now(), orderID)
+// Count returns the number of orders matching filter
+func (r *Repository) Count(ctx context.Context, filter *OrderFilter) (int, error) {
+	where, args := orderConditions(filter)
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	return count, nil
+}
+
+// UpdateStatus moves an order from one status to another. It fails if the
+// order is no longer in the expected from status.
+func (r *Repository) UpdateStatus(ctx context.Context, orderID int64, from, to string) error {
+	query := `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4`
+	result, err := r.db.ExecContext(ctx, query, to, time.Now(), orderID, from)
 	if err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("order status was changed by another request")
+	}
+
 	return nil
 }
 
 // UpdatePaymentStatus updates an order's payment status
-func (r *Repository) UpdatePaymentStatus(orderID int64, status string) error {
+func (r *Repository) UpdatePaymentStatus(ctx context.Context, orderID int64, status string) error {
 	query := `UPDATE orders SET payment_status = $1, updated_at = $2 WHERE id = $3`
-	_, err := r.db.Exec(query, status, time.Now(), orderID)
+	_, err := r.db.ExecContext(ctx, query, status, time.Now(), orderID)
 	if err != nil {
 		return fmt.Errorf("failed to update payment status: %w", err)
 	}
 	return nil
 }
+
+// CancelUnpaid cancels an order that is still pending and unpaid, because
+// no payment was made or the last one failed, records the transition as a
+// system action and reports whether it did
+func (r *Repository) CancelUnpaid(ctx context.Context, orderID int64, reason string) (bool, error) {
+	query := `
+		WITH cancelled AS (
+			UPDATE orders
+			SET status = 'cancelled', updated_at = $1
+			WHERE id = $2 AND status = 'pending' AND payment_status IN ('pending', 'failed')
+			RETURNING id
+		)
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_id, reason, created_at)
+		SELECT id, 'pending', 'cancelled', 'system', NULL, $3, $1 FROM cancelled
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), orderID, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel unpaid order: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// AddStatusHistory records an order status transition
+func (r *Repository) AddStatusHistory(ctx context.Context, entry *StatusHistory) error {
+	query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_id, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		entry.OrderID,
+		entry.FromStatus,
+		entry.ToStatus,
+		entry.ActorType,
+		entry.ActorID,
+		entry.Reason,
+		time.Now(),
+	).Scan(&entry.ID, &entry.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to record status history: %w", err)
+	}
+
+	return nil
+}
+
+// GetStatusHistory retrieves the status timeline of an order, oldest first
+func (r *Repository) GetStatusHistory(ctx context.Context, orderID int64) ([]StatusHistory, error) {
+	query := `
+		SELECT id, order_id, from_status, to_status, actor_type, actor_id, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []StatusHistory{}
+	for rows.Next() {
+		entry := StatusHistory{}
+		err := rows.Scan(
+			&entry.ID,
+			&entry.OrderID,
+			&entry.FromStatus,
+			&entry.ToStatus,
+			&entry.ActorType,
+			&entry.ActorID,
+			&entry.Reason,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan status history: %w", err)
+		}
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
@@ -1,20 +1,43 @@
 package order
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/logger"
+	"ecommerce_project/pkg/pagination"
+	"ecommerce_project/pkg/utils"
 )
 
 type Service struct {
-	repo          *Repository
-	cartRepo      CartRepository
-	inventoryRepo InventoryRepository
+	db             *sql.DB
+	repo           *Repository
+	cartRepo       CartRepository
+	inventoryRepo  InventoryRepository
+	payments       PaymentService
+	checkout       CheckoutPolicy
+	notifier       Notifier
+	reservationTTL time.Duration
 }
 
+// ErrReservationExpired is returned when a payment is confirmed for an
+// order whose stock is no longer reserved
+var ErrReservationExpired = errors.New("stock reservation of the order has expired")
+
+// ErrCheckoutNotAllowed is returned when a user may not place orders
+var ErrCheckoutNotAllowed = errors.New("checkout not allowed")
+
+// CartRepository is the cart storage used during checkout. WithTx must
+// return a repository bound to the given transaction.
 type CartRepository interface {
-	GetOrCreate(userID int64) (*Cart, error)
-	GetItems(cartID int64) ([]CartItem, error)
-	Clear(cartID int64) error
+	GetOrCreate(ctx context.Context, userID int64) (*Cart, error)
+	GetItems(ctx context.Context, cartID int64) ([]CartItem, error)
+	Clear(ctx context.Context, cartID int64) error
+	WithTx(tx *sql.Tx) CartRepository
 }
 
 type Cart struct {
@@ -24,107 +47,175 @@ type Cart struct {
 
 type CartItem struct {
 	ProductID int64
+	VariantID int64
 	Quantity  int
 	Price     float64
 }
 
+// InventoryRepository is the stock storage used by orders, kept per
+// product variant. Stock is reserved while payment is pending, committed
+// once it is confirmed and released on cancellation. WithTx must return a
+// repository bound to the given transaction.
 type InventoryRepository interface {
-	CheckStock(productID int64, quantity int) (bool, error)
-	ReduceStock(productID int64, quantity int) error
+	CheckStock(ctx context.Context, variantID int64, quantity int) (bool, error)
+	Reserve(ctx context.Context, orderID, variantID int64, quantity int, expiresAt time.Time) error
+	CommitReservations(ctx context.Context, orderID int64) error
+	ReleaseReservations(ctx context.Context, orderID int64) error
+	RestockReservations(ctx context.Context, orderID int64) error
+	HasReservations(ctx context.Context, orderID int64) (bool, error)
+	LockActiveReservations(ctx context.Context, orderID int64) (bool, error)
+	ExpiredReservationOrders(ctx context.Context) ([]int64, error)
+	Restock(ctx context.Context, variantID int64, quantity int) error
+	WithTx(tx *sql.Tx) InventoryRepository
+}
+
+// PaymentService voids or starts a refund of an order's payment when the
+// order is cancelled
+type PaymentService interface {
+	CancelOrderPayment(ctx context.Context, orderID int64, reason string) error
+}
+
+// CheckoutPolicy decides whether a user may place orders. Rejections wrap
+// ErrCheckoutNotAllowed.
+type CheckoutPolicy interface {
+	CanCheckout(ctx context.Context, userID int64) error
+}
+
+// Notifier queues customer notifications about orders. WithTx must return
+// a notifier that queues inside the given transaction, so that a
+// notification is only sent if the change it announces is committed.
+type Notifier interface {
+	OrderPlaced(ctx context.Context, order *Order) error
+	OrderShipped(ctx context.Context, order *Order) error
+	WithTx(tx *sql.Tx) Notifier
 }
 
-func NewService(repo *Repository, cartRepo CartRepository, inventoryRepo InventoryRepository) *Service {
+func NewService(conn *sql.DB, repo *Repository, cartRepo CartRepository, inventoryRepo InventoryRepository, payments PaymentService, checkout CheckoutPolicy, notifier Notifier, reservationTTL time.Duration) *Service {
 	return &Service{
-		repo:          repo,
-		cartRepo:      cartRepo,
-		inventoryRepo: inventoryRepo,
+		db:             conn,
+		repo:           repo,
+		cartRepo:       cartRepo,
+		inventoryRepo:  inventoryRepo,
+		payments:       payments,
+		checkout:       checkout,
+		notifier:       notifier,
+		reservationTTL: reservationTTL,
 	}
 }
 
 // Create creates a new order from cart
-func (s *Service) Create(userID int64, req *CreateOrderRequest) (*Order, error) {
-	// Get cart
-	cart, err := s.cartRepo.GetOrCreate(userID)
-	if err != nil {
+func (s *Service) Create(ctx context.Context, userID int64, req *CreateOrderRequest) (*Order, error) {
+	if err := s.checkout.CanCheckout(ctx, userID); err != nil {
 		return nil, err
 	}
 
-	items, err := s.cartRepo.GetItems(cart.ID)
+	// Get cart
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(items) == 0 {
-		return nil, fmt.Errorf("cart is empty")
-	}
+	// Read the cart, persist the order and its items, reserve stock until
+	// payment is confirmed and clear the cart as a single unit of work
+	var order *Order
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+		cartRepo := s.cartRepo.WithTx(tx)
+		inventoryRepo := s.inventoryRepo.WithTx(tx)
 
-	// Check inventory
-	for _, item := range items {
-		hasStock, err := s.inventoryRepo.CheckStock(item.ProductID, item.Quantity)
-		if err != nil || !hasStock {
-			return nil, fmt.Errorf("insufficient stock for product %d", item.ProductID)
+		items, err := cartRepo.GetItems(ctx, cart.ID)
+		if err != nil {
+			return err
 		}
-	}
 
-	// Calculate totals
-	subtotal := 0.0
-	for _, item := range items {
-		subtotal += item.Price * float64(item.Quantity)
-	}
-	tax := subtotal * 0.1 // 10% tax
-	shippingCost := 10.0
-	total := subtotal + tax + shippingCost
+		if len(items) == 0 {
+			return fmt.Errorf("cart is empty")
+		}
 
-	// Create order
-	order := &Order{
-		UserID:          userID,
-		OrderNumber:     generateOrderNumber(),
-		Status:          "pending",
-		PaymentStatus:   "pending",
-		Subtotal:        subtotal,
-		Tax:             tax,
-		ShippingCost:    shippingCost,
-		Total:           total,
-		ShippingAddress: fmt.Sprintf("Address ID: %d", req.ShippingAddressID),
-		BillingAddress:  fmt.Sprintf("Address ID: %d", req.BillingAddressID),
-	}
+		// Check inventory
+		for _, item := range items {
+			hasStock, err := inventoryRepo.CheckStock(ctx, item.VariantID, item.Quantity)
+			if err != nil || !hasStock {
+				return fmt.Errorf("insufficient stock for product %d variant %d", item.ProductID, item.VariantID)
+			}
+		}
 
-	if err := s.repo.Create(order); err != nil {
-		return nil, err
-	}
+		// Calculate totals
+		subtotal := 0.0
+		for _, item := range items {
+			subtotal += item.Price * float64(item.Quantity)
+		}
+		tax := subtotal * 0.1 // 10% tax
+		shippingCost := 10.0
+		total := subtotal + tax + shippingCost
+
+		// Create order
+		order = &Order{
+			UserID:          userID,
+			OrderNumber:     generateOrderNumber(),
+			Status:          StatusPending,
+			PaymentStatus:   "pending",
+			Subtotal:        subtotal,
+			Tax:             tax,
+			ShippingCost:    shippingCost,
+			Total:           total,
+			ShippingAddress: fmt.Sprintf("Address ID: %d", req.ShippingAddressID),
+			BillingAddress:  fmt.Sprintf("Address ID: %d", req.BillingAddressID),
+		}
 
-	// Create order items and reduce inventory
-	for _, item := range items {
-		orderItem := &OrderItem{
+		if err := repo.Create(ctx, order); err != nil {
+			return err
+		}
+
+		if err := repo.AddStatusHistory(ctx, &StatusHistory{
 			OrderID:   order.ID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     item.Price,
-			Subtotal:  item.Price * float64(item.Quantity),
+			ToStatus:  StatusPending,
+			ActorType: ActorCustomer,
+			ActorID:   &userID,
+			Reason:    "order placed",
+		}); err != nil {
+			return err
 		}
 
-		if err := s.repo.CreateItem(orderItem); err != nil {
-			return nil, err
+		// Create order items and reserve inventory
+		expiresAt := time.Now().Add(s.reservationTTL)
+		for _, item := range items {
+			orderItem := &OrderItem{
+				OrderID:   order.ID,
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+				Price:     item.Price,
+				Subtotal:  item.Price * float64(item.Quantity),
+			}
+
+			if err := repo.CreateItem(ctx, orderItem); err != nil {
+				return err
+			}
+
+			if err := inventoryRepo.Reserve(ctx, order.ID, item.VariantID, item.Quantity, expiresAt); err != nil {
+				return fmt.Errorf("insufficient stock for product %d variant %d", item.ProductID, item.VariantID)
+			}
 		}
 
-		// Reduce inventory
-		if err := s.inventoryRepo.ReduceStock(item.ProductID, item.Quantity); err != nil {
-			return nil, err
+		// Clear cart
+		if err := cartRepo.Clear(ctx, cart.ID); err != nil {
+			return err
 		}
-	}
 
-	// Clear cart
-	if err := s.cartRepo.Clear(cart.ID); err != nil {
+		return s.notifier.WithTx(tx).OrderPlaced(ctx, order)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// Get full order with items
-	return s.repo.GetByID(order.ID)
+	return s.repo.GetByID(ctx, order.ID)
 }
 
 // GetByID retrieves an order by ID
-func (s *Service) GetByID(orderID, userID int64) (*Order, error) {
-	order, err := s.repo.GetByID(orderID)
+func (s *Service) GetByID(ctx context.Context, orderID, userID int64) (*Order, error) {
+	order, err := s.repo.GetByID(ctx, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -134,42 +225,270 @@ func (s *Service) GetByID(orderID, userID int64) (*Order, error) {
 		return nil, fmt.Errorf("order not found")
 	}
 
+	history, err := s.repo.GetStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	order.History = history
+
 	return order, nil
 }
 
-// List retrieves user's orders
-func (s *Service) List(userID int64, limit, offset int) ([]*Order, error) {
-	filter := &OrderFilter{
-		UserID: userID,
-		Limit:  limit,
-		Offset: offset,
+// List retrieves a page of the user's orders
+func (s *Service) List(ctx context.Context, userID int64, page *pagination.Page) ([]*Order, utils.Pagination, error) {
+	return s.list(ctx, &OrderFilter{UserID: userID}, page)
+}
+
+// Cancel cancels a customer's own order
+func (s *Service) Cancel(ctx context.Context, orderID, userID int64, reason string) error {
+	order, err := s.repo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
 	}
 
-	if filter.Limit == 0 {
-		filter.Limit = 20
+	// Verify ownership
+	if order.UserID != userID {
+		return fmt.Errorf("order not found")
 	}
 
-	return s.repo.List(filter)
+	if reason == "" {
+		reason = "cancelled by customer"
+	}
+
+	return s.cancel(ctx, order, ActorCustomer, userID, reason)
 }
 
-// Cancel cancels an order
-func (s *Service) Cancel(orderID, userID int64) error {
-	order, err := s.repo.GetByID(orderID)
+// AdminCancel cancels any order on behalf of an admin
+func (s *Service) AdminCancel(ctx context.Context, orderID, adminID int64, reason string) (*Order, error) {
+	order, err := s.repo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cancel(ctx, order, ActorAdmin, adminID, reason); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	order.History = history
+
+	return order, nil
+}
+
+// cancel moves an order to cancelled, returns its stock to inventory and
+// then voids or starts a refund of its payment
+func (s *Service) cancel(ctx context.Context, order *Order, actorType string, actorID int64, reason string) error {
+	err := db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.transition(ctx, s.repo.WithTx(tx), order, StatusCancelled, actorType, &actorID, reason); err != nil {
+			return err
+		}
+		return s.returnStock(ctx, s.inventoryRepo.WithTx(tx), order)
+	})
 	if err != nil {
 		return err
 	}
 
-	// Verify ownership
-	if order.UserID != userID {
-		return fmt.Errorf("order not found")
+	// The cancellation is already committed, so a gateway failure is logged
+	// for follow-up rather than reported to the caller
+	if err := s.payments.CancelOrderPayment(ctx, order.ID, reason); err != nil {
+		logger.Error("Failed to cancel payment for cancelled order", "order_id", order.ID, "error", err)
+	}
+
+	return nil
+}
+
+// ExpireReservations cancels the unpaid pending orders whose stock
+// reservations expired and releases their stock, one transaction per
+// order, and then cancels their open payments. It returns how many orders
+// it cancelled. An order paid in the meantime is left alone: the
+// cancellation locks the order like ConfirmPayment does.
+func (s *Service) ExpireReservations(ctx context.Context) (int, error) {
+	orderIDs, err := s.inventoryRepo.ExpiredReservationOrders(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	const reason = "stock reservation expired"
+
+	cancelledOrders := 0
+	for _, orderID := range orderIDs {
+		cancelled := false
+		err := db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+			var err error
+			cancelled, err = s.repo.WithTx(tx).CancelUnpaid(ctx, orderID, reason)
+			if err != nil || !cancelled {
+				return err
+			}
+			return s.inventoryRepo.WithTx(tx).ReleaseReservations(ctx, orderID)
+		})
+		if err != nil {
+			logger.Error("Failed to cancel expired order", "order_id", orderID, "error", err)
+			continue
+		}
+		if !cancelled {
+			continue
+		}
+		cancelledOrders++
+		logger.Info("Cancelled order with expired reservation", "order_id", orderID)
+
+		// As in cancel, the cancellation is already committed
+		if err := s.payments.CancelOrderPayment(ctx, orderID, reason); err != nil {
+			logger.Error("Failed to cancel payment for cancelled order", "order_id", orderID, "error", err)
+		}
+	}
+
+	return cancelledOrders, nil
+}
+
+// returnStock releases an order's active reservations and restocks what was
+// already taken out of inventory
+func (s *Service) returnStock(ctx context.Context, inventoryRepo InventoryRepository, order *Order) error {
+	hasReservations, err := inventoryRepo.HasReservations(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	if hasReservations {
+		if err := inventoryRepo.ReleaseReservations(ctx, order.ID); err != nil {
+			return err
+		}
+		return inventoryRepo.RestockReservations(ctx, order.ID)
+	}
+
+	// Orders placed before reservations existed reduced stock directly
+	for _, item := range order.Items {
+		if err := inventoryRepo.Restock(ctx, item.VariantID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListAll retrieves a page of orders across all users (admin only)
+func (s *Service) ListAll(ctx context.Context, filter *OrderFilter, page *pagination.Page) ([]*Order, utils.Pagination, error) {
+	return s.list(ctx, filter, page)
+}
+
+// list retrieves a page of orders matching filter with the total number of
+// matches
+func (s *Service) list(ctx context.Context, filter *OrderFilter, page *pagination.Page) ([]*Order, utils.Pagination, error) {
+	orders, next, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, utils.Pagination{}, err
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, utils.Pagination{}, err
+	}
+
+	return orders, page.Meta(total, next), nil
+}
+
+// Transition moves an order to a new status on behalf of an admin and
+// records the change in the order's history
+func (s *Service) Transition(ctx context.Context, orderID int64, to string, adminID int64, reason string) (*Order, error) {
+	order, err := s.repo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.transition(ctx, s.repo.WithTx(tx), order, to, ActorAdmin, &adminID, reason); err != nil {
+			return err
+		}
+		if to == StatusShipped {
+			return s.notifier.WithTx(tx).OrderShipped(ctx, order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	order.History = history
+
+	return order, nil
+}
+
+// transition validates and applies a status change and records it in the
+// history using repo, which is expected to be bound to a transaction
+func (s *Service) transition(ctx context.Context, repo *Repository, order *Order, to, actorType string, actorID *int64, reason string) error {
+	if err := ValidateTransition(order.Status, to); err != nil {
+		return err
 	}
 
-	// Check if order can be cancelled
-	if order.Status == "shipped" || order.Status == "delivered" || order.Status == "cancelled" {
-		return fmt.Errorf("order cannot be cancelled")
+	if err := repo.UpdateStatus(ctx, order.ID, order.Status, to); err != nil {
+		return err
 	}
 
-	return s.repo.UpdateStatus(orderID, "cancelled")
+	if err := repo.AddStatusHistory(ctx, &StatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		ActorType:  actorType,
+		ActorID:    actorID,
+		Reason:     reason,
+	}); err != nil {
+		return err
+	}
+
+	order.Status = to
+	return nil
+}
+
+// ConfirmPayment marks an order as paid and converts its stock reservations
+// into real decrements. The order is locked first, as the expiry sweep does,
+// so that a payment and an expiry of the same order never both succeed.
+func (s *Service) ConfirmPayment(ctx context.Context, orderID int64) error {
+	return db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		return s.ConfirmPaymentTx(ctx, tx, orderID)
+	})
+}
+
+// ConfirmPaymentTx confirms the payment of an order inside tx, so that the
+// caller can commit it together with its own record of the payment
+func (s *Service) ConfirmPaymentTx(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	repo := s.repo.WithTx(tx)
+	inventoryRepo := s.inventoryRepo.WithTx(tx)
+
+	order, err := repo.GetForUpdate(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status == StatusCancelled {
+		return fmt.Errorf("order %d is cancelled", orderID)
+	}
+	if order.PaymentStatus == "paid" {
+		return nil
+	}
+
+	reserved, err := inventoryRepo.HasReservations(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		active, err := inventoryRepo.LockActiveReservations(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return fmt.Errorf("%w: order %d", ErrReservationExpired, orderID)
+		}
+	}
+
+	if err := repo.UpdatePaymentStatus(ctx, orderID, "paid"); err != nil {
+		return err
+	}
+	return inventoryRepo.CommitReservations(ctx, orderID)
 }
 
 func generateOrderNumber() string {
@@ -0,0 +1,52 @@
+package order
+
+import (
+	"fmt"
+)
+
+// Order lifecycle statuses
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusShipped   = "shipped"
+	StatusDelivered = "delivered"
+	StatusCancelled = "cancelled"
+)
+
+// Actor types recorded in the status history
+const (
+	ActorCustomer = "customer"
+	ActorAdmin    = "admin"
+	ActorSystem   = "system"
+)
+
+// transitions lists the statuses each status may move to. Delivered and
+// cancelled orders are final.
+var transitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {},
+	StatusCancelled: {},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns an error if the transition is not allowed
+func ValidateTransition(from, to string) error {
+	if _, ok := transitions[to]; !ok {
+		return fmt.Errorf("unknown order status: %s", to)
+	}
+	if !CanTransition(from, to) {
+		return fmt.Errorf("order cannot move from %s to %s", from, to)
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package payment
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	gateway "ecommerce_project/pkg/payment"
 	"ecommerce_project/pkg/utils"
 )
 
@@ -33,7 +36,11 @@ func (h *Handler) CreatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payment, err := h.service.CreatePayment(userID, &req)
+	payment, err := h.service.CreatePayment(r.Context(), userID, &req)
+	if errors.Is(err, ErrPaymentInProgress) {
+		utils.ErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -53,7 +60,7 @@ func (h *Handler) GetPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payment, err := h.service.GetPayment(paymentID, userID)
+	payment, err := h.service.GetPayment(r.Context(), paymentID, userID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
 		return
@@ -62,32 +69,120 @@ func (h *Handler) GetPayment(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "Payment retrieved successfully", payment)
 }
 
-// StripeWebhook handles Stripe webhooks
-func (h *Handler) StripeWebhook(w http.ResponseWriter, r *http.Request) {
-	var payload PaymentWebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid webhook payload")
+// CreateRefund refunds part or all of a payment (admin only)
+func (h *Handler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("user_id").(int64)
+
+	vars := mux.Vars(r)
+	paymentID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid payment ID")
 		return
 	}
 
-	if err := h.service.ProcessWebhook("stripe", &payload); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	var req CreateRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"success"}`))
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	refund, err := h.service.CreateRefund(r.Context(), paymentID, adminID, &req)
+	if errors.Is(err, ErrNotFound) {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Refund created successfully", refund)
 }
 
-// BkashWebhook handles bKash webhooks
+// ListRefunds lists the refunds of a payment (admin only)
+func (h *Handler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	paymentID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+
+	refunds, err := h.service.ListRefunds(r.Context(), paymentID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Refunds retrieved successfully", refunds)
+}
+
+// BkashCallback completes a bKash checkout. bKash redirects the customer
+// here with the paymentID and the checkout status.
+func (h *Handler) BkashCallback(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.URL.Query().Get("paymentID")
+	status := r.URL.Query().Get("status")
+	if paymentID == "" || status == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "paymentID and status are required")
+		return
+	}
+
+	payment, err := h.service.HandleBkashCallback(r.Context(), paymentID, status)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if payment.Status != "completed" {
+		utils.ErrorResponse(w, http.StatusPaymentRequired, "Payment was not completed")
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Payment completed", payment)
+}
+
+// maxWebhookBodyBytes limits the size of webhook payloads
+const maxWebhookBodyBytes = 64 << 10
+
+// StripeWebhook handles Stripe webhooks. The Stripe-Signature header must
+// match the raw body.
+func (h *Handler) StripeWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid webhook payload")
+		return
+	}
+
+	err = h.service.ProcessStripeWebhook(r.Context(), payload, r.Header.Get("Stripe-Signature"))
+	h.webhookResponse(w, err)
+}
+
+// BkashWebhook handles bKash webhooks, which are Amazon SNS messages signed
+// by SNS
 func (h *Handler) BkashWebhook(w http.ResponseWriter, r *http.Request) {
-	var payload PaymentWebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid webhook payload")
 		return
 	}
 
-	if err := h.service.ProcessWebhook("bkash", &payload); err != nil {
+	err = h.service.ProcessBkashWebhook(r.Context(), payload)
+	h.webhookResponse(w, err)
+}
+
+// webhookResponse acknowledges a processed webhook. Processing errors return
+// a 5xx status so that the gateway redelivers the event.
+func (h *Handler) webhookResponse(w http.ResponseWriter, err error) {
+	if errors.Is(err, gateway.ErrInvalidSignature) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid webhook signature")
+		return
+	}
+	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
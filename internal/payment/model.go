@@ -6,31 +6,84 @@ import (
 
 // Payment represents a payment transaction
 type Payment struct {
+	ID               int64     `json:"id" db:"id"`
+	OrderID          int64     `json:"order_id" db:"order_id"`
+	UserID           int64     `json:"user_id" db:"user_id"`
+	Amount           float64   `json:"amount" db:"amount"`
+	Currency         string    `json:"currency" db:"currency"`
+	PaymentMethod    string    `json:"payment_method" db:"payment_method"` // stripe, bkash
+	TransactionID    string    `json:"transaction_id,omitempty" db:"transaction_id"`
+	GatewayReference string    `json:"gateway_reference,omitempty" db:"gateway_reference"` // bKash trxID once executed
+	Status           string    `json:"status" db:"status"`                                 // pending, completed, failed, cancelled, refund_pending, partially_refunded, refunded
+	PaymentGateway   string    `json:"payment_gateway,omitempty" db:"payment_gateway"`
+	GatewayResponse  string    `json:"gateway_response,omitempty" db:"gateway_response"`
+	ClientSecret     string    `json:"client_secret,omitempty" db:"-"` // Stripe only, never stored
+	RedirectURL      string    `json:"redirect_url,omitempty" db:"-"`  // bKash only, never stored
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+
+	// refundReason is set when a completed payment could not be applied to
+	// its order and must be refunded once the transaction commits
+	refundReason string
+}
+
+// CreatePaymentRequest represents creating a payment
+type CreatePaymentRequest struct {
+	OrderID       int64  `json:"order_id" validate:"required"`
+	PaymentMethod string `json:"payment_method" validate:"required"`
+}
+
+// Refund is a full or partial refund of a payment
+type Refund struct {
 	ID              int64     `json:"id" db:"id"`
-	OrderID         int64     `json:"order_id" db:"order_id"`
-	UserID          int64     `json:"user_id" db:"user_id"`
+	PaymentID       int64     `json:"payment_id" db:"payment_id"`
 	Amount          float64   `json:"amount" db:"amount"`
 	Currency        string    `json:"currency" db:"currency"`
-	PaymentMethod   string    `json:"payment_method" db:"payment_method"` // stripe, bkash
-	TransactionID   string    `json:"transaction_id,omitempty" db:"transaction_id"`
-	Status          string    `json:"status" db:"status"` // pending, completed, failed, refunded
-	PaymentGateway  string    `json:"payment_gateway,omitempty" db:"payment_gateway"`
+	Reason          string    `json:"reason,omitempty" db:"reason"`
+	Status          string    `json:"status" db:"status"` // pending, completed, failed
+	GatewayRefundID string    `json:"gateway_refund_id,omitempty" db:"gateway_refund_id"`
 	GatewayResponse string    `json:"gateway_response,omitempty" db:"gateway_response"`
+	CreatedBy       *int64    `json:"created_by,omitempty" db:"created_by"` // nil for refunds started by an order cancellation
 	CreatedAt       time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// CreatePaymentRequest represents creating a payment
-type CreatePaymentRequest struct {
-	OrderID       int64  `json:"order_id" validate:"required"`
-	PaymentMethod string `json:"payment_method" validate:"required"`
-	Currency      string `json:"currency,omitempty"`
+// CreateRefundRequest represents refunding a payment. Leaving the amount
+// out refunds everything that has not been refunded yet.
+type CreateRefundRequest struct {
+	Amount float64 `json:"amount,omitempty" validate:"omitempty,gt=0"`
+	Reason string  `json:"reason" validate:"required,max=500"`
+}
+
+// PaymentEvent is a webhook event received from a payment gateway. Events
+// are stored so that redelivered events are only processed once.
+type PaymentEvent struct {
+	ID          int64      `json:"id" db:"id"`
+	Gateway     string     `json:"gateway" db:"gateway"`
+	EventID     string     `json:"event_id" db:"event_id"`
+	EventType   string     `json:"event_type" db:"event_type"`
+	PaymentID   *int64     `json:"payment_id,omitempty" db:"payment_id"`
+	Payload     string     `json:"payload" db:"payload"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// BkashWebhookPayload is the body of a bKash payment notification
+type BkashWebhookPayload struct {
+	PaymentID             string `json:"paymentID"`
+	TrxID                 string `json:"trxID"`
+	TransactionStatus     string `json:"transactionStatus"` // Completed, Failed, Cancelled
+	Amount                string `json:"amount"`
+	Currency              string `json:"currency"`
+	MerchantInvoiceNumber string `json:"merchantInvoiceNumber"`
 }
 
-// PaymentWebhookPayload represents payment webhook payload
-type PaymentWebhookPayload struct {
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"`
-	Amount        float64 `json:"amount"`
-	OrderID       int64   `json:"order_id"`
+// Order is the order information the payment service needs
+type Order struct {
+	ID            int64
+	UserID        int64
+	OrderNumber   string
+	Total         float64
+	Status        string
+	PaymentStatus string
 }
@@ -1,28 +1,41 @@
 package payment
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/db"
 )
 
+// ErrNotFound is returned when a payment does not exist
+var ErrNotFound = errors.New("payment not found")
+
 type Repository struct {
-	db *sql.DB
+	db db.DBTX
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
 // Create creates a new payment record
-func (r *Repository) Create(payment *Payment) error {
+func (r *Repository) Create(ctx context.Context, payment *Payment) error {
 	query := `
-		INSERT INTO payments (order_id, user_id, amount, currency, payment_method, transaction_id, status, payment_gateway, gateway_response, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO payments (order_id, user_id, amount, currency, payment_method, transaction_id, gateway_reference, status, payment_gateway, gateway_response, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		payment.OrderID,
 		payment.UserID,
@@ -30,6 +43,7 @@ func (r *Repository) Create(payment *Payment) error {
 		payment.Currency,
 		payment.PaymentMethod,
 		payment.TransactionID,
+		payment.GatewayReference,
 		payment.Status,
 		payment.PaymentGateway,
 		payment.GatewayResponse,
@@ -45,15 +59,52 @@ func (r *Repository) Create(payment *Payment) error {
 }
 
 // GetByID retrieves a payment by ID
-func (r *Repository) GetByID(id int64) (*Payment, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Payment, error) {
+	query := `
+		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, gateway_reference, status, payment_gateway, gateway_response, created_at, updated_at
+		FROM payments
+		WHERE id = $1
+	`
+
+	payment := &Payment{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&payment.ID,
+		&payment.OrderID,
+		&payment.UserID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.PaymentMethod,
+		&payment.TransactionID,
+		&payment.GatewayReference,
+		&payment.Status,
+		&payment.PaymentGateway,
+		&payment.GatewayResponse,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// GetByIDForUpdate retrieves a payment by ID and locks its row until the
+// surrounding transaction ends
+func (r *Repository) GetByIDForUpdate(ctx context.Context, id int64) (*Payment, error) {
 	query := `
-		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, status, payment_gateway, gateway_response, created_at, updated_at
+		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, gateway_reference, status, payment_gateway, gateway_response, created_at, updated_at
 		FROM payments
 		WHERE id = $1
+		FOR UPDATE
 	`
 
 	payment := &Payment{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&payment.ID,
 		&payment.OrderID,
 		&payment.UserID,
@@ -61,6 +112,7 @@ func (r *Repository) GetByID(id int64) (*Payment, error) {
 		&payment.Currency,
 		&payment.PaymentMethod,
 		&payment.TransactionID,
+		&payment.GatewayReference,
 		&payment.Status,
 		&payment.PaymentGateway,
 		&payment.GatewayResponse,
@@ -69,7 +121,7 @@ func (r *Repository) GetByID(id int64) (*Payment, error) {
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("payment not found")
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payment: %w", err)
@@ -78,18 +130,76 @@ func (r *Repository) GetByID(id int64) (*Payment, error) {
 	return payment, nil
 }
 
-// GetByOrderID retrieves a payment by order ID
-func (r *Repository) GetByOrderID(orderID int64) (*Payment, error) {
+// ListByOrderID retrieves the payments of an order, newest first
+func (r *Repository) ListByOrderID(ctx context.Context, orderID int64) ([]*Payment, error) {
 	query := `
-		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, status, payment_gateway, gateway_response, created_at, updated_at
+		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, gateway_reference, status, payment_gateway, gateway_response, created_at, updated_at
 		FROM payments
 		WHERE order_id = $1
-		ORDER BY created_at DESC
-		LIMIT 1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	defer rows.Close()
+
+	payments := []*Payment{}
+	for rows.Next() {
+		payment := &Payment{}
+		err := rows.Scan(
+			&payment.ID,
+			&payment.OrderID,
+			&payment.UserID,
+			&payment.Amount,
+			&payment.Currency,
+			&payment.PaymentMethod,
+			&payment.TransactionID,
+			&payment.GatewayReference,
+			&payment.Status,
+			&payment.PaymentGateway,
+			&payment.GatewayResponse,
+			&payment.CreatedAt,
+			&payment.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		payments = append(payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+
+	return payments, nil
+}
+
+// LockOrder locks the order a payment is for until the end of the
+// transaction, so that only one payment of an order is started at a time
+func (r *Repository) LockOrder(ctx context.Context, orderID int64) error {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("order not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	return nil
+}
+
+// GetByTransactionID retrieves a payment by the gateway's transaction ID
+func (r *Repository) GetByTransactionID(ctx context.Context, gateway, transactionID string) (*Payment, error) {
+	query := `
+		SELECT id, order_id, user_id, amount, currency, payment_method, transaction_id, gateway_reference, status, payment_gateway, gateway_response, created_at, updated_at
+		FROM payments
+		WHERE payment_gateway = $1 AND transaction_id = $2
 	`
 
 	payment := &Payment{}
-	err := r.db.QueryRow(query, orderID).Scan(
+	err := r.db.QueryRowContext(ctx, query, gateway, transactionID).Scan(
 		&payment.ID,
 		&payment.OrderID,
 		&payment.UserID,
@@ -97,6 +207,7 @@ func (r *Repository) GetByOrderID(orderID int64) (*Payment, error) {
 		&payment.Currency,
 		&payment.PaymentMethod,
 		&payment.TransactionID,
+		&payment.GatewayReference,
 		&payment.Status,
 		&payment.PaymentGateway,
 		&payment.GatewayResponse,
@@ -105,7 +216,7 @@ func (r *Repository) GetByOrderID(orderID int64) (*Payment, error) {
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("payment not found")
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payment: %w", err)
@@ -114,18 +225,187 @@ func (r *Repository) GetByOrderID(orderID int64) (*Payment, error) {
 	return payment, nil
 }
 
+// UpdateGatewayReference stores the settlement reference returned by the
+// gateway once a payment completes
+func (r *Repository) UpdateGatewayReference(ctx context.Context, id int64, reference string) error {
+	query := `UPDATE payments SET gateway_reference = $1, updated_at = $2 WHERE id = $3`
+
+	_, err := r.db.ExecContext(ctx, query, reference, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update gateway reference: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateStatus updates a payment's status
-func (r *Repository) UpdateStatus(id int64, status, transactionID, gatewayResponse string) error {
+func (r *Repository) UpdateStatus(ctx context.Context, id int64, status, transactionID, gatewayResponse string) error {
 	query := `
 		UPDATE payments
 		SET status = $1, transaction_id = $2, gateway_response = $3, updated_at = $4
 		WHERE id = $5
 	`
 
-	_, err := r.db.Exec(query, status, transactionID, gatewayResponse, time.Now(), id)
+	_, err := r.db.ExecContext(ctx, query, status, transactionID, gatewayResponse, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to update payment status: %w", err)
 	}
 
 	return nil
 }
+
+// RecordEvent stores a webhook event and reports whether it was already
+// processed. Redelivered events keep their original row.
+func (r *Repository) RecordEvent(ctx context.Context, event *PaymentEvent) (bool, error) {
+	query := `
+		INSERT INTO payment_events (gateway, event_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (gateway, event_id) DO UPDATE SET event_type = EXCLUDED.event_type
+		RETURNING id, processed_at, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		event.Gateway,
+		event.EventID,
+		event.EventType,
+		event.Payload,
+		time.Now(),
+	).Scan(&event.ID, &event.ProcessedAt, &event.CreatedAt)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to record payment event: %w", err)
+	}
+
+	return event.ProcessedAt != nil, nil
+}
+
+// ClaimEvent locks a recorded webhook event for the rest of the transaction
+// and reports whether it still has to be processed
+func (r *Repository) ClaimEvent(ctx context.Context, eventID int64) (bool, error) {
+	query := `SELECT processed_at FROM payment_events WHERE id = $1 FOR UPDATE`
+
+	var processedAt *time.Time
+	if err := r.db.QueryRowContext(ctx, query, eventID).Scan(&processedAt); err != nil {
+		return false, fmt.Errorf("failed to claim payment event: %w", err)
+	}
+
+	return processedAt == nil, nil
+}
+
+// MarkEventProcessed marks a webhook event as processed and links it to the
+// payment it applied to
+func (r *Repository) MarkEventProcessed(ctx context.Context, eventID int64, paymentID *int64) error {
+	query := `UPDATE payment_events SET payment_id = $1, processed_at = $2 WHERE id = $3`
+
+	_, err := r.db.ExecContext(ctx, query, paymentID, time.Now(), eventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark payment event processed: %w", err)
+	}
+
+	return nil
+}
+
+// CreateRefund creates a new refund record
+func (r *Repository) CreateRefund(ctx context.Context, refund *Refund) error {
+	query := `
+		INSERT INTO refunds (payment_id, amount, currency, reason, status, gateway_refund_id, gateway_response, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		refund.PaymentID,
+		refund.Amount,
+		refund.Currency,
+		refund.Reason,
+		refund.Status,
+		refund.GatewayRefundID,
+		refund.GatewayResponse,
+		refund.CreatedBy,
+		time.Now(),
+		time.Now(),
+	).Scan(&refund.ID, &refund.CreatedAt, &refund.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateRefund records the gateway's answer for a refund
+func (r *Repository) UpdateRefund(ctx context.Context, id int64, status, gatewayRefundID, gatewayResponse string) error {
+	query := `
+		UPDATE refunds
+		SET status = $1, gateway_refund_id = $2, gateway_response = $3, updated_at = $4
+		WHERE id = $5
+	`
+
+	_, err := r.db.ExecContext(ctx, query, status, gatewayRefundID, gatewayResponse, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefunds retrieves the refunds of a payment, oldest first
+func (r *Repository) GetRefunds(ctx context.Context, paymentID int64) ([]Refund, error) {
+	query := `
+		SELECT id, payment_id, amount, currency, reason, status, gateway_refund_id, gateway_response, created_by, created_at, updated_at
+		FROM refunds
+		WHERE payment_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		var refund Refund
+		err := rows.Scan(
+			&refund.ID,
+			&refund.PaymentID,
+			&refund.Amount,
+			&refund.Currency,
+			&refund.Reason,
+			&refund.Status,
+			&refund.GatewayRefundID,
+			&refund.GatewayResponse,
+			&refund.CreatedBy,
+			&refund.CreatedAt,
+			&refund.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+// RefundedAmount returns the amount of a payment that is refunded or being
+// refunded
+func (r *Repository) RefundedAmount(ctx context.Context, paymentID int64) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM refunds
+		WHERE payment_id = $1 AND status IN ('pending', 'completed')
+	`
+
+	var amount float64
+	if err := r.db.QueryRowContext(ctx, query, paymentID).Scan(&amount); err != nil {
+		return 0, fmt.Errorf("failed to get refunded amount: %w", err)
+	}
+
+	return amount, nil
+}
@@ -1,74 +1,197 @@
 package payment
 
 import (
-	"ecommerce_project/internal/config"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/stripe/stripe-go/v76"
+
+	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/logger"
+	gateway "ecommerce_project/pkg/payment"
 )
 
 type Service struct {
-	repo   *Repository
-	config *config.PaymentConfig
+	db       *sql.DB
+	repo     *Repository
+	config   *config.PaymentConfig
+	currency string
+	orders   OrderService
+	stripe   StripeGateway
+	bkash    BkashGateway
+	sns      NotificationVerifier
+}
+
+// ErrPaymentInProgress is returned when a payment is started for an order
+// that already has a pending payment which cannot be resumed
+var ErrPaymentInProgress = errors.New("a payment for this order is already in progress")
+
+// ErrReservationExpired is returned by OrderService.ConfirmPayment when the
+// stock reserved for the order expired before its payment completed
+var ErrReservationExpired = errors.New("stock reservation of the order has expired")
+
+// OrderService looks up the order being paid and is notified when its
+// payment completes or fails. WithTx must return a service that reads and
+// updates orders inside tx.
+type OrderService interface {
+	GetOrder(ctx context.Context, orderID int64) (*Order, error)
+	ConfirmPayment(ctx context.Context, orderID int64) error
+	UpdatePaymentStatus(ctx context.Context, orderID int64, status string) error
+	WithTx(tx *sql.Tx) OrderService
+}
+
+// StripeGateway is the part of the Stripe API used by the payment service.
+// It is implemented by pkg/payment.StripeClient.
+type StripeGateway interface {
+	CreatePaymentIntent(amount int64, currency string, metadata map[string]string) (*stripe.PaymentIntent, error)
+	GetPaymentIntent(id string) (*stripe.PaymentIntent, error)
+	CancelPaymentIntent(id string) (*stripe.PaymentIntent, error)
+	CreateRefund(paymentIntentID string, amount int64, metadata map[string]string) (*stripe.Refund, error)
+}
+
+// BkashGateway is the part of the bKash tokenized checkout API used by the
+// payment service. It is implemented by pkg/payment.BkashClient.
+type BkashGateway interface {
+	CreatePayment(amount float64, invoiceNumber, callbackURL string) (*gateway.BkashCreateResponse, error)
+	ExecutePayment(paymentID string) (*gateway.BkashExecuteResponse, error)
+	RefundPayment(paymentID, trxID string, amount float64, reason string) (*gateway.BkashRefundResponse, error)
+}
+
+// NotificationVerifier authenticates the Amazon SNS messages bKash delivers
+// its webhooks as. It is implemented by pkg/payment.SNSVerifier.
+type NotificationVerifier interface {
+	Verify(msg *gateway.SNSMessage) error
+	ConfirmSubscription(msg *gateway.SNSMessage) error
 }
 
-func NewService(repo *Repository, config *config.PaymentConfig) *Service {
+// NewService creates a payment service charging orders in currency, the
+// ISO 4217 code prices are in
+func NewService(db *sql.DB, repo *Repository, config *config.PaymentConfig, currency string, orders OrderService, stripe StripeGateway, bkash BkashGateway, sns NotificationVerifier) *Service {
 	return &Service{
-		repo:   repo,
-		config: config,
+		db:       db,
+		repo:     repo,
+		config:   config,
+		currency: strings.ToUpper(currency),
+		orders:   orders,
+		stripe:   stripe,
+		bkash:    bkash,
+		sns:      sns,
 	}
 }
 
-// CreatePayment creates a new payment
-func (s *Service) CreatePayment(userID int64, req *CreatePaymentRequest) (*Payment, error) {
+// CreatePayment creates a new payment for one of the user's orders. An
+// order has at most one pending payment: a pending Stripe payment is
+// returned again so that the customer can finish it, and any other pending
+// payment has to complete, fail or be cancelled first.
+func (s *Service) CreatePayment(ctx context.Context, userID int64, req *CreatePaymentRequest) (*Payment, error) {
 	// Validate payment method
 	if req.PaymentMethod != "stripe" && req.PaymentMethod != "bkash" {
 		return nil, fmt.Errorf("invalid payment method")
 	}
 
-	currency := req.Currency
-	if currency == "" {
-		currency = "USD"
+	order, err := s.orders.GetOrder(ctx, req.OrderID)
+	if err != nil || order.UserID != userID {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	if order.Status == "cancelled" {
+		return nil, fmt.Errorf("order is cancelled")
+	}
+	if order.PaymentStatus == "paid" {
+		return nil, fmt.Errorf("order is already paid")
 	}
 
 	payment := &Payment{
-		OrderID:       req.OrderID,
-		UserID:        userID,
-		Amount:        0, // This should be fetched from order
-		Currency:      currency,
-		PaymentMethod: req.PaymentMethod,
-		Status:        "pending",
+		OrderID:        order.ID,
+		UserID:         userID,
+		Amount:         order.Total,
+		Currency:       s.currency,
+		PaymentMethod:  req.PaymentMethod,
+		PaymentGateway: req.PaymentMethod,
+		Status:         "pending",
 	}
 
-	// Process payment with gateway
-	var transactionID string
-	var err error
+	// Record the payment under the order lock before calling the gateway,
+	// so that concurrent requests cannot open several payments the
+	// customer could all pay
+	var pending *Payment
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+		if err := repo.LockOrder(ctx, order.ID); err != nil {
+			return err
+		}
+
+		payments, err := repo.ListByOrderID(ctx, order.ID)
+		if err != nil {
+			return err
+		}
+		for _, existing := range payments {
+			if existing.Status == "pending" {
+				pending = existing
+				return nil
+			}
+		}
+
+		return repo.Create(ctx, payment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return s.resumePayment(pending, req.PaymentMethod)
+	}
 
+	// Process payment with gateway
 	switch req.PaymentMethod {
 	case "stripe":
-		transactionID, err = s.processStripePayment(payment)
+		err = s.processStripePayment(payment)
 	case "bkash":
-		transactionID, err = s.processBkashPayment(payment)
-	default:
-		return nil, fmt.Errorf("unsupported payment method")
+		err = s.processBkashPayment(payment, order)
 	}
 
 	if err != nil {
 		payment.Status = "failed"
 		payment.GatewayResponse = err.Error()
-	} else {
-		payment.TransactionID = transactionID
-		payment.Status = "completed"
 	}
 
-	if err := s.repo.Create(payment); err != nil {
+	// The gateway may already hold a payment; record it even if the client
+	// has gone away
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.repo.UpdateStatus(ctx, payment.ID, payment.Status, payment.TransactionID, payment.GatewayResponse); err != nil {
 		return nil, err
 	}
 
 	return payment, nil
 }
 
+// resumePayment returns a pending Stripe payment with a fresh client secret
+// so that the customer can complete it. Other pending payments cannot be
+// resumed.
+func (s *Service) resumePayment(payment *Payment, method string) (*Payment, error) {
+	if payment.PaymentMethod != "stripe" || method != "stripe" || payment.TransactionID == "" {
+		return nil, ErrPaymentInProgress
+	}
+
+	pi, err := s.stripe.GetPaymentIntent(payment.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.ClientSecret = pi.ClientSecret
+	return payment, nil
+}
+
 // GetPayment retrieves a payment
-func (s *Service) GetPayment(paymentID, userID int64) (*Payment, error) {
-	payment, err := s.repo.GetByID(paymentID)
+func (s *Service) GetPayment(ctx context.Context, paymentID, userID int64) (*Payment, error) {
+	payment, err := s.repo.GetByID(ctx, paymentID)
 	if err != nil {
 		return nil, err
 	}
@@ -81,34 +204,576 @@ func (s *Service) GetPayment(paymentID, userID int64) (*Payment, error) {
 	return payment, nil
 }
 
-// ProcessWebhook processes payment webhook
-func (s *Service) ProcessWebhook(gateway string, payload *PaymentWebhookPayload) error {
-	payment, err := s.repo.GetByOrderID(payload.OrderID)
+// CancelOrderPayment is called when an order is cancelled. Every pending
+// payment of the order is voided and a completed one is refunded in full.
+func (s *Service) CancelOrderPayment(ctx context.Context, orderID int64, reason string) error {
+	payments, err := s.repo.ListByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		switch payment.Status {
+		case "pending":
+			if payment.PaymentMethod == "stripe" && payment.TransactionID != "" {
+				if _, err := s.stripe.CancelPaymentIntent(payment.TransactionID); err != nil {
+					return err
+				}
+			}
+			if err := s.repo.UpdateStatus(context.WithoutCancel(ctx), payment.ID, "cancelled", payment.TransactionID, reason); err != nil {
+				return err
+			}
+		case "completed", "refund_pending":
+			if _, err := s.refund(ctx, payment.ID, nil, &CreateRefundRequest{Reason: reason}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateRefund refunds part or all of a completed payment (admin only). The
+// refund is recorded before the gateway is called so that concurrent
+// refunds cannot exceed the amount paid.
+func (s *Service) CreateRefund(ctx context.Context, paymentID, adminID int64, req *CreateRefundRequest) (*Refund, error) {
+	return s.refund(ctx, paymentID, &adminID, req)
+}
+
+// refund records a refund of a payment and sends it to the gateway. The
+// creator is nil for refunds the system starts itself.
+func (s *Service) refund(ctx context.Context, paymentID int64, createdBy *int64, req *CreateRefundRequest) (*Refund, error) {
+	var payment *Payment
+	var refund *Refund
+
+	err := db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+
+		var err error
+		payment, err = repo.GetByIDForUpdate(ctx, paymentID)
+		if err != nil {
+			return err
+		}
+
+		switch payment.Status {
+		case "completed", "partially_refunded", "refund_pending":
+		default:
+			return fmt.Errorf("payment with status %s cannot be refunded", payment.Status)
+		}
+
+		refunded, err := repo.RefundedAmount(ctx, payment.ID)
+		if err != nil {
+			return err
+		}
+
+		remaining := toMinorUnits(payment.Amount) - toMinorUnits(refunded)
+		if remaining <= 0 {
+			return fmt.Errorf("payment is already fully refunded")
+		}
+
+		amount := toMinorUnits(req.Amount)
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount > remaining {
+			return fmt.Errorf("refund amount exceeds the refundable amount of %.2f", float64(remaining)/100)
+		}
+
+		refund = &Refund{
+			PaymentID: payment.ID,
+			Amount:    float64(amount) / 100,
+			Currency:  payment.Currency,
+			Reason:    req.Reason,
+			Status:    "pending",
+			CreatedBy: createdBy,
+		}
+		return repo.CreateRefund(ctx, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refundID, response, err := s.refundWithGateway(payment, refund)
+
+	// Record the gateway's answer even if the admin's request is cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	if err != nil {
+		if updateErr := s.repo.UpdateRefund(ctx, refund.ID, "failed", "", err.Error()); updateErr != nil {
+			logger.Error("Failed to record failed refund", "refund_id", refund.ID, "error", updateErr)
+		}
+		return nil, fmt.Errorf("refund failed: %w", err)
+	}
+
+	var status string
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+
+		if err := repo.UpdateRefund(ctx, refund.ID, "completed", refundID, response); err != nil {
+			return err
+		}
+
+		locked, err := repo.GetByIDForUpdate(ctx, payment.ID)
+		if err != nil {
+			return err
+		}
+		refunded, err := repo.RefundedAmount(ctx, locked.ID)
+		if err != nil {
+			return err
+		}
+
+		status = "partially_refunded"
+		if toMinorUnits(refunded) >= toMinorUnits(locked.Amount) {
+			status = "refunded"
+		}
+		return repo.UpdateStatus(ctx, locked.ID, status, locked.TransactionID, locked.GatewayResponse)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.orders.UpdatePaymentStatus(ctx, payment.OrderID, status); err != nil {
+		return nil, err
+	}
+
+	refund.Status = "completed"
+	refund.GatewayRefundID = refundID
+	refund.GatewayResponse = response
+	return refund, nil
+}
+
+// ListRefunds retrieves the refunds of a payment (admin only)
+func (s *Service) ListRefunds(ctx context.Context, paymentID int64) ([]Refund, error) {
+	if _, err := s.repo.GetByID(ctx, paymentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetRefunds(ctx, paymentID)
+}
+
+// refundWithGateway sends a refund to the gateway that took the payment and
+// returns the gateway's refund ID and status
+func (s *Service) refundWithGateway(payment *Payment, refund *Refund) (string, string, error) {
+	switch payment.PaymentGateway {
+	case "stripe":
+		metadata := map[string]string{
+			"payment_id": strconv.FormatInt(payment.ID, 10),
+			"refund_id":  strconv.FormatInt(refund.ID, 10),
+		}
+
+		result, err := s.stripe.CreateRefund(payment.TransactionID, toMinorUnits(refund.Amount), metadata)
+		if err != nil {
+			return "", "", err
+		}
+
+		// Pending refunds are settled by Stripe asynchronously and
+		// practically never fail, so they count as refunded
+		switch result.Status {
+		case stripe.RefundStatusSucceeded, stripe.RefundStatusPending:
+			return result.ID, string(result.Status), nil
+		default:
+			return "", "", fmt.Errorf("stripe refund %s is %s", result.ID, result.Status)
+		}
+	case "bkash":
+		if payment.GatewayReference == "" {
+			return "", "", fmt.Errorf("bkash payment has no transaction reference")
+		}
+
+		result, err := s.bkash.RefundPayment(payment.TransactionID, payment.GatewayReference, refund.Amount, refund.Reason)
+		if err != nil {
+			return "", "", err
+		}
+		return result.RefundTrxID, result.TransactionStatus, nil
+	default:
+		return "", "", fmt.Errorf("unsupported payment gateway: %s", payment.PaymentGateway)
+	}
+}
+
+// ProcessStripeWebhook verifies and applies a Stripe webhook event
+func (s *Service) ProcessStripeWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := gateway.ConstructStripeEvent(payload, signature, s.config.StripeWebhookSecret)
+	if err != nil {
+		return err
+	}
+
+	record := &PaymentEvent{
+		Gateway:   "stripe",
+		EventID:   event.ID,
+		EventType: string(event.Type),
+		Payload:   string(payload),
+	}
+
+	return s.processEvent(ctx, record, func(tx *sql.Tx) (*Payment, error) {
+		return s.applyStripeEvent(ctx, tx, event)
+	})
+}
+
+// ProcessBkashWebhook verifies and applies a bKash payment notification.
+// bKash publishes notifications to an Amazon SNS topic, so the payload is an
+// SNS message that must be signed by SNS and come from the configured
+// topic. The subscription of the endpoint to the topic is confirmed here.
+func (s *Service) ProcessBkashWebhook(ctx context.Context, payload []byte) error {
+	if s.config.BkashWebhookTopicARN == "" {
+		return fmt.Errorf("bkash webhook topic not configured")
+	}
+
+	msg, err := gateway.ParseSNSMessage(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", gateway.ErrInvalidSignature, err)
+	}
+	if err := s.sns.Verify(msg); err != nil {
+		return err
+	}
+	if msg.TopicArn != s.config.BkashWebhookTopicARN {
+		return fmt.Errorf("%w: unexpected SNS topic %s", gateway.ErrInvalidSignature, msg.TopicArn)
+	}
+
+	switch msg.Type {
+	case gateway.SNSSubscriptionConfirmation:
+		logger.Info("Confirming bKash webhook subscription", "topic", msg.TopicArn)
+		return s.sns.ConfirmSubscription(msg)
+	case gateway.SNSNotification:
+	default:
+		return nil
+	}
+
+	var notification BkashWebhookPayload
+	if err := json.Unmarshal([]byte(msg.Message), &notification); err != nil {
+		return fmt.Errorf("invalid bkash webhook payload: %w", err)
+	}
+	if notification.PaymentID == "" {
+		return fmt.Errorf("invalid bkash webhook payload: missing paymentID")
+	}
+
+	// SNS keeps the message ID when it redelivers a message
+	record := &PaymentEvent{
+		Gateway:   "bkash",
+		EventID:   msg.MessageID,
+		EventType: notification.TransactionStatus,
+		Payload:   msg.Message,
+	}
+
+	return s.processEvent(ctx, record, func(tx *sql.Tx) (*Payment, error) {
+		return s.applyBkashEvent(ctx, tx, &notification)
+	})
+}
+
+// processEvent records a webhook event and applies it unless it was already
+// processed. The event is applied in the transaction that claims it, so
+// concurrent deliveries of the same event are applied once and an event
+// that fails to apply stays unprocessed for the gateway's redelivery to
+// retry. Payments that must be refunded are refunded after the commit.
+func (s *Service) processEvent(ctx context.Context, event *PaymentEvent, apply func(tx *sql.Tx) (*Payment, error)) error {
+	processed, err := s.repo.RecordEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if processed {
+		logger.Info("Ignoring redelivered payment event", "gateway", event.Gateway, "event_id", event.EventID)
+		return nil
+	}
+
+	var payment *Payment
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+
+		claimed, err := repo.ClaimEvent(ctx, event.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			logger.Info("Ignoring redelivered payment event", "gateway", event.Gateway, "event_id", event.EventID)
+			return nil
+		}
+
+		payment, err = apply(tx)
+		if err != nil {
+			return err
+		}
+
+		var paymentID *int64
+		if payment != nil {
+			paymentID = &payment.ID
+		}
+
+		return repo.MarkEventProcessed(ctx, event.ID, paymentID)
+	})
 	if err != nil {
 		return err
 	}
 
-	return s.repo.UpdateStatus(payment.ID, payload.Status, payload.TransactionID, "Webhook processed")
+	if payment != nil && payment.refundReason != "" {
+		s.refundUnapplied(ctx, payment)
+	}
+	return nil
 }
 
-func (s *Service) processStripePayment(payment *Payment) (string, error) {
-	// Integration with Stripe
-	// This is a placeholder implementation
+// applyStripeEvent updates the payment a PaymentIntent event refers to.
+// Events for other objects or unknown intents are recorded but ignored.
+func (s *Service) applyStripeEvent(ctx context.Context, tx *sql.Tx, event stripe.Event) (*Payment, error) {
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+	default:
+		return nil, nil
+	}
+
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+		return nil, fmt.Errorf("failed to decode payment intent: %w", err)
+	}
+
+	payment, err := s.repo.WithTx(tx).GetByTransactionID(ctx, "stripe", pi.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case "payment_intent.succeeded":
+		if pi.Amount != toMinorUnits(payment.Amount) {
+			return nil, fmt.Errorf("payment intent %s amount %d does not match payment %d", pi.ID, pi.Amount, payment.ID)
+		}
+		if !strings.EqualFold(string(pi.Currency), payment.Currency) {
+			return nil, fmt.Errorf("payment intent %s currency %s does not match payment %d", pi.ID, pi.Currency, payment.ID)
+		}
+		// A failed attempt may be retried on the same intent
+		if payment.Status == "pending" || payment.Status == "failed" {
+			return payment, s.completePayment(ctx, tx, payment, "", string(pi.Status))
+		}
+	case "payment_intent.payment_failed":
+		if payment.Status == "pending" {
+			reason := string(pi.Status)
+			if pi.LastPaymentError != nil && pi.LastPaymentError.Msg != "" {
+				reason = pi.LastPaymentError.Msg
+			}
+			return payment, s.failPayment(ctx, tx, payment, reason)
+		}
+	case "payment_intent.canceled":
+		if payment.Status == "pending" || payment.Status == "failed" {
+			return payment, s.closePayment(ctx, tx, payment, "cancelled", "payment intent canceled")
+		}
+	}
+
+	return payment, nil
+}
+
+// applyBkashEvent updates the payment a bKash notification refers to
+func (s *Service) applyBkashEvent(ctx context.Context, tx *sql.Tx, notification *BkashWebhookPayload) (*Payment, error) {
+	payment, err := s.repo.WithTx(tx).GetByTransactionID(ctx, "bkash", notification.PaymentID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch notification.TransactionStatus {
+	case "Completed":
+		amount, err := strconv.ParseFloat(notification.Amount, 64)
+		if err != nil || toMinorUnits(amount) != toMinorUnits(payment.Amount) {
+			return nil, fmt.Errorf("bkash payment %s amount %s does not match payment %d", notification.PaymentID, notification.Amount, payment.ID)
+		}
+		if payment.Status == "pending" || payment.Status == "failed" {
+			return payment, s.completePayment(ctx, tx, payment, notification.TrxID, notification.TransactionStatus)
+		}
+	case "Failed", "Expired":
+		if payment.Status == "pending" {
+			return payment, s.failPayment(ctx, tx, payment, "bKash payment "+strings.ToLower(notification.TransactionStatus))
+		}
+	case "Cancelled":
+		if payment.Status == "pending" {
+			return payment, s.closePayment(ctx, tx, payment, "cancelled", "bKash payment cancelled")
+		}
+	}
+
+	return payment, nil
+}
+
+// processStripePayment creates a PaymentIntent for the payment. The payment
+// stays pending until Stripe reports the intent as succeeded; the client
+// secret is returned so the frontend can complete the payment.
+func (s *Service) processStripePayment(payment *Payment) error {
 	if s.config.StripeSecretKey == "" {
-		return "", fmt.Errorf("stripe not configured")
+		return fmt.Errorf("stripe not configured")
 	}
 
-	// Simulate successful payment
-	return fmt.Sprintf("stripe_txn_%d", payment.OrderID), nil
+	metadata := map[string]string{
+		"order_id": strconv.FormatInt(payment.OrderID, 10),
+		"user_id":  strconv.FormatInt(payment.UserID, 10),
+	}
+
+	pi, err := s.stripe.CreatePaymentIntent(toMinorUnits(payment.Amount), strings.ToLower(payment.Currency), metadata)
+	if err != nil {
+		return err
+	}
+
+	payment.TransactionID = pi.ID
+	payment.ClientSecret = pi.ClientSecret
+	payment.GatewayResponse = string(pi.Status)
+	return nil
 }
 
-func (s *Service) processBkashPayment(payment *Payment) (string, error) {
-	// Integration with bKash
-	// This is a placeholder implementation
+// processBkashPayment creates a bKash checkout for the payment. The payment
+// stays pending until the customer returns through the callback URL and the
+// payment is executed.
+func (s *Service) processBkashPayment(payment *Payment, order *Order) error {
 	if s.config.BkashAppKey == "" {
-		return "", fmt.Errorf("bkash not configured")
+		return fmt.Errorf("bkash not configured")
+	}
+	if s.config.BkashCallbackURL == "" {
+		return fmt.Errorf("bkash callback URL not configured")
+	}
+
+	// bKash only settles in BDT
+	if payment.Currency != "BDT" {
+		return fmt.Errorf("bkash only accepts payments in BDT")
+	}
+
+	result, err := s.bkash.CreatePayment(payment.Amount, order.OrderNumber, s.config.BkashCallbackURL)
+	if err != nil {
+		return err
+	}
+
+	payment.TransactionID = result.PaymentID
+	payment.RedirectURL = result.BkashURL
+	payment.GatewayResponse = result.TransactionStatus
+	return nil
+}
+
+// HandleBkashCallback completes a bKash checkout after the customer is
+// redirected back from bKash. The payment is only marked completed if
+// executing it with bKash succeeds, whatever status the redirect carries.
+func (s *Service) HandleBkashCallback(ctx context.Context, paymentID, status string) (*Payment, error) {
+	payment, err := s.repo.GetByTransactionID(ctx, "bkash", paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The customer may reload the callback page
+	if payment.Status != "pending" {
+		return payment, nil
+	}
+
+	if status != "success" {
+		// status is "failure" or "cancel"
+		err := db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+			return s.failPayment(ctx, tx, payment, "bKash checkout "+status)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return payment, nil
+	}
+
+	result, err := s.bkash.ExecutePayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// bKash has settled the payment; record it even if the customer closes
+	// the page
+	ctx = context.WithoutCancel(ctx)
+
+	err = db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		if !result.Completed() {
+			return s.failPayment(ctx, tx, payment, result.StatusMessage)
+		}
+		return s.completePayment(ctx, tx, payment, result.TrxID, result.StatusMessage)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.refundReason != "" {
+		s.refundUnapplied(ctx, payment)
+	}
+	return payment, nil
+}
+
+// completePayment marks a payment completed and the order paid inside tx.
+// If the order was cancelled in the meantime, or the stock reserved for it
+// expired, the payment is held for a refund instead.
+func (s *Service) completePayment(ctx context.Context, tx *sql.Tx, payment *Payment, reference, response string) error {
+	repo := s.repo.WithTx(tx)
+	orders := s.orders.WithTx(tx)
+
+	if reference != "" {
+		if err := repo.UpdateGatewayReference(ctx, payment.ID, reference); err != nil {
+			return err
+		}
+		payment.GatewayReference = reference
+	}
+
+	order, err := orders.GetOrder(ctx, payment.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.Status == "cancelled" {
+		return s.holdForRefund(ctx, repo, payment, "order cancelled before payment completed")
 	}
 
-	// Simulate successful payment
-	return fmt.Sprintf("bkash_txn_%d", payment.OrderID), nil
+	err = orders.ConfirmPayment(ctx, payment.OrderID)
+	if errors.Is(err, ErrReservationExpired) {
+		return s.holdForRefund(ctx, repo, payment, "stock reservation expired before payment completed")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := repo.UpdateStatus(ctx, payment.ID, "completed", payment.TransactionID, response); err != nil {
+		return err
+	}
+
+	payment.Status = "completed"
+	payment.GatewayResponse = response
+	return nil
+}
+
+// holdForRefund marks a payment that cannot be applied to its order as
+// refund_pending. The caller refunds it with refundUnapplied once its
+// transaction has committed.
+func (s *Service) holdForRefund(ctx context.Context, repo *Repository, payment *Payment, reason string) error {
+	if err := repo.UpdateStatus(ctx, payment.ID, "refund_pending", payment.TransactionID, reason); err != nil {
+		return err
+	}
+
+	payment.Status = "refund_pending"
+	payment.GatewayResponse = reason
+	payment.refundReason = reason
+	return nil
+}
+
+// refundUnapplied refunds a payment held by holdForRefund. The payment stays
+// refund_pending for an admin to retry if the gateway rejects the refund.
+func (s *Service) refundUnapplied(ctx context.Context, payment *Payment) {
+	if _, err := s.refund(ctx, payment.ID, nil, &CreateRefundRequest{Reason: payment.refundReason}); err != nil {
+		logger.Error("Failed to refund payment that could not be applied to its order", "payment_id", payment.ID, "order_id", payment.OrderID, "error", err)
+	}
+}
+
+// failPayment marks a payment and its order's payment status as failed
+func (s *Service) failPayment(ctx context.Context, tx *sql.Tx, payment *Payment, reason string) error {
+	return s.closePayment(ctx, tx, payment, "failed", reason)
+}
+
+// closePayment ends a payment that did not complete with the given status
+// and marks its order's payment status as failed, both inside tx
+func (s *Service) closePayment(ctx context.Context, tx *sql.Tx, payment *Payment, status, reason string) error {
+	if err := s.repo.WithTx(tx).UpdateStatus(ctx, payment.ID, status, payment.TransactionID, reason); err != nil {
+		return err
+	}
+	if err := s.orders.WithTx(tx).UpdatePaymentStatus(ctx, payment.OrderID, "failed"); err != nil {
+		return err
+	}
+
+	payment.Status = status
+	payment.GatewayResponse = reason
+	return nil
+}
+
+// toMinorUnits converts an amount to the smallest currency unit
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
 }
@@ -2,14 +2,22 @@ package product
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"ecommerce_project/pkg/media"
+	"ecommerce_project/pkg/pagination"
 	"ecommerce_project/pkg/utils"
 )
 
+// multipartOverhead allows for the form fields and boundaries of an image
+// upload on top of the image itself
+const multipartOverhead = 1 << 20
+
 type Handler struct {
 	service *Service
 }
@@ -47,25 +55,23 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if limit := r.URL.Query().Get("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil {
-			filter.Limit = l
-		}
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if offset := r.URL.Query().Get("offset"); offset != "" {
-		if o, err := strconv.Atoi(offset); err == nil {
-			filter.Offset = o
-		}
+	products, meta, err := h.service.List(r.Context(), filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	products, err := h.service.List(filter)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Products retrieved successfully", products)
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Products retrieved successfully", products, meta)
 }
 
 // GetByID retrieves a product by ID
@@ -77,7 +83,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.service.GetByID(id)
+	product, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
 		return
@@ -99,7 +105,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.service.Create(&req)
+	product, err := h.service.Create(r.Context(), &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -123,7 +129,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.service.Update(id, &req)
+	product, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -141,7 +147,7 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(id); err != nil {
+	if err := h.service.Delete(r.Context(), id); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -149,34 +155,304 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "Product deleted successfully", nil)
 }
 
+// CreateOption adds an option to a product (admin only)
+func (h *Handler) CreateOption(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	var req CreateOptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	option, err := h.service.CreateOption(r.Context(), id, &req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Option created successfully", option)
+}
+
+// CreateVariant adds a variant to a product (admin only)
+func (h *Handler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	var req CreateVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	variant, err := h.service.CreateVariant(r.Context(), id, &req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Variant created successfully", variant)
+}
+
+// UpdateVariant updates a variant of a product (admin only)
+func (h *Handler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, ok := variantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	variant, err := h.service.UpdateVariant(r.Context(), productID, variantID, &req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Variant updated successfully", variant)
+}
+
+// DeleteVariant deactivates a variant of a product (admin only)
+func (h *Handler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, ok := variantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteVariant(r.Context(), productID, variantID); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Variant deleted successfully", nil)
+}
+
+// UploadImage adds an image to a product from a multipart form with an
+// image file and optional alt_text and position fields (admin only)
+func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	maxBytes := h.service.MaxImageBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, media.ErrTooLarge.Error())
+			return
+		}
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	req := AddImageRequest{AltText: r.FormValue("alt_text")}
+	if position := r.FormValue("position"); position != "" {
+		value, err := strconv.Atoi(position)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid position")
+			return
+		}
+		req.Position = &value
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Image file is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Failed to read image file")
+		return
+	}
+
+	image, err := h.service.AddImage(r.Context(), id, data, &req)
+	switch {
+	case errors.Is(err, media.ErrTooLarge):
+		utils.ErrorResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.Is(err, media.ErrUnsupportedType):
+		utils.ErrorResponse(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case err != nil:
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusCreated, "Image uploaded successfully", image)
+}
+
+// UpdateImage changes the alt text or position of a product image (admin
+// only)
+func (h *Handler) UpdateImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	image, err := h.service.UpdateImage(r.Context(), productID, imageID, &req)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Image updated successfully", image)
+}
+
+// DeleteImage deletes a product image and its files (admin only)
+func (h *Handler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imageIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteImage(r.Context(), productID, imageID); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Image deleted successfully", nil)
+}
+
+// imageIDs parses the product and image IDs of an image route and reports
+// whether both are valid
+func imageIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid product ID")
+		return 0, 0, false
+	}
+
+	imageID, err := strconv.ParseInt(vars["image_id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid image ID")
+		return 0, 0, false
+	}
+
+	return productID, imageID, true
+}
+
+// variantIDs parses the product and variant IDs of a variant route and
+// reports whether both are valid
+func variantIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid product ID")
+		return 0, 0, false
+	}
+
+	variantID, err := strconv.ParseInt(vars["variant_id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid variant ID")
+		return 0, 0, false
+	}
+
+	return productID, variantID, true
+}
+
 // Search searches for products
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
-	searchTerm := r.URL.Query().Get("q")
-	if searchTerm == "" {
+	params := r.URL.Query()
+	query := &SearchQuery{Text: params.Get("q")}
+	if query.Text == "" {
 		utils.ErrorResponse(w, http.StatusBadRequest, "Search term is required")
 		return
 	}
 
-	limit := 20
-	offset := 0
+	if categoryID := params.Get("category_id"); categoryID != "" {
+		if id, err := strconv.ParseInt(categoryID, 10, 64); err == nil {
+			query.CategoryID = id
+		}
+	}
 
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
+	if minPrice := params.Get("min_price"); minPrice != "" {
+		if price, err := strconv.ParseFloat(minPrice, 64); err == nil {
+			query.MinPrice = price
 		}
 	}
 
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil {
-			offset = parsed
+	if maxPrice := params.Get("max_price"); maxPrice != "" {
+		if price, err := strconv.ParseFloat(maxPrice, 64); err == nil {
+			query.MaxPrice = price
+		}
+	}
+
+	if minRating := params.Get("min_rating"); minRating != "" {
+		if rating, err := strconv.ParseFloat(minRating, 64); err == nil {
+			query.MinRating = rating
 		}
 	}
 
-	products, err := h.service.Search(searchTerm, limit, offset)
+	// Hits are ranked by relevance, which a cursor cannot seek to
+	page, err := pagination.Parse(params, pagination.DefaultLimit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if page.Cursor != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Search results are paged with offset")
+		return
+	}
+	query.Limit, query.Offset = page.Limit, page.Offset
+
+	result, err := h.service.Search(r.Context(), query)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Search results", products)
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Search results", result, page.OffsetMeta(result.Total, len(result.Hits)))
 }
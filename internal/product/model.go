@@ -17,10 +17,71 @@ type Product struct {
 	IsActive    bool      `json:"is_active" db:"is_active"`
 	IsFeatured  bool      `json:"is_featured" db:"is_featured"`
 	ImageURL    string    `json:"image_url,omitempty" db:"image_url"`
+	Options     []OptionType `json:"options,omitempty"`
+	Variants    []Variant    `json:"variants,omitempty"`
+	Images      []Image      `json:"images,omitempty"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// OptionType is an option a product is sold in, such as size or color
+type OptionType struct {
+	ID        int64         `json:"id" db:"id"`
+	ProductID int64         `json:"product_id" db:"product_id"`
+	Name      string        `json:"name" db:"name"`
+	Position  int           `json:"position" db:"position"`
+	Values    []OptionValue `json:"values"`
+}
+
+// OptionValue is one choice of an option, such as XL or red
+type OptionValue struct {
+	ID           int64  `json:"id" db:"id"`
+	OptionTypeID int64  `json:"option_type_id" db:"option_type_id"`
+	Value        string `json:"value" db:"value"`
+	Position     int    `json:"position" db:"position"`
+}
+
+// Variant is a sellable combination of option values with its own SKU,
+// price, images and stock. Every product has a default variant without
+// options, which is deactivated once variants with options are added.
+type Variant struct {
+	ID            int64           `json:"id" db:"id"`
+	ProductID     int64           `json:"product_id" db:"product_id"`
+	SKU           string          `json:"sku" db:"sku"`
+	Price         float64         `json:"price"`
+	PriceOverride *float64        `json:"price_override,omitempty" db:"price"`
+	ImageURLs     []string        `json:"image_urls" db:"image_urls"`
+	Options       []VariantOption `json:"options"`
+	IsDefault     bool            `json:"-" db:"is_default"`
+	IsActive      bool            `json:"is_active" db:"is_active"`
+	InStock       bool            `json:"in_stock"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// VariantOption is the value a variant has for one option
+type VariantOption struct {
+	OptionValueID int64  `json:"option_value_id"`
+	Name          string `json:"name"`
+	Value         string `json:"value"`
+}
+
+// Image is an uploaded product image with its thumbnails
+type Image struct {
+	ID          int64             `json:"id" db:"id"`
+	ProductID   int64             `json:"product_id" db:"product_id"`
+	URL         string            `json:"url" db:"url"`
+	AltText     string            `json:"alt_text" db:"alt_text"`
+	Position    int               `json:"position" db:"position"`
+	ContentType string            `json:"content_type" db:"content_type"`
+	SizeBytes   int64             `json:"size_bytes" db:"size_bytes"`
+	Width       int               `json:"width" db:"width"`
+	Height      int               `json:"height" db:"height"`
+	Thumbnails  map[string]string `json:"thumbnails" db:"thumbnails"`
+	StorageKeys []string          `json:"-" db:"storage_keys"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+}
+
 // CreateProductRequest represents the create product request
 type CreateProductRequest struct {
 	Name         string  `json:"name" validate:"required"`
@@ -48,6 +109,45 @@ type UpdateProductRequest struct {
 	IsFeatured   *bool   `json:"is_featured,omitempty"`
 }
 
+// CreateOptionRequest adds an option and its values to a product
+type CreateOptionRequest struct {
+	Name   string   `json:"name" validate:"required,max=50"`
+	Values []string `json:"values" validate:"required,min=1,dive,required,max=50"`
+}
+
+// CreateVariantRequest adds a variant to a product. Options maps the name
+// of every option of the product to one of its values. Without a price the
+// variant sells at the product price.
+type CreateVariantRequest struct {
+	SKU       string            `json:"sku" validate:"required,max=100"`
+	Price     *float64          `json:"price,omitempty" validate:"omitempty,gt=0"`
+	Options   map[string]string `json:"options" validate:"required"`
+	ImageURLs []string          `json:"image_urls,omitempty"`
+	Quantity  int               `json:"quantity" validate:"gte=0"`
+}
+
+// UpdateVariantRequest updates a variant. A price of 0 removes the price
+// override.
+type UpdateVariantRequest struct {
+	SKU       string   `json:"sku,omitempty" validate:"max=100"`
+	Price     *float64 `json:"price,omitempty" validate:"omitempty,gte=0"`
+	ImageURLs []string `json:"image_urls,omitempty"`
+	IsActive  *bool    `json:"is_active,omitempty"`
+}
+
+// AddImageRequest holds the form fields of an image upload. Without a
+// position the image is added last.
+type AddImageRequest struct {
+	AltText  string `validate:"max=255"`
+	Position *int   `validate:"omitempty,gte=0"`
+}
+
+// UpdateImageRequest changes the alt text or position of an image
+type UpdateImageRequest struct {
+	AltText  *string `json:"alt_text,omitempty" validate:"omitempty,max=255"`
+	Position *int    `json:"position,omitempty" validate:"omitempty,gte=0"`
+}
+
 // ProductFilter represents filtering options
 type ProductFilter struct {
 	CategoryID int64
@@ -55,6 +155,66 @@ type ProductFilter struct {
 	MaxPrice   float64
 	IsFeatured *bool
 	Search     string
+}
+
+// SearchQuery is a full-text product search with optional refinements
+type SearchQuery struct {
+	Text       string
+	CategoryID int64
+	MinPrice   float64
+	MaxPrice   float64
+	MinRating  float64
 	Limit      int
 	Offset     int
 }
+
+// SearchResult is a page of search hits with facets over all matches
+type SearchResult struct {
+	Hits   []*SearchHit  `json:"hits"`
+	Total  int           `json:"total"`
+	Facets *SearchFacets `json:"facets"`
+}
+
+// SearchHit is a matching product with its relevance and highlighted
+// snippets. Matched words are wrapped in <mark> tags.
+type SearchHit struct {
+	*Product
+	Score      float64          `json:"score"`
+	Rating     float64          `json:"rating"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchHighlights holds the highlighted name and description snippet
+type SearchHighlights struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SearchFacets counts the matches of a query by category, price range and
+// rating, ignoring the refinements of the query
+type SearchFacets struct {
+	Categories []CategoryFacet `json:"categories"`
+	Prices     []PriceFacet    `json:"prices"`
+	Ratings    []RatingFacet   `json:"ratings"`
+}
+
+// CategoryFacet counts the matches in a category
+type CategoryFacet struct {
+	CategoryID int64  `json:"category_id"`
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+}
+
+// PriceFacet counts the matches priced from Min up to Max; the last range
+// has no Max
+type PriceFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// RatingFacet counts the matches rated MinRating stars or more on average
+type RatingFacet struct {
+	MinRating int `json:"min_rating"`
+	Count     int `json:"count"`
+}
@@ -1,53 +1,84 @@
 package product
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
+
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/pagination"
 )
 
+// ReadPool picks the connection pool for queries that may be served by a
+// read replica
+type ReadPool interface {
+	Reader() *sql.DB
+}
+
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	replica ReadPool
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// NewRepository creates a product repository. Listings and searches go
+// through replica when it is not nil; everything else uses db.
+func NewRepository(db *sql.DB, replica ReadPool) *Repository {
+	return &Repository{db: db, replica: replica}
 }
 
-// Create creates a new product
-func (r *Repository) Create(product *Product) error {
+// reader returns the pool for catalog reads that tolerate replication lag
+func (r *Repository) reader() *sql.DB {
+	if r.replica == nil {
+		return r.db
+	}
+	return r.replica.Reader()
+}
+
+// Create creates a new product with its default variant and an empty
+// inventory record for it
+func (r *Repository) Create(ctx context.Context, product *Product) error {
 	query := `
 		INSERT INTO products (name, slug, description, price, compare_price, category_id, sku, is_active, is_featured, image_url, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
-		query,
-		product.Name,
-		product.Slug,
-		product.Description,
-		product.Price,
-		product.ComparePrice,
-		product.CategoryID,
-		product.SKU,
-		product.IsActive,
-		product.IsFeatured,
-		product.ImageURL,
-		time.Now(),
-		time.Now(),
-	).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+	return db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			product.Name,
+			product.Slug,
+			product.Description,
+			product.Price,
+			product.ComparePrice,
+			product.CategoryID,
+			product.SKU,
+			product.IsActive,
+			product.IsFeatured,
+			product.ImageURL,
+			time.Now(),
+			time.Now(),
+		).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
 
-	if err != nil {
-		return fmt.Errorf("failed to create product: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("failed to create product: %w", err)
+		}
 
-	return nil
+		variant := &Variant{ProductID: product.ID, SKU: product.SKU, IsDefault: true, IsActive: true}
+		return createVariant(ctx, tx, variant, nil, 0)
+	})
 }
 
 // GetByID retrieves a product by ID
-func (r *Repository) GetByID(id int64) (*Product, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Product, error) {
 	query := `
 		SELECT id, name, slug, description, price, compare_price, category_id, sku, is_active, is_featured, image_url, created_at, updated_at
 		FROM products
@@ -55,7 +86,7 @@ func (r *Repository) GetByID(id int64) (*Product, error) {
 	`
 
 	product := &Product{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&product.ID,
 		&product.Name,
 		&product.Slug,
@@ -81,58 +112,61 @@ func (r *Repository) GetByID(id int64) (*Product, error) {
 	return product, nil
 }
 
-// List retrieves products with filtering
-func (r *Repository) List(filter *ProductFilter) ([]*Product, error) {
-	query := `SELECT id, name, slug, description, price, compare_price, category_id, sku, is_active, is_featured, image_url, created_at, updated_at FROM products WHERE is_active = true`
+// productConditions returns the WHERE clause selecting the active
+// products matching filter and its arguments
+func productConditions(filter *ProductFilter) (string, []interface{}) {
+	where := " WHERE is_active = true"
 	args := []interface{}{}
-	argPosition := 1
 
 	if filter.CategoryID > 0 {
-		query += fmt.Sprintf(" AND category_id = $%d", argPosition)
 		args = append(args, filter.CategoryID)
-		argPosition++
+		where += fmt.Sprintf(" AND category_id = $%d", len(args))
 	}
 
 	if filter.MinPrice > 0 {
-		query += fmt.Sprintf(" AND price >= $%d", argPosition)
 		args = append(args, filter.MinPrice)
-		argPosition++
+		where += fmt.Sprintf(" AND price >= $%d", len(args))
 	}
 
 	if filter.MaxPrice > 0 {
-		query += fmt.Sprintf(" AND price <= $%d", argPosition)
 		args = append(args, filter.MaxPrice)
-		argPosition++
+		where += fmt.Sprintf(" AND price <= $%d", len(args))
 	}
 
 	if filter.IsFeatured != nil {
-		query += fmt.Sprintf(" AND is_featured = $%d", argPosition)
 		args = append(args, *filter.IsFeatured)
-		argPosition++
+		where += fmt.Sprintf(" AND is_featured = $%d", len(args))
 	}
 
 	if filter.Search != "" {
-		query += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d)", argPosition, argPosition)
-		args = append(args, "%"+filter.Search+"%")
-		argPosition++
+		args = append(args, filter.Search)
+		where += fmt.Sprintf(" AND (search_vector @@ websearch_to_tsquery('english', $%d) OR $%d <%% name)", len(args), len(args))
 	}
 
-	query += " ORDER BY created_at DESC"
+	return where, args
+}
 
-	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argPosition)
-		args = append(args, filter.Limit)
-		argPosition++
-	}
+// List retrieves a page of products matching filter, newest first, and the
+// cursor of the next page, which is nil on the last page
+func (r *Repository) List(ctx context.Context, filter *ProductFilter, page *pagination.Page) ([]*Product, *pagination.Cursor, error) {
+	where, args := productConditions(filter)
+	query := `SELECT id, name, slug, description, price, compare_price, category_id, sku, is_active, is_featured, image_url, created_at, updated_at FROM products` + where
 
-	if filter.Offset > 0 {
-		query += fmt.Sprintf(" OFFSET $%d", argPosition)
-		args = append(args, filter.Offset)
+	if page.Cursor != nil {
+		after, err := page.Cursor.Time()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, after, page.Cursor.ID)
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
 	}
 
-	rows, err := r.db.Query(query, args...)
+	args = append(args, page.FetchLimit(), page.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.reader().QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list products: %w", err)
+		return nil, nil, fmt.Errorf("failed to list products: %w", err)
 	}
 	defer rows.Close()
 
@@ -155,16 +189,38 @@ func (r *Repository) List(filter *ProductFilter) ([]*Product, error) {
 			&product.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan product: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, product)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list products: %w", err)
+	}
+
+	if !page.HasMore(len(products)) {
+		return products, nil, nil
+	}
+	products = products[:page.Limit]
+	last := products[len(products)-1]
 
-	return products, nil
+	return products, pagination.TimeCursor(last.CreatedAt, last.ID), nil
 }
 
-// Update updates a product
-func (r *Repository) Update(product *Product) error {
+// Count returns the number of active products matching filter
+func (r *Repository) Count(ctx context.Context, filter *ProductFilter) (int, error) {
+	where, args := productConditions(filter)
+
+	var count int
+	if err := r.reader().QueryRowContext(ctx, `SELECT COUNT(*) FROM products`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	return count, nil
+}
+
+// Update updates a product and keeps the SKU of its default variant in
+// step with the product SKU
+func (r *Repository) Update(ctx context.Context, product *Product) error {
 	query := `
 		UPDATE products
 		SET name = $1, slug = $2, description = $3, price = $4, compare_price = $5, 
@@ -172,34 +228,42 @@ func (r *Repository) Update(product *Product) error {
 		WHERE id = $12
 	`
 
-	_, err := r.db.Exec(
-		query,
-		product.Name,
-		product.Slug,
-		product.Description,
-		product.Price,
-		product.ComparePrice,
-		product.CategoryID,
-		product.SKU,
-		product.IsActive,
-		product.IsFeatured,
-		product.ImageURL,
-		time.Now(),
-		product.ID,
-	)
+	return db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			product.Name,
+			product.Slug,
+			product.Description,
+			product.Price,
+			product.ComparePrice,
+			product.CategoryID,
+			product.SKU,
+			product.IsActive,
+			product.IsFeatured,
+			product.ImageURL,
+			time.Now(),
+			product.ID,
+		)
 
-	if err != nil {
-		return fmt.Errorf("failed to update product: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("failed to update product: %w", err)
+		}
 
-	return nil
+		_, err = tx.ExecContext(ctx, `UPDATE product_variants SET sku = $1, updated_at = $2 WHERE product_id = $3 AND is_default = true`, product.SKU, time.Now(), product.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update default variant: %w", err)
+		}
+
+		return nil
+	})
 }
 
 // Delete soft deletes a product
-func (r *Repository) Delete(id int64) error {
+func (r *Repository) Delete(ctx context.Context, id int64) error {
 	query := `UPDATE products SET is_active = false, updated_at = $1 WHERE id = $2`
 
-	_, err := r.db.Exec(query, time.Now(), id)
+	_, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete product: %w", err)
 	}
@@ -207,45 +271,585 @@ func (r *Repository) Delete(id int64) error {
 	return nil
 }
 
-// Search searches products by name or description
-func (r *Repository) Search(searchTerm string, limit, offset int) ([]*Product, error) {
+// GetOptions retrieves the options of a product with their values, in
+// display order
+func (r *Repository) GetOptions(ctx context.Context, productID int64) ([]OptionType, error) {
 	query := `
-		SELECT id, name, slug, description, price, compare_price, category_id, sku, is_active, is_featured, image_url, created_at, updated_at
-		FROM products
-		WHERE is_active = true AND (name ILIKE $1 OR description ILIKE $1)
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
+		SELECT t.id, t.product_id, t.name, t.position, v.id, v.value, v.position
+		FROM product_option_types t
+		JOIN product_option_values v ON v.option_type_id = t.id
+		WHERE t.product_id = $1
+		ORDER BY t.position, t.id, v.position, v.id
 	`
 
-	rows, err := r.db.Query(query, "%"+searchTerm+"%", limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, productID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search products: %w", err)
+		return nil, fmt.Errorf("failed to get product options: %w", err)
 	}
 	defer rows.Close()
 
-	products := []*Product{}
+	options := []OptionType{}
 	for rows.Next() {
-		product := &Product{}
-		err := rows.Scan(
-			&product.ID,
-			&product.Name,
-			&product.Slug,
-			&product.Description,
-			&product.Price,
-			&product.ComparePrice,
-			&product.CategoryID,
-			&product.SKU,
-			&product.IsActive,
-			&product.IsFeatured,
-			&product.ImageURL,
-			&product.CreatedAt,
-			&product.UpdatedAt,
-		)
+		var option OptionType
+		var value OptionValue
+		err := rows.Scan(&option.ID, &option.ProductID, &option.Name, &option.Position, &value.ID, &value.Value, &value.Position)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan product: %w", err)
+			return nil, fmt.Errorf("failed to scan product option: %w", err)
 		}
-		products = append(products, product)
+		value.OptionTypeID = option.ID
+
+		if n := len(options); n == 0 || options[n-1].ID != option.ID {
+			options = append(options, option)
+		}
+		last := &options[len(options)-1]
+		last.Values = append(last.Values, value)
 	}
 
-	return products, nil
+	return options, rows.Err()
+}
+
+// CreateOption adds an option and its values to a product, after its
+// existing options
+func (r *Repository) CreateOption(ctx context.Context, option *OptionType) error {
+	return db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO product_option_types (product_id, name, position, created_at)
+			SELECT $1, $2, COUNT(*), $3 FROM product_option_types WHERE product_id = $1
+			RETURNING id, position
+		`
+
+		err := tx.QueryRowContext(ctx, query, option.ProductID, option.Name, time.Now()).Scan(&option.ID, &option.Position)
+		if err != nil {
+			return fmt.Errorf("failed to create product option: %w", err)
+		}
+
+		for i := range option.Values {
+			value := &option.Values[i]
+			value.OptionTypeID = option.ID
+			value.Position = i
+
+			err := tx.QueryRowContext(
+				ctx,
+				`INSERT INTO product_option_values (option_type_id, value, position) VALUES ($1, $2, $3) RETURNING id`,
+				value.OptionTypeID,
+				value.Value,
+				value.Position,
+			).Scan(&value.ID)
+			if err != nil {
+				return fmt.Errorf("failed to create option value: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// variantColumns selects a variant joined with its product as p; price is
+// the price the variant sells at
+const variantColumns = `v.id, v.product_id, v.sku, COALESCE(v.price, p.price), v.price, v.image_urls, v.is_default, v.is_active, v.created_at, v.updated_at`
+
+// scanVariant scans a row selected with variantColumns
+func scanVariant(row interface{ Scan(...interface{}) error }) (*Variant, error) {
+	variant := &Variant{}
+	var priceOverride sql.NullFloat64
+	err := row.Scan(
+		&variant.ID,
+		&variant.ProductID,
+		&variant.SKU,
+		&variant.Price,
+		&priceOverride,
+		pq.Array(&variant.ImageURLs),
+		&variant.IsDefault,
+		&variant.IsActive,
+		&variant.CreatedAt,
+		&variant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if priceOverride.Valid {
+		variant.PriceOverride = &priceOverride.Float64
+	}
+	if variant.ImageURLs == nil {
+		variant.ImageURLs = []string{}
+	}
+
+	return variant, nil
+}
+
+// GetVariants retrieves the variants of a product with their options.
+// Inactive variants are included only when activeOnly is false.
+func (r *Repository) GetVariants(ctx context.Context, productID int64, activeOnly bool) ([]Variant, error) {
+	query := `
+		SELECT ` + variantColumns + `
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = $1 AND (v.is_active = true OR NOT $2)
+		ORDER BY v.is_default DESC, v.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, productID, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %w", err)
+	}
+	defer rows.Close()
+
+	variants := []Variant{}
+	positions := map[int64]int{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variant.Options = []VariantOption{}
+		positions[variant.ID] = len(variants)
+		variants = append(variants, *variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get variants: %w", err)
+	}
+
+	optionRows, err := r.db.QueryContext(ctx, `
+		SELECT vo.variant_id, ov.id, t.name, ov.value
+		FROM product_variant_option_values vo
+		JOIN product_option_values ov ON ov.id = vo.option_value_id
+		JOIN product_option_types t ON t.id = ov.option_type_id
+		WHERE t.product_id = $1
+		ORDER BY t.position, t.id
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant options: %w", err)
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var variantID int64
+		var option VariantOption
+		if err := optionRows.Scan(&variantID, &option.OptionValueID, &option.Name, &option.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan variant option: %w", err)
+		}
+		if i, ok := positions[variantID]; ok {
+			variants[i].Options = append(variants[i].Options, option)
+		}
+	}
+
+	return variants, optionRows.Err()
+}
+
+// GetVariant retrieves a variant of an active product
+func (r *Repository) GetVariant(ctx context.Context, id int64) (*Variant, error) {
+	query := `
+		SELECT ` + variantColumns + `
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1 AND p.is_active = true
+	`
+
+	variant, err := scanVariant(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("variant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant: %w", err)
+	}
+
+	return variant, nil
+}
+
+// GetDefaultVariant retrieves the default variant of an active product. It
+// fails once the product is sold in variants with options.
+func (r *Repository) GetDefaultVariant(ctx context.Context, productID int64) (*Variant, error) {
+	query := `
+		SELECT ` + variantColumns + `
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = $1 AND v.is_default = true AND v.is_active = true AND p.is_active = true
+	`
+
+	variant, err := scanVariant(r.db.QueryRowContext(ctx, query, productID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("product not found or sold in variants, choose a variant")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default variant: %w", err)
+	}
+
+	return variant, nil
+}
+
+// CreateVariant creates a variant with the given option values and an
+// inventory record holding quantity units. A variant with options replaces
+// the default variant of its product, which is deactivated.
+func (r *Repository) CreateVariant(ctx context.Context, variant *Variant, optionValueIDs []int64, quantity int) error {
+	return db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := createVariant(ctx, tx, variant, optionValueIDs, quantity); err != nil {
+			return err
+		}
+
+		if len(optionValueIDs) > 0 {
+			_, err := tx.ExecContext(ctx, `UPDATE product_variants SET is_active = false, updated_at = $1 WHERE product_id = $2 AND is_default = true`, time.Now(), variant.ProductID)
+			if err != nil {
+				return fmt.Errorf("failed to deactivate default variant: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// createVariant inserts a variant, its option values and its inventory
+// record using tx
+func createVariant(ctx context.Context, tx *sql.Tx, variant *Variant, optionValueIDs []int64, quantity int) error {
+	query := `
+		INSERT INTO product_variants (product_id, sku, price, image_urls, option_key, is_default, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`
+
+	if variant.ImageURLs == nil {
+		variant.ImageURLs = []string{}
+	}
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		variant.ProductID,
+		variant.SKU,
+		variant.PriceOverride,
+		pq.Array(variant.ImageURLs),
+		OptionKey(optionValueIDs),
+		variant.IsDefault,
+		variant.IsActive,
+		time.Now(),
+		time.Now(),
+	).Scan(&variant.ID, &variant.CreatedAt, &variant.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create variant: %w", err)
+	}
+
+	for _, valueID := range optionValueIDs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO product_variant_option_values (variant_id, option_value_id) VALUES ($1, $2)`, variant.ID, valueID)
+		if err != nil {
+			return fmt.Errorf("failed to set variant option: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO inventory (product_id, variant_id, quantity, reserved, updated_at) VALUES ($1, $2, $3, 0, $4)`,
+		variant.ProductID,
+		variant.ID,
+		quantity,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create variant inventory: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVariant updates the SKU, price, images and status of a variant
+func (r *Repository) UpdateVariant(ctx context.Context, variant *Variant) error {
+	query := `
+		UPDATE product_variants
+		SET sku = $1, price = $2, image_urls = $3, is_active = $4, updated_at = $5
+		WHERE id = $6
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		variant.SKU,
+		variant.PriceOverride,
+		pq.Array(variant.ImageURLs),
+		variant.IsActive,
+		time.Now(),
+		variant.ID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update variant: %w", err)
+	}
+
+	return nil
+}
+
+// VariantStock returns the units available to order of each variant of a
+// product, by variant ID
+func (r *Repository) VariantStock(ctx context.Context, productID int64) (map[int64]int, error) {
+	query := `SELECT variant_id, quantity - reserved FROM inventory WHERE product_id = $1`
+
+	rows, err := r.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant stock: %w", err)
+	}
+	defer rows.Close()
+
+	stock := map[int64]int{}
+	for rows.Next() {
+		var variantID int64
+		var available int
+		if err := rows.Scan(&variantID, &available); err != nil {
+			return nil, fmt.Errorf("failed to scan variant stock: %w", err)
+		}
+		stock[variantID] = available
+	}
+
+	return stock, rows.Err()
+}
+
+// OptionKey identifies a combination of option values regardless of their
+// order
+func OptionKey(optionValueIDs []int64) string {
+	ids := append([]int64(nil), optionValueIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// imageColumns selects a product image
+const imageColumns = `id, product_id, url, alt_text, position, content_type, size_bytes, width, height, thumbnails, storage_keys, created_at`
+
+// scanImage scans a row selected with imageColumns
+func scanImage(row interface{ Scan(...interface{}) error }) (*Image, error) {
+	image := &Image{}
+	var thumbnails []byte
+	err := row.Scan(
+		&image.ID,
+		&image.ProductID,
+		&image.URL,
+		&image.AltText,
+		&image.Position,
+		&image.ContentType,
+		&image.SizeBytes,
+		&image.Width,
+		&image.Height,
+		&thumbnails,
+		pq.Array(&image.StorageKeys),
+		&image.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(thumbnails, &image.Thumbnails); err != nil {
+		return nil, fmt.Errorf("failed to decode image thumbnails: %w", err)
+	}
+
+	return image, nil
+}
+
+// GetImages retrieves the images of a product in display order
+func (r *Repository) GetImages(ctx context.Context, productID int64) ([]Image, error) {
+	query := `SELECT ` + imageColumns + ` FROM product_images WHERE product_id = $1 ORDER BY position, id`
+
+	rows, err := r.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []Image{}
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product image: %w", err)
+		}
+		images = append(images, *image)
+	}
+
+	return images, rows.Err()
+}
+
+// AddImage inserts an image at its position, moving later images down. A
+// position past the last image adds it last.
+func (r *Repository) AddImage(ctx context.Context, image *Image) error {
+	thumbnails, err := json.Marshal(image.Thumbnails)
+	if err != nil {
+		return fmt.Errorf("failed to encode image thumbnails: %w", err)
+	}
+
+	return db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		count, err := lockImages(ctx, tx, image.ProductID)
+		if err != nil {
+			return err
+		}
+		if image.Position < 0 || image.Position > count {
+			image.Position = count
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET position = position + 1 WHERE product_id = $1 AND position >= $2`, image.ProductID, image.Position)
+		if err != nil {
+			return fmt.Errorf("failed to move product images: %w", err)
+		}
+
+		query := `
+			INSERT INTO product_images (product_id, url, alt_text, position, content_type, size_bytes, width, height, thumbnails, storage_keys, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING id, created_at
+		`
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			image.ProductID,
+			image.URL,
+			image.AltText,
+			image.Position,
+			image.ContentType,
+			image.SizeBytes,
+			image.Width,
+			image.Height,
+			thumbnails,
+			pq.Array(image.StorageKeys),
+			time.Now(),
+		).Scan(&image.ID, &image.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create product image: %w", err)
+		}
+
+		return syncImageURL(ctx, tx, image.ProductID)
+	})
+}
+
+// UpdateImage changes the alt text of an image when altText is not nil and
+// moves it to position when that is not nil, shifting the images in
+// between. A position past the last image moves it last.
+func (r *Repository) UpdateImage(ctx context.Context, productID, id int64, altText *string, position *int) (*Image, error) {
+	var image *Image
+	err := db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var count int
+		var err error
+		image, count, err = lockImage(ctx, tx, productID, id)
+		if err != nil {
+			return err
+		}
+
+		if altText != nil {
+			image.AltText = *altText
+		}
+		to := image.Position
+		if position != nil {
+			to = *position
+		}
+		if to < 0 || to >= count {
+			to = count - 1
+		}
+
+		if to != image.Position {
+			query := `UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2 AND position <= $3`
+			if to < image.Position {
+				query = `UPDATE product_images SET position = position + 1 WHERE product_id = $1 AND position >= $3 AND position < $2`
+			}
+			if _, err := tx.ExecContext(ctx, query, productID, image.Position, to); err != nil {
+				return fmt.Errorf("failed to move product images: %w", err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET alt_text = $1, position = $2 WHERE id = $3`, image.AltText, to, image.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update product image: %w", err)
+		}
+		image.Position = to
+
+		return syncImageURL(ctx, tx, productID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// DeleteImage deletes an image, closes the gap in the positions of the
+// remaining images and returns the deleted image
+func (r *Repository) DeleteImage(ctx context.Context, productID, id int64) (*Image, error) {
+	var image *Image
+	err := db.WithTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		image, _, err = lockImage(ctx, tx, productID, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_images WHERE id = $1`, image.ID); err != nil {
+			return fmt.Errorf("failed to delete product image: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2`, productID, image.Position)
+		if err != nil {
+			return fmt.Errorf("failed to move product images: %w", err)
+		}
+
+		return syncImageURL(ctx, tx, productID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// lockImage locks the images of a product like lockImages and reads one of
+// them under the lock, so that its position is current
+func lockImage(ctx context.Context, tx *sql.Tx, productID, id int64) (*Image, int, error) {
+	count, err := lockImages(ctx, tx, productID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + imageColumns + ` FROM product_images WHERE id = $1 AND product_id = $2`
+
+	image, err := scanImage(tx.QueryRowContext(ctx, query, id, productID))
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("image not found")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get product image: %w", err)
+	}
+
+	return image, count, nil
+}
+
+// lockImages locks a product so that its images can be reordered without
+// racing other changes, and returns how many images it has
+func lockImages(ctx context.Context, tx *sql.Tx, productID int64) (int, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("product not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock product: %w", err)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_images WHERE product_id = $1`, productID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count product images: %w", err)
+	}
+
+	return count, nil
+}
+
+// syncImageURL keeps the image shown in listings in step with the first
+// image of a product
+func syncImageURL(ctx context.Context, tx *sql.Tx, productID int64) error {
+	query := `
+		UPDATE products
+		SET image_url = COALESCE((SELECT url FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1), ''), updated_at = $2
+		WHERE id = $1
+	`
+
+	if _, err := tx.ExecContext(ctx, query, productID, time.Now()); err != nil {
+		return fmt.Errorf("failed to update product image: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,277 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SearchEngine finds products matching a text query. PostgresSearch is the
+// default; an external engine can implement it instead.
+type SearchEngine interface {
+	Search(ctx context.Context, query *SearchQuery) (*SearchResult, error)
+}
+
+// priceBuckets are the boundaries of the price facet ranges
+var priceBuckets = []float64{25, 50, 100, 250, 500}
+
+// ratingFacets are the "N stars and up" thresholds of the rating facet
+var ratingFacets = []int{4, 3, 2, 1}
+
+// searchMatch selects active products matching the text in $1 by full
+// text, or by trigram similarity of the name so that typos still match
+const searchMatch = `p.is_active = true AND (p.search_vector @@ websearch_to_tsquery('english', $1) OR $1 <% p.name)`
+
+// highlightStart and highlightStop delimit matches in ts_headline output.
+// They are private use characters, so that the text around them can be
+// HTML-escaped before they are turned into <mark> tags.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// highlightOptions are the ts_headline options shared by all highlights
+const highlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+
+// productRating joins the average review rating of each product as r.rating
+const productRating = `LEFT JOIN LATERAL (SELECT AVG(rating) AS rating FROM reviews WHERE product_id = p.id) r ON true`
+
+// PostgresSearch searches products with Postgres full-text search. Names
+// weigh more than SKUs, which weigh more than descriptions.
+type PostgresSearch struct {
+	db      *sql.DB
+	replica ReadPool
+}
+
+// NewPostgresSearch creates a search engine querying replica when it is not
+// nil, and db otherwise
+func NewPostgresSearch(db *sql.DB, replica ReadPool) *PostgresSearch {
+	return &PostgresSearch{db: db, replica: replica}
+}
+
+// Search returns a page of products ranked by relevance, with facets
+func (e *PostgresSearch) Search(ctx context.Context, query *SearchQuery) (*SearchResult, error) {
+	// Use one pool for all queries so that hits and facets agree
+	conn := e.db
+	if e.replica != nil {
+		conn = e.replica.Reader()
+	}
+
+	hits, total, err := e.hits(ctx, conn, query)
+	if err != nil {
+		return nil, err
+	}
+
+	facets, err := e.facets(ctx, conn, query.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchResult{Hits: hits, Total: total, Facets: facets}, nil
+}
+
+// hits returns the requested page of matches and the number of matches
+func (e *PostgresSearch) hits(ctx context.Context, conn *sql.DB, query *SearchQuery) ([]*SearchHit, int, error) {
+	conditions, args := searchConditions(query)
+	argPosition := len(args) + 1
+
+	sqlQuery := `
+		SELECT p.id, p.name, p.slug, p.description, p.price, p.compare_price, p.category_id, p.sku, p.is_active, p.is_featured, p.image_url, p.created_at, p.updated_at,
+			ts_rank_cd(p.search_vector, websearch_to_tsquery('english', $1)) + word_similarity($1, p.name) AS score,
+			COALESCE(r.rating, 0),
+			ts_headline('english', p.name, websearch_to_tsquery('english', $1), '` + highlightOptions + `, HighlightAll=true'),
+			ts_headline('english', COALESCE(p.description, ''), websearch_to_tsquery('english', $1), '` + highlightOptions + `, MaxFragments=2, MaxWords=30, MinWords=10'),
+			COUNT(*) OVER ()
+		FROM products p
+		` + productRating + `
+		WHERE ` + conditions +
+		fmt.Sprintf(" ORDER BY score DESC, p.id LIMIT $%d OFFSET $%d", argPosition, argPosition+1)
+	pageArgs := append(append([]interface{}{}, args...), query.Limit, query.Offset)
+
+	rows, err := conn.QueryContext(ctx, sqlQuery, pageArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []*SearchHit{}
+	total := 0
+	for rows.Next() {
+		hit := &SearchHit{Product: &Product{}}
+		err := rows.Scan(
+			&hit.ID,
+			&hit.Name,
+			&hit.Slug,
+			&hit.Description,
+			&hit.Price,
+			&hit.ComparePrice,
+			&hit.CategoryID,
+			&hit.SKU,
+			&hit.IsActive,
+			&hit.IsFeatured,
+			&hit.ImageURL,
+			&hit.CreatedAt,
+			&hit.UpdatedAt,
+			&hit.Score,
+			&hit.Rating,
+			&hit.Highlights.Name,
+			&hit.Highlights.Description,
+			&total,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		hit.Highlights.Name = highlight(hit.Highlights.Name)
+		hit.Highlights.Description = highlight(hit.Highlights.Description)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	// A page past the last match has no rows to carry the window count
+	if len(hits) == 0 && query.Offset > 0 {
+		err := conn.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM products p
+			`+productRating+`
+			WHERE `+conditions,
+			args...,
+		).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+		}
+	}
+
+	return hits, total, nil
+}
+
+// searchConditions returns the WHERE clause selecting the matches of query
+// and its arguments, starting with the search text
+func searchConditions(query *SearchQuery) (string, []interface{}) {
+	conditions := searchMatch
+	args := []interface{}{query.Text}
+
+	if query.CategoryID > 0 {
+		args = append(args, query.CategoryID)
+		conditions += fmt.Sprintf(" AND p.category_id = $%d", len(args))
+	}
+
+	if query.MinPrice > 0 {
+		args = append(args, query.MinPrice)
+		conditions += fmt.Sprintf(" AND p.price >= $%d", len(args))
+	}
+
+	if query.MaxPrice > 0 {
+		args = append(args, query.MaxPrice)
+		conditions += fmt.Sprintf(" AND p.price <= $%d", len(args))
+	}
+
+	if query.MinRating > 0 {
+		args = append(args, query.MinRating)
+		conditions += fmt.Sprintf(" AND COALESCE(r.rating, 0) >= $%d", len(args))
+	}
+
+	return conditions, args
+}
+
+// highlight escapes ts_headline output for HTML and marks the matches with
+// <mark> tags
+func highlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+// facets counts all matches of text by category, price range and rating
+func (e *PostgresSearch) facets(ctx context.Context, conn *sql.DB, text string) (*SearchFacets, error) {
+	facets := &SearchFacets{Categories: []CategoryFacet{}}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT c.id, c.name, COUNT(*)
+		FROM products p
+		JOIN categories c ON c.id = p.category_id
+		WHERE `+searchMatch+`
+		GROUP BY c.id, c.name
+		ORDER BY COUNT(*) DESC, c.name
+		LIMIT 20
+	`, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category facets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facet CategoryFacet
+		if err := rows.Scan(&facet.CategoryID, &facet.Name, &facet.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan category facet: %w", err)
+		}
+		facets.Categories = append(facets.Categories, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get category facets: %w", err)
+	}
+
+	// width_bucket numbers the ranges from 0, below the first boundary, to
+	// len(priceBuckets), at or above the last
+	facets.Prices = make([]PriceFacet, len(priceBuckets)+1)
+	for i := range facets.Prices {
+		if i > 0 {
+			facets.Prices[i].Min = priceBuckets[i-1]
+		}
+		if i < len(priceBuckets) {
+			max := priceBuckets[i]
+			facets.Prices[i].Max = &max
+		}
+	}
+
+	priceRows, err := conn.QueryContext(ctx, `
+		SELECT width_bucket(p.price, $2::numeric[]), COUNT(*)
+		FROM products p
+		WHERE `+searchMatch+`
+		GROUP BY 1
+	`, text, pq.Array(priceBuckets))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price facets: %w", err)
+	}
+	defer priceRows.Close()
+
+	for priceRows.Next() {
+		var bucket, count int
+		if err := priceRows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan price facet: %w", err)
+		}
+		if bucket >= 0 && bucket < len(facets.Prices) {
+			facets.Prices[bucket].Count = count
+		}
+	}
+	if err := priceRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get price facets: %w", err)
+	}
+
+	facets.Ratings = make([]RatingFacet, len(ratingFacets))
+	columns := make([]string, len(ratingFacets))
+	counts := make([]interface{}, len(ratingFacets))
+	for i, stars := range ratingFacets {
+		facets.Ratings[i].MinRating = stars
+		columns[i] = fmt.Sprintf("COUNT(*) FILTER (WHERE r.rating >= %d)", stars)
+		counts[i] = &facets.Ratings[i].Count
+	}
+
+	err = conn.QueryRowContext(ctx, `
+		SELECT `+strings.Join(columns, ", ")+`
+		FROM products p
+		`+productRating+`
+		WHERE `+searchMatch,
+		text,
+	).Scan(counts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rating facets: %w", err)
+	}
+
+	return facets, nil
+}
@@ -1,19 +1,54 @@
 package product
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecommerce_project/pkg/cache"
+	"ecommerce_project/pkg/media"
+	"ecommerce_project/pkg/pagination"
+	"ecommerce_project/pkg/utils"
 )
 
+// listGenerationKey is bumped on every product change so that all cached
+// listings, whatever their filters, are invalidated together
+const listGenerationKey = "products:list:generation"
+
+// listPage is a cached page of a product listing
+type listPage struct {
+	Products   []*Product       `json:"products"`
+	Pagination utils.Pagination `json:"pagination"`
+}
+
+// ImageUploader validates uploaded images and stores them with their
+// thumbnails
+type ImageUploader interface {
+	Upload(ctx context.Context, prefix string, data []byte) (*media.Upload, error)
+	Delete(ctx context.Context, keys []string)
+	MaxBytes() int64
+}
+
 type Service struct {
-	repo *Repository
+	repo     *Repository
+	search   SearchEngine
+	images   ImageUploader
+	cache    cache.Cache
+	cacheTTL time.Duration
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+// NewService creates a product service. Products and listings are cached
+// in store for cacheTTL; a nil store disables caching.
+func NewService(repo *Repository, search SearchEngine, images ImageUploader, store cache.Cache, cacheTTL time.Duration) *Service {
+	return &Service{repo: repo, search: search, images: images, cache: store, cacheTTL: cacheTTL}
 }
 
 // Create creates a new product
-func (s *Service) Create(req *CreateProductRequest) (*Product, error) {
+func (s *Service) Create(ctx context.Context, req *CreateProductRequest) (*Product, error) {
 	product := &Product{
 		Name:         req.Name,
 		Slug:         req.Slug,
@@ -27,30 +62,77 @@ func (s *Service) Create(req *CreateProductRequest) (*Product, error) {
 		IsFeatured:   req.IsFeatured,
 	}
 
-	if err := s.repo.Create(product); err != nil {
+	if err := s.repo.Create(ctx, product); err != nil {
 		return nil, err
 	}
 
+	cache.Bump(ctx, s.cache, listGenerationKey)
+
 	return product, nil
 }
 
-// GetByID retrieves a product by ID
-func (s *Service) GetByID(id int64) (*Product, error) {
-	return s.repo.GetByID(id)
+// GetByID retrieves a product by ID with its options and active variants.
+// Stock changes with every order, so it is read fresh rather than cached.
+func (s *Service) GetByID(ctx context.Context, id int64) (*Product, error) {
+	product := &Product{}
+	err := cache.Remember(ctx, s.cache, productKey(id), s.cacheTTL, product, func() error {
+		p, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if p.Options, err = s.repo.GetOptions(ctx, id); err != nil {
+			return err
+		}
+		if p.Variants, err = s.repo.GetVariants(ctx, id, true); err != nil {
+			return err
+		}
+		if p.Images, err = s.repo.GetImages(ctx, id); err != nil {
+			return err
+		}
+		*product = *p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stock, err := s.repo.VariantStock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range product.Variants {
+		product.Variants[i].InStock = stock[product.Variants[i].ID] > 0
+	}
+
+	return product, nil
 }
 
-// List retrieves products with filtering
-func (s *Service) List(filter *ProductFilter) ([]*Product, error) {
-	if filter.Limit == 0 {
-		filter.Limit = 20
+// List retrieves a page of products with filtering, with the total number
+// of matching products
+func (s *Service) List(ctx context.Context, filter *ProductFilter, page *pagination.Page) ([]*Product, utils.Pagination, error) {
+	var result listPage
+	err := cache.Remember(ctx, s.cache, s.listKey(ctx, filter, page), s.cacheTTL, &result, func() error {
+		products, next, err := s.repo.List(ctx, filter, page)
+		if err != nil {
+			return err
+		}
+		total, err := s.repo.Count(ctx, filter)
+		if err != nil {
+			return err
+		}
+		result = listPage{Products: products, Pagination: page.Meta(total, next)}
+		return nil
+	})
+	if err != nil {
+		return nil, utils.Pagination{}, err
 	}
 
-	return s.repo.List(filter)
+	return result.Products, result.Pagination, nil
 }
 
 // Update updates a product
-func (s *Service) Update(id int64, req *UpdateProductRequest) (*Product, error) {
-	product, err := s.repo.GetByID(id)
+func (s *Service) Update(ctx context.Context, id int64, req *UpdateProductRequest) (*Product, error) {
+	product, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -87,27 +169,318 @@ func (s *Service) Update(id int64, req *UpdateProductRequest) (*Product, error)
 		product.IsFeatured = *req.IsFeatured
 	}
 
-	if err := s.repo.Update(product); err != nil {
+	if err := s.repo.Update(ctx, product); err != nil {
 		return nil, err
 	}
 
+	s.invalidate(ctx, id)
+
 	return product, nil
 }
 
 // Delete deletes a product
-func (s *Service) Delete(id int64) error {
-	return s.repo.Delete(id)
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, id)
+
+	return nil
 }
 
-// Search searches products
-func (s *Service) Search(searchTerm string, limit, offset int) ([]*Product, error) {
-	if limit == 0 {
-		limit = 20
+// Search searches products by relevance
+func (s *Service) Search(ctx context.Context, query *SearchQuery) (*SearchResult, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" {
+		return nil, fmt.Errorf("search term is required")
 	}
 
-	if searchTerm == "" {
-		return nil, fmt.Errorf("search term is required")
+	if query.Limit <= 0 {
+		query.Limit = pagination.DefaultLimit
+	}
+	if query.Limit > pagination.MaxLimit {
+		query.Limit = pagination.MaxLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	return s.search.Search(ctx, query)
+}
+
+// CreateOption adds an option, such as size, to a product. Options must be
+// added before variants with options, which need a value for each of them.
+func (s *Service) CreateOption(ctx context.Context, productID int64, req *CreateOptionRequest) (*OptionType, error) {
+	if _, err := s.repo.GetByID(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	variants, err := s.repo.GetVariants(ctx, productID, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		if !variant.IsDefault {
+			return nil, fmt.Errorf("options can only be added before the product has variants")
+		}
+	}
+
+	option := &OptionType{ProductID: productID, Name: strings.TrimSpace(req.Name)}
+	seen := map[string]bool{}
+	for _, value := range req.Values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			return nil, fmt.Errorf("option values must be unique and not empty")
+		}
+		seen[value] = true
+		option.Values = append(option.Values, OptionValue{Value: value})
+	}
+
+	if err := s.repo.CreateOption(ctx, option); err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, productID)
+
+	return option, nil
+}
+
+// CreateVariant adds a variant for a combination of option values, with
+// its own SKU, price, images and stock
+func (s *Service) CreateVariant(ctx context.Context, productID int64, req *CreateVariantRequest) (*Variant, error) {
+	product, err := s.repo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.repo.GetOptions(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("add options to the product before adding variants")
+	}
+
+	selected, err := MatchOptions(options, req.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	valueIDs := make([]int64, len(selected))
+	for i, option := range selected {
+		valueIDs[i] = option.OptionValueID
+	}
+
+	variants, err := s.repo.GetVariants(ctx, productID, false)
+	if err != nil {
+		return nil, err
+	}
+	key := OptionKey(valueIDs)
+	for _, existing := range variants {
+		existingIDs := make([]int64, len(existing.Options))
+		for i, option := range existing.Options {
+			existingIDs[i] = option.OptionValueID
+		}
+		if !existing.IsDefault && OptionKey(existingIDs) == key {
+			return nil, fmt.Errorf("variant %s already sells these options", existing.SKU)
+		}
+	}
+
+	variant := &Variant{
+		ProductID:     productID,
+		SKU:           req.SKU,
+		Price:         product.Price,
+		PriceOverride: req.Price,
+		ImageURLs:     req.ImageURLs,
+		Options:       selected,
+		IsActive:      true,
+		InStock:       req.Quantity > 0,
+	}
+	if req.Price != nil {
+		variant.Price = *req.Price
+	}
+
+	if err := s.repo.CreateVariant(ctx, variant, valueIDs, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, productID)
+
+	return variant, nil
+}
+
+// UpdateVariant updates the SKU, price, images or status of a variant
+func (s *Service) UpdateVariant(ctx context.Context, productID, variantID int64, req *UpdateVariantRequest) (*Variant, error) {
+	variant, err := s.repo.GetVariant(ctx, variantID)
+	if err != nil {
+		return nil, err
+	}
+	if variant.ProductID != productID {
+		return nil, fmt.Errorf("variant not found")
+	}
+
+	if req.SKU != "" {
+		variant.SKU = req.SKU
+	}
+	if req.Price != nil {
+		variant.PriceOverride = req.Price
+		if *req.Price == 0 {
+			variant.PriceOverride = nil
+		}
+	}
+	if req.ImageURLs != nil {
+		variant.ImageURLs = req.ImageURLs
+	}
+	if req.IsActive != nil {
+		variant.IsActive = *req.IsActive
+	}
+
+	if err := s.repo.UpdateVariant(ctx, variant); err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, productID)
+
+	return s.repo.GetVariant(ctx, variantID)
+}
+
+// DeleteVariant deactivates a variant. It stays on past orders.
+func (s *Service) DeleteVariant(ctx context.Context, productID, variantID int64) error {
+	active := false
+	_, err := s.UpdateVariant(ctx, productID, variantID, &UpdateVariantRequest{IsActive: &active})
+	return err
+}
+
+// MaxImageBytes returns the size limit of uploaded images
+func (s *Service) MaxImageBytes() int64 {
+	return s.images.MaxBytes()
+}
+
+// AddImage stores an uploaded image of a product with its thumbnails
+func (s *Service) AddImage(ctx context.Context, productID int64, data []byte, req *AddImageRequest) (*Image, error) {
+	// Check the product before storing anything for it
+	if _, err := s.repo.GetByID(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	upload, err := s.images.Upload(ctx, fmt.Sprintf("products/%d", productID), data)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &Image{
+		ProductID:   productID,
+		URL:         upload.URL,
+		AltText:     req.AltText,
+		Position:    -1,
+		ContentType: upload.ContentType,
+		SizeBytes:   upload.Size,
+		Width:       upload.Width,
+		Height:      upload.Height,
+		Thumbnails:  upload.Thumbnails,
+		StorageKeys: upload.Keys,
+	}
+	if req.Position != nil {
+		image.Position = *req.Position
+	}
+
+	if err := s.repo.AddImage(ctx, image); err != nil {
+		s.images.Delete(ctx, upload.Keys)
+		return nil, err
+	}
+
+	s.invalidate(ctx, productID)
+
+	return image, nil
+}
+
+// UpdateImage changes the alt text or position of a product image
+func (s *Service) UpdateImage(ctx context.Context, productID, imageID int64, req *UpdateImageRequest) (*Image, error) {
+	image, err := s.repo.UpdateImage(ctx, productID, imageID, req.AltText, req.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, productID)
+
+	return image, nil
+}
+
+// DeleteImage deletes a product image and its stored files
+func (s *Service) DeleteImage(ctx context.Context, productID, imageID int64) error {
+	image, err := s.repo.DeleteImage(ctx, productID, imageID)
+	if err != nil {
+		return err
+	}
+
+	s.images.Delete(ctx, image.StorageKeys)
+	s.invalidate(ctx, productID)
+
+	return nil
+}
+
+// MatchOptions resolves the value chosen for each option of a product,
+// keyed by option name, in the order of the options
+func MatchOptions(options []OptionType, chosen map[string]string) ([]VariantOption, error) {
+	known := map[string]bool{}
+	selected := make([]VariantOption, 0, len(options))
+
+	for _, option := range options {
+		known[option.Name] = true
+
+		value, ok := chosen[option.Name]
+		if !ok {
+			return nil, fmt.Errorf("a value for option %s is required", option.Name)
+		}
+
+		match := VariantOption{Name: option.Name}
+		for _, candidate := range option.Values {
+			if candidate.Value == value {
+				match.OptionValueID = candidate.ID
+				match.Value = candidate.Value
+				break
+			}
+		}
+		if match.OptionValueID == 0 {
+			return nil, fmt.Errorf("%q is not a value of option %s", value, option.Name)
+		}
+
+		selected = append(selected, match)
+	}
+
+	for name := range chosen {
+		if !known[name] {
+			return nil, fmt.Errorf("product has no option %s", name)
+		}
+	}
+
+	return selected, nil
+}
+
+// invalidate drops the cached product and every cached listing
+func (s *Service) invalidate(ctx context.Context, id int64) {
+	cache.Invalidate(ctx, s.cache, productKey(id))
+	cache.Bump(ctx, s.cache, listGenerationKey)
+}
+
+func productKey(id int64) string {
+	return "product:" + strconv.FormatInt(id, 10)
+}
+
+// listKey identifies a page of a listing by the current list generation
+// and a hash of its filter and page
+func (s *Service) listKey(ctx context.Context, filter *ProductFilter, page *pagination.Page) string {
+	featured := ""
+	if filter.IsFeatured != nil {
+		featured = strconv.FormatBool(*filter.IsFeatured)
+	}
+	cursor := ""
+	if page.Cursor != nil {
+		cursor = page.Cursor.Encode()
 	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%g|%g|%s|%q|%d|%d|%s",
+		filter.CategoryID, filter.MinPrice, filter.MaxPrice, featured, filter.Search, page.Limit, page.Offset, cursor)))
 
-	return s.repo.Search(searchTerm, limit, offset)
+	return "products:list:" + cache.Generation(ctx, s.cache, listGenerationKey) + ":" + hex.EncodeToString(sum[:])
 }
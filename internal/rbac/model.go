@@ -0,0 +1,45 @@
+package rbac
+
+import (
+	"time"
+)
+
+// Permissions checked by the admin routes
+const (
+	PermProductsWrite       = "products:write"
+	PermCategoriesWrite     = "categories:write"
+	PermOrdersRead          = "orders:read"
+	PermOrdersFulfil        = "orders:fulfil"
+	PermOrdersCancel        = "orders:cancel"
+	PermPaymentsRead        = "payments:read"
+	PermPaymentsRefund      = "payments:refund"
+	PermInventoryRead       = "inventory:read"
+	PermInventoryWrite      = "inventory:write"
+	PermRolesManage         = "roles:manage"
+	PermNotificationsManage = "notifications:manage"
+)
+
+// RoleAdmin is the role that holds every permission
+const RoleAdmin = "admin"
+
+// Role is a named set of permissions
+type Role struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserRole is a role granted to a user
+type UserRole struct {
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Role      string    `json:"role" db:"role"`
+	GrantedBy *int64    `json:"granted_by,omitempty" db:"granted_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// GrantRoleRequest represents granting a role to a user
+type GrantRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
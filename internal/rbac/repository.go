@@ -0,0 +1,193 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"ecommerce_project/pkg/db"
+)
+
+// ErrRoleNotFound is returned when a role does not exist
+var ErrRoleNotFound = errors.New("role not found")
+
+type Repository struct {
+	db db.DBTX
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
+// HasPermission reports whether any of the user's roles grants permission
+func (r *Repository) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_roles ur
+			JOIN role_permissions rp ON rp.role_id = ur.role_id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE ur.user_id = $1 AND p.name = $2
+		)
+	`
+
+	var allowed bool
+	if err := r.db.QueryRowContext(ctx, query, userID, permission).Scan(&allowed); err != nil {
+		return false, fmt.Errorf("failed to check permission: %w", err)
+	}
+
+	return allowed, nil
+}
+
+// ListRoles retrieves all roles with their permissions
+func (r *Repository) ListRoles(ctx context.Context) ([]Role, error) {
+	query := `
+		SELECT r.id, r.name, r.description, r.created_at,
+			COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		GROUP BY r.id
+		ORDER BY r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		var permissions pq.StringArray
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &permissions); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		role.Permissions = permissions
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetUserRoles retrieves the roles granted to a user
+func (r *Repository) GetUserRoles(ctx context.Context, userID int64) ([]UserRole, error) {
+	query := `
+		SELECT ur.user_id, r.name, ur.granted_by, ur.created_at
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []UserRole{}
+	for rows.Next() {
+		var role UserRole
+		if err := rows.Scan(&role.UserID, &role.Role, &role.GrantedBy, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole grants a role to a user. Granting a role the user already has
+// is a no-op.
+func (r *Repository) GrantRole(ctx context.Context, userID int64, role string, grantedBy int64) error {
+	query := `
+		INSERT INTO user_roles (user_id, role_id, granted_by, created_at)
+		SELECT $1, id, $3, $4 FROM roles WHERE name = $2
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`
+
+	if _, err := r.getRoleID(ctx, role); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, query, userID, role, grantedBy, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to grant role: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRole removes a role from a user
+func (r *Repository) RevokeRole(ctx context.Context, userID int64, role string) error {
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id = (SELECT id FROM roles WHERE name = $2)
+	`
+
+	if _, err := r.getRoleID(ctx, role); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+
+	return nil
+}
+
+// LockUsersWithRole returns the users that hold a role and locks their
+// grants until the transaction ends, so that concurrent revokes see each
+// other's changes
+func (r *Repository) LockUsersWithRole(ctx context.Context, role string) ([]int64, error) {
+	query := `
+		SELECT ur.user_id
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE r.name = $1
+		FOR UPDATE OF ur
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock users with role: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user with role: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// getRoleID looks up a role by name
+func (r *Repository) getRoleID(ctx context.Context, role string) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = $1`, role).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrRoleNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,80 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"ecommerce_project/pkg/db"
+)
+
+type Service struct {
+	db   *sql.DB
+	repo *Repository
+}
+
+func NewService(db *sql.DB, repo *Repository) *Service {
+	return &Service{db: db, repo: repo}
+}
+
+// HasPermission reports whether a user holds a permission through any of
+// their roles
+func (s *Service) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	return s.repo.HasPermission(ctx, userID, permission)
+}
+
+// ListRoles retrieves all roles with their permissions
+func (s *Service) ListRoles(ctx context.Context) ([]Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+// GetUserRoles retrieves the roles granted to a user
+func (s *Service) GetUserRoles(ctx context.Context, userID int64) ([]UserRole, error) {
+	return s.repo.GetUserRoles(ctx, userID)
+}
+
+// GrantRole grants a role to a user
+func (s *Service) GrantRole(ctx context.Context, userID int64, role string, grantedBy int64) ([]UserRole, error) {
+	if err := s.repo.GrantRole(ctx, userID, role, grantedBy); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUserRoles(ctx, userID)
+}
+
+// RevokeRole removes a role from a user. The last admin cannot be removed,
+// so that someone is always able to manage roles. The admin grants are
+// locked while the admin role is revoked, so that two admins revoking each
+// other at the same time cannot both succeed.
+func (s *Service) RevokeRole(ctx context.Context, userID int64, role string) ([]UserRole, error) {
+	err := db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		repo := s.repo.WithTx(tx)
+
+		if role == RoleAdmin {
+			admins, err := repo.LockUsersWithRole(ctx, RoleAdmin)
+			if err != nil {
+				return err
+			}
+			if len(admins) <= 1 && containsUser(admins, userID) {
+				return fmt.Errorf("cannot revoke the last admin")
+			}
+		}
+
+		return repo.RevokeRole(ctx, userID, role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUserRoles(ctx, userID)
+}
+
+// containsUser reports whether userIDs contains userID
+func containsUser(userIDs []int64, userID int64) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,13 @@ package review
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"ecommerce_project/pkg/pagination"
 	"ecommerce_project/pkg/utils"
 )
 
@@ -27,28 +29,23 @@ func (h *Handler) GetProductReviews(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 20
-	offset := 0
-
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
-		}
+	page, err := pagination.Parse(r.URL.Query(), pagination.DefaultLimit)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil {
-			offset = parsed
-		}
+	reviews, meta, err := h.service.GetProductReviews(r.Context(), productID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	reviews, err := h.service.GetProductReviews(productID, limit, offset)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Reviews retrieved successfully", reviews)
+	utils.PaginatedSuccessResponse(w, http.StatusOK, "Reviews retrieved successfully", reviews, meta)
 }
 
 // Create creates a new review
@@ -66,7 +63,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	review, err := h.service.Create(userID, &req)
+	review, err := h.service.Create(r.Context(), userID, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -92,7 +89,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	review, err := h.service.Update(userID, reviewID, &req)
+	review, err := h.service.Update(r.Context(), userID, reviewID, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -112,7 +109,7 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(userID, reviewID); err != nil {
+	if err := h.service.Delete(r.Context(), userID, reviewID); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
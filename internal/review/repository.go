@@ -1,9 +1,12 @@
 package review
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"ecommerce_project/pkg/pagination"
 )
 
 type Repository struct {
@@ -15,14 +18,15 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 // Create creates a new review
-func (r *Repository) Create(review *Review) error {
+func (r *Repository) Create(ctx context.Context, review *Review) error {
 	query := `
 		INSERT INTO reviews (product_id, user_id, rating, title, comment, verified, helpful, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		review.ProductID,
 		review.UserID,
@@ -43,7 +47,7 @@ func (r *Repository) Create(review *Review) error {
 }
 
 // GetByID retrieves a review by ID
-func (r *Repository) GetByID(id int64) (*Review, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Review, error) {
 	query := `
 		SELECT id, product_id, user_id, rating, title, comment, verified, helpful, created_at, updated_at
 		FROM reviews
@@ -51,7 +55,7 @@ func (r *Repository) GetByID(id int64) (*Review, error) {
 	`
 
 	review := &Review{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&review.ID,
 		&review.ProductID,
 		&review.UserID,
@@ -74,19 +78,31 @@ func (r *Repository) GetByID(id int64) (*Review, error) {
 	return review, nil
 }
 
-// GetByProductID retrieves reviews for a product
-func (r *Repository) GetByProductID(productID int64, limit, offset int) ([]*Review, error) {
+// GetByProductID retrieves a page of reviews for a product, newest first,
+// and the cursor of the next page, which is nil on the last page
+func (r *Repository) GetByProductID(ctx context.Context, productID int64, page *pagination.Page) ([]*Review, *pagination.Cursor, error) {
 	query := `
 		SELECT id, product_id, user_id, rating, title, comment, verified, helpful, created_at, updated_at
 		FROM reviews
 		WHERE product_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
 	`
+	args := []interface{}{productID}
 
-	rows, err := r.db.Query(query, productID, limit, offset)
+	if page.Cursor != nil {
+		after, err := page.Cursor.Time()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, after, page.Cursor.ID)
+		query += " AND (created_at, id) < ($2, $3)"
+	}
+
+	args = append(args, page.FetchLimit(), page.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get reviews: %w", err)
+		return nil, nil, fmt.Errorf("failed to get reviews: %w", err)
 	}
 	defer rows.Close()
 
@@ -106,23 +122,42 @@ func (r *Repository) GetByProductID(productID int64, limit, offset int) ([]*Revi
 			&review.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan review: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan review: %w", err)
 		}
 		reviews = append(reviews, review)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get reviews: %w", err)
+	}
+
+	if !page.HasMore(len(reviews)) {
+		return reviews, nil, nil
+	}
+	reviews = reviews[:page.Limit]
+	last := reviews[len(reviews)-1]
+
+	return reviews, pagination.TimeCursor(last.CreatedAt, last.ID), nil
+}
+
+// CountByProductID returns the number of reviews for a product
+func (r *Repository) CountByProductID(ctx context.Context, productID int64) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reviews WHERE product_id = $1`, productID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count reviews: %w", err)
+	}
 
-	return reviews, nil
+	return count, nil
 }
 
 // Update updates a review
-func (r *Repository) Update(review *Review) error {
+func (r *Repository) Update(ctx context.Context, review *Review) error {
 	query := `
 		UPDATE reviews
 		SET rating = $1, title = $2, comment = $3, updated_at = $4
 		WHERE id = $5
 	`
 
-	_, err := r.db.Exec(query, review.Rating, review.Title, review.Comment, time.Now(), review.ID)
+	_, err := r.db.ExecContext(ctx, query, review.Rating, review.Title, review.Comment, time.Now(), review.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update review: %w", err)
 	}
@@ -131,10 +166,10 @@ func (r *Repository) Update(review *Review) error {
 }
 
 // Delete deletes a review
-func (r *Repository) Delete(id int64) error {
+func (r *Repository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM reviews WHERE id = $1`
 
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete review: %w", err)
 	}
@@ -143,11 +178,11 @@ func (r *Repository) Delete(id int64) error {
 }
 
 // UserHasReviewed checks if user has already reviewed a product
-func (r *Repository) UserHasReviewed(userID, productID int64) (bool, error) {
+func (r *Repository) UserHasReviewed(ctx context.Context, userID, productID int64) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM reviews WHERE user_id = $1 AND product_id = $2)`
 
 	var exists bool
-	err := r.db.QueryRow(query, userID, productID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, userID, productID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check review existence: %w", err)
 	}
@@ -1,7 +1,11 @@
 package review
 
 import (
+	"context"
 	"fmt"
+
+	"ecommerce_project/pkg/pagination"
+	"ecommerce_project/pkg/utils"
 )
 
 type Service struct {
@@ -13,9 +17,9 @@ func NewService(repo *Repository) *Service {
 }
 
 // Create creates a new review
-func (s *Service) Create(userID int64, req *CreateReviewRequest) (*Review, error) {
+func (s *Service) Create(ctx context.Context, userID int64, req *CreateReviewRequest) (*Review, error) {
 	// Check if user has already reviewed this product
-	hasReviewed, err := s.repo.UserHasReviewed(userID, req.ProductID)
+	hasReviewed, err := s.repo.UserHasReviewed(ctx, userID, req.ProductID)
 	if err != nil {
 		return nil, err
 	}
@@ -33,25 +37,32 @@ func (s *Service) Create(userID int64, req *CreateReviewRequest) (*Review, error
 		Helpful:   0,
 	}
 
-	if err := s.repo.Create(review); err != nil {
+	if err := s.repo.Create(ctx, review); err != nil {
 		return nil, err
 	}
 
 	return review, nil
 }
 
-// GetProductReviews retrieves reviews for a product
-func (s *Service) GetProductReviews(productID int64, limit, offset int) ([]*Review, error) {
-	if limit == 0 {
-		limit = 20
+// GetProductReviews retrieves a page of reviews for a product with the
+// total number of reviews
+func (s *Service) GetProductReviews(ctx context.Context, productID int64, page *pagination.Page) ([]*Review, utils.Pagination, error) {
+	reviews, next, err := s.repo.GetByProductID(ctx, productID, page)
+	if err != nil {
+		return nil, utils.Pagination{}, err
+	}
+
+	total, err := s.repo.CountByProductID(ctx, productID)
+	if err != nil {
+		return nil, utils.Pagination{}, err
 	}
 
-	return s.repo.GetByProductID(productID, limit, offset)
+	return reviews, page.Meta(total, next), nil
 }
 
 // Update updates a review
-func (s *Service) Update(userID, reviewID int64, req *UpdateReviewRequest) (*Review, error) {
-	review, err := s.repo.GetByID(reviewID)
+func (s *Service) Update(ctx context.Context, userID, reviewID int64, req *UpdateReviewRequest) (*Review, error) {
+	review, err := s.repo.GetByID(ctx, reviewID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +83,7 @@ func (s *Service) Update(userID, reviewID int64, req *UpdateReviewRequest) (*Rev
 		review.Comment = req.Comment
 	}
 
-	if err := s.repo.Update(review); err != nil {
+	if err := s.repo.Update(ctx, review); err != nil {
 		return nil, err
 	}
 
@@ -80,8 +91,8 @@ func (s *Service) Update(userID, reviewID int64, req *UpdateReviewRequest) (*Rev
 }
 
 // Delete deletes a review
-func (s *Service) Delete(userID, reviewID int64) error {
-	review, err := s.repo.GetByID(reviewID)
+func (s *Service) Delete(ctx context.Context, userID, reviewID int64) error {
+	review, err := s.repo.GetByID(ctx, reviewID)
 	if err != nil {
 		return err
 	}
@@ -91,5 +102,5 @@ func (s *Service) Delete(userID, reviewID int64) error {
 		return fmt.Errorf("review not found")
 	}
 
-	return s.repo.Delete(reviewID)
+	return s.repo.Delete(ctx, reviewID)
 }
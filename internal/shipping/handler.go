@@ -22,7 +22,7 @@ func NewHandler(service *Service) *Handler {
 func (h *Handler) ListAddresses(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int64)
 
-	addresses, err := h.service.ListAddresses(userID)
+	addresses, err := h.service.ListAddresses(r.Context(), userID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
@@ -46,7 +46,7 @@ func (h *Handler) CreateAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	address, err := h.service.CreateAddress(userID, &req)
+	address, err := h.service.CreateAddress(r.Context(), userID, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -72,7 +72,7 @@ func (h *Handler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	address, err := h.service.UpdateAddress(userID, addressID, &req)
+	address, err := h.service.UpdateAddress(r.Context(), userID, addressID, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -92,7 +92,7 @@ func (h *Handler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.DeleteAddress(userID, addressID); err != nil {
+	if err := h.service.DeleteAddress(r.Context(), userID, addressID); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
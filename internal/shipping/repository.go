@@ -1,6 +1,7 @@
 package shipping
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -15,10 +16,10 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 // Create creates a new shipping address
-func (r *Repository) Create(address *ShippingAddress) error {
+func (r *Repository) Create(ctx context.Context, address *ShippingAddress) error {
 	// If this is the default address, unset any existing default
 	if address.IsDefault {
-		if err := r.UnsetDefault(address.UserID); err != nil {
+		if err := r.UnsetDefault(ctx, address.UserID); err != nil {
 			return err
 		}
 	}
@@ -29,7 +30,8 @@ func (r *Repository) Create(address *ShippingAddress) error {
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		address.UserID,
 		address.FullName,
@@ -53,7 +55,7 @@ func (r *Repository) Create(address *ShippingAddress) error {
 }
 
 // GetByID retrieves an address by ID
-func (r *Repository) GetByID(id int64) (*ShippingAddress, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*ShippingAddress, error) {
 	query := `
 		SELECT id, user_id, full_name, phone_number, address_line1, address_line2, city, state, postal_code, country, is_default, created_at, updated_at
 		FROM shipping_addresses
@@ -61,7 +63,7 @@ func (r *Repository) GetByID(id int64) (*ShippingAddress, error) {
 	`
 
 	address := &ShippingAddress{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&address.ID,
 		&address.UserID,
 		&address.FullName,
@@ -88,7 +90,7 @@ func (r *Repository) GetByID(id int64) (*ShippingAddress, error) {
 }
 
 // ListByUserID retrieves all addresses for a user
-func (r *Repository) ListByUserID(userID int64) ([]*ShippingAddress, error) {
+func (r *Repository) ListByUserID(ctx context.Context, userID int64) ([]*ShippingAddress, error) {
 	query := `
 		SELECT id, user_id, full_name, phone_number, address_line1, address_line2, city, state, postal_code, country, is_default, created_at, updated_at
 		FROM shipping_addresses
@@ -96,7 +98,7 @@ func (r *Repository) ListByUserID(userID int64) ([]*ShippingAddress, error) {
 		ORDER BY is_default DESC, created_at DESC
 	`
 
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list addresses: %w", err)
 	}
@@ -130,10 +132,10 @@ func (r *Repository) ListByUserID(userID int64) ([]*ShippingAddress, error) {
 }
 
 // Update updates an address
-func (r *Repository) Update(address *ShippingAddress) error {
+func (r *Repository) Update(ctx context.Context, address *ShippingAddress) error {
 	// If this is the default address, unset any existing default
 	if address.IsDefault {
-		if err := r.UnsetDefault(address.UserID); err != nil {
+		if err := r.UnsetDefault(ctx, address.UserID); err != nil {
 			return err
 		}
 	}
@@ -145,7 +147,8 @@ func (r *Repository) Update(address *ShippingAddress) error {
 		WHERE id = $11
 	`
 
-	_, err := r.db.Exec(
+	_, err := r.db.ExecContext(
+		ctx,
 		query,
 		address.FullName,
 		address.PhoneNumber,
@@ -168,10 +171,10 @@ func (r *Repository) Update(address *ShippingAddress) error {
 }
 
 // Delete deletes an address
-func (r *Repository) Delete(id int64) error {
+func (r *Repository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM shipping_addresses WHERE id = $1`
 
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete address: %w", err)
 	}
@@ -180,10 +183,10 @@ func (r *Repository) Delete(id int64) error {
 }
 
 // UnsetDefault removes default flag from all addresses for a user
-func (r *Repository) UnsetDefault(userID int64) error {
+func (r *Repository) UnsetDefault(ctx context.Context, userID int64) error {
 	query := `UPDATE shipping_addresses SET is_default = false WHERE user_id = $1`
 
-	_, err := r.db.Exec(query, userID)
+	_, err := r.db.ExecContext(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to unset default: %w", err)
 	}
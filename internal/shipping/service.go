@@ -1,6 +1,7 @@
 package shipping
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -13,7 +14,7 @@ func NewService(repo *Repository) *Service {
 }
 
 // CreateAddress creates a new shipping address
-func (s *Service) CreateAddress(userID int64, req *CreateAddressRequest) (*ShippingAddress, error) {
+func (s *Service) CreateAddress(ctx context.Context, userID int64, req *CreateAddressRequest) (*ShippingAddress, error) {
 	address := &ShippingAddress{
 		UserID:       userID,
 		FullName:     req.FullName,
@@ -27,7 +28,7 @@ func (s *Service) CreateAddress(userID int64, req *CreateAddressRequest) (*Shipp
 		IsDefault:    req.IsDefault,
 	}
 
-	if err := s.repo.Create(address); err != nil {
+	if err := s.repo.Create(ctx, address); err != nil {
 		return nil, err
 	}
 
@@ -35,13 +36,13 @@ func (s *Service) CreateAddress(userID int64, req *CreateAddressRequest) (*Shipp
 }
 
 // ListAddresses retrieves all addresses for a user
-func (s *Service) ListAddresses(userID int64) ([]*ShippingAddress, error) {
-	return s.repo.ListByUserID(userID)
+func (s *Service) ListAddresses(ctx context.Context, userID int64) ([]*ShippingAddress, error) {
+	return s.repo.ListByUserID(ctx, userID)
 }
 
 // GetAddress retrieves an address
-func (s *Service) GetAddress(userID, addressID int64) (*ShippingAddress, error) {
-	address, err := s.repo.GetByID(addressID)
+func (s *Service) GetAddress(ctx context.Context, userID, addressID int64) (*ShippingAddress, error) {
+	address, err := s.repo.GetByID(ctx, addressID)
 	if err != nil {
 		return nil, err
 	}
@@ -55,8 +56,8 @@ func (s *Service) GetAddress(userID, addressID int64) (*ShippingAddress, error)
 }
 
 // UpdateAddress updates an address
-func (s *Service) UpdateAddress(userID, addressID int64, req *UpdateAddressRequest) (*ShippingAddress, error) {
-	address, err := s.repo.GetByID(addressID)
+func (s *Service) UpdateAddress(ctx context.Context, userID, addressID int64, req *UpdateAddressRequest) (*ShippingAddress, error) {
+	address, err := s.repo.GetByID(ctx, addressID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +96,7 @@ func (s *Service) UpdateAddress(userID, addressID int64, req *UpdateAddressReque
 		address.IsDefault = *req.IsDefault
 	}
 
-	if err := s.repo.Update(address); err != nil {
+	if err := s.repo.Update(ctx, address); err != nil {
 		return nil, err
 	}
 
@@ -103,8 +104,8 @@ func (s *Service) UpdateAddress(userID, addressID int64, req *UpdateAddressReque
 }
 
 // DeleteAddress deletes an address
-func (s *Service) DeleteAddress(userID, addressID int64) error {
-	address, err := s.repo.GetByID(addressID)
+func (s *Service) DeleteAddress(ctx context.Context, userID, addressID int64) error {
+	address, err := s.repo.GetByID(ctx, addressID)
 	if err != nil {
 		return err
 	}
@@ -114,5 +115,5 @@ func (s *Service) DeleteAddress(userID, addressID int64) error {
 		return fmt.Errorf("address not found")
 	}
 
-	return s.repo.Delete(addressID)
+	return s.repo.Delete(ctx, addressID)
 }
@@ -3,6 +3,9 @@ package user
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
 
 	"ecommerce_project/pkg/utils"
 )
@@ -28,7 +31,7 @@ func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.Signup(&req)
+	user, err := h.service.Signup(r.Context(), &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -50,7 +53,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := h.service.Login(&req)
+	response, err := h.service.Login(r.Context(), &req, r.UserAgent(), utils.ClientIP(r))
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
 		return
@@ -63,7 +66,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(int64)
 
-	user, err := h.service.GetProfile(userID)
+	user, err := h.service.GetProfile(r.Context(), userID)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
 		return
@@ -82,7 +85,7 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.UpdateProfile(userID, &req)
+	user, err := h.service.UpdateProfile(r.Context(), userID, &req)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -106,7 +109,7 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.ChangePassword(userID, &req); err != nil {
+	if err := h.service.ChangePassword(r.Context(), userID, &req); err != nil {
 		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -114,7 +117,7 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	utils.SuccessResponse(w, http.StatusOK, "Password changed successfully", nil)
 }
 
-// RefreshToken generates a new access token
+// RefreshToken exchanges a refresh token for new tokens
 func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req RefreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -127,13 +130,155 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.service.RefreshToken(req.RefreshToken)
+	response, err := h.service.RefreshToken(r.Context(), req.RefreshToken, r.UserAgent(), utils.ClientIP(r))
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(w, http.StatusOK, "Token refreshed successfully", map[string]string{
-		"token": token,
-	})
+	utils.SuccessResponse(w, http.StatusOK, "Token refreshed successfully", response)
+}
+
+// Logout ends the session of the given refresh token
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), req.RefreshToken); err != nil {
+		utils.ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Logged out successfully", nil)
+}
+
+// ListSessions lists the authenticated user's signed-in devices
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+	sessionID := r.Context().Value("session_id").(int64)
+
+	sessions, err := h.service.ListSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeSession signs one of the authenticated user's devices out
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	vars := mux.Vars(r)
+	sessionID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RevokeOtherSessions signs out every device except the one making the
+// request
+func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+	sessionID := r.Context().Value("session_id").(int64)
+
+	if err := h.service.RevokeOtherSessions(r.Context(), userID, sessionID); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Other sessions revoked successfully", nil)
+}
+
+// VerifyEmail verifies the email address a verification link was sent to
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Email verified successfully", nil)
+}
+
+// ResendVerificationEmail sends the authenticated user a new verification
+// link
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int64)
+
+	if err := h.service.ResendVerificationEmail(r.Context(), userID); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Verification email sent", nil)
+}
+
+// ForgotPassword emails a password reset link
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), req.Email); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to process request")
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "If the email is registered, a password reset link has been sent", nil)
+}
+
+// ResetPassword sets a new password using a password reset token
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateStruct(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), &req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(w, http.StatusOK, "Password reset successfully", nil)
 }
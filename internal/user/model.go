@@ -12,9 +12,12 @@ type User struct {
 	FirstName    string    `json:"first_name" db:"first_name"`
 	LastName     string    `json:"last_name" db:"last_name"`
 	PhoneNumber  string    `json:"phone_number,omitempty" db:"phone_number"`
+	Locale       string    `json:"locale,omitempty" db:"locale"` // language of notifications, empty for the default
 	Role         string    `json:"role" db:"role"` // admin, customer
 	IsActive     bool      `json:"is_active" db:"is_active"`
 	EmailVerified bool     `json:"email_verified" db:"email_verified"`
+	FailedLoginAttempts int `json:"-" db:"failed_login_attempts"`
+	LockedUntil  *time.Time `json:"-" db:"locked_until"` // set while logins are refused after repeated failures
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -26,6 +29,7 @@ type SignupRequest struct {
 	FirstName   string `json:"first_name" validate:"required"`
 	LastName    string `json:"last_name" validate:"required"`
 	PhoneNumber string `json:"phone_number,omitempty"`
+	Locale      string `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
 }
 
 // LoginRequest represents the login request payload
@@ -46,6 +50,7 @@ type UpdateProfileRequest struct {
 	FirstName   string `json:"first_name,omitempty"`
 	LastName    string `json:"last_name,omitempty"`
 	PhoneNumber string `json:"phone_number,omitempty"`
+	Locale      string `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
 }
 
 // ChangePasswordRequest represents the change password request
@@ -58,3 +63,32 @@ type ChangePasswordRequest struct {
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
+
+// RefreshTokenResponse represents the refresh token response. The refresh
+// token replaces the one that was sent.
+type RefreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Purposes of the single-use tokens sent to users by email
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+// VerifyEmailRequest represents the verify email request
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ForgotPasswordRequest represents the forgot password request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents the reset password request
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
@@ -1,11 +1,17 @@
 package user
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// ErrInvalidToken is returned for unknown, expired or already used email
+// tokens
+var ErrInvalidToken = errors.New("invalid or expired token")
+
 type Repository struct {
 	db *sql.DB
 }
@@ -15,20 +21,22 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 // Create creates a new user
-func (r *Repository) Create(user *User) error {
+func (r *Repository) Create(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (email, password, first_name, last_name, phone_number, role, is_active, email_verified, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO users (email, password, first_name, last_name, phone_number, locale, role, is_active, email_verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		user.Email,
 		user.Password,
 		user.FirstName,
 		user.LastName,
 		user.PhoneNumber,
+		user.Locale,
 		user.Role,
 		user.IsActive,
 		user.EmailVerified,
@@ -44,24 +52,27 @@ func (r *Repository) Create(user *User) error {
 }
 
 // GetByID retrieves a user by ID
-func (r *Repository) GetByID(id int64) (*User, error) {
+func (r *Repository) GetByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT id, email, password, first_name, last_name, phone_number, role, is_active, email_verified, created_at, updated_at
+		SELECT id, email, password, first_name, last_name, phone_number, locale, role, is_active, email_verified, failed_login_attempts, locked_until, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
 
 	user := &User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
 		&user.FirstName,
 		&user.LastName,
 		&user.PhoneNumber,
+		&user.Locale,
 		&user.Role,
 		&user.IsActive,
 		&user.EmailVerified,
+		&user.FailedLoginAttempts,
+		&user.LockedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -77,24 +88,27 @@ func (r *Repository) GetByID(id int64) (*User, error) {
 }
 
 // GetByEmail retrieves a user by email
-func (r *Repository) GetByEmail(email string) (*User, error) {
+func (r *Repository) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, email, password, first_name, last_name, phone_number, role, is_active, email_verified, created_at, updated_at
+		SELECT id, email, password, first_name, last_name, phone_number, locale, role, is_active, email_verified, failed_login_attempts, locked_until, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 
 	user := &User{}
-	err := r.db.QueryRow(query, email).Scan(
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
 		&user.FirstName,
 		&user.LastName,
 		&user.PhoneNumber,
+		&user.Locale,
 		&user.Role,
 		&user.IsActive,
 		&user.EmailVerified,
+		&user.FailedLoginAttempts,
+		&user.LockedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -110,14 +124,14 @@ func (r *Repository) GetByEmail(email string) (*User, error) {
 }
 
 // Update updates a user's information
-func (r *Repository) Update(user *User) error {
+func (r *Repository) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
-		SET first_name = $1, last_name = $2, phone_number = $3, updated_at = $4
-		WHERE id = $5
+		SET first_name = $1, last_name = $2, phone_number = $3, locale = $4, updated_at = $5
+		WHERE id = $6
 	`
 
-	_, err := r.db.Exec(query, user.FirstName, user.LastName, user.PhoneNumber, time.Now(), user.ID)
+	_, err := r.db.ExecContext(ctx, query, user.FirstName, user.LastName, user.PhoneNumber, user.Locale, time.Now(), user.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -125,15 +139,15 @@ func (r *Repository) Update(user *User) error {
 	return nil
 }
 
-// UpdatePassword updates a user's password
-func (r *Repository) UpdatePassword(userID int64, hashedPassword string) error {
+// UpdatePassword updates a user's password and lifts any login lock
+func (r *Repository) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
 	query := `
 		UPDATE users
-		SET password = $1, updated_at = $2
+		SET password = $1, failed_login_attempts = 0, locked_until = NULL, updated_at = $2
 		WHERE id = $3
 	`
 
-	_, err := r.db.Exec(query, hashedPassword, time.Now(), userID)
+	_, err := r.db.ExecContext(ctx, query, hashedPassword, time.Now(), userID)
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
@@ -141,15 +155,55 @@ func (r *Repository) UpdatePassword(userID int64, hashedPassword string) error {
 	return nil
 }
 
+// RecordFailedLogin counts a failed login and returns the number of
+// consecutive failures
+func (r *Repository) RecordFailedLogin(ctx context.Context, userID int64) (int, error) {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = failed_login_attempts + 1
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`
+
+	var attempts int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&attempts); err != nil {
+		return 0, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// LockUntil refuses logins to a user until the given time
+func (r *Repository) LockUntil(ctx context.Context, userID int64, until time.Time) error {
+	query := `UPDATE users SET locked_until = $1 WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, until, userID); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	return nil
+}
+
+// ResetFailedLogins clears the failed login count and lock of a user
+func (r *Repository) ResetFailedLogins(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	return nil
+}
+
 // Delete soft deletes a user
-func (r *Repository) Delete(id int64) error {
+func (r *Repository) Delete(ctx context.Context, id int64) error {
 	query := `
 		UPDATE users
 		SET is_active = false, updated_at = $1
 		WHERE id = $2
 	`
 
-	_, err := r.db.Exec(query, time.Now(), id)
+	_, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -158,14 +212,67 @@ func (r *Repository) Delete(id int64) error {
 }
 
 // EmailExists checks if an email already exists
-func (r *Repository) EmailExists(email string) (bool, error) {
+func (r *Repository) EmailExists(ctx context.Context, email string) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
 
 	var exists bool
-	err := r.db.QueryRow(query, email).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check email existence: %w", err)
 	}
 
 	return exists, nil
 }
+
+// MarkEmailVerified marks a user's email address as verified
+func (r *Repository) MarkEmailVerified(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET email_verified = true, updated_at = $1 WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// CreateToken stores the hash of a single-use token. Unused tokens the user
+// was sent earlier for the same purpose stop working.
+func (r *Repository) CreateToken(ctx context.Context, userID int64, purpose, tokenHash string, expiresAt time.Time) error {
+	query := `
+		WITH superseded AS (
+			UPDATE user_tokens SET used_at = $5
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+		)
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, purpose, tokenHash, expiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeToken marks a token as used and returns the user it was issued to
+func (r *Repository) ConsumeToken(ctx context.Context, purpose, tokenHash string) (int64, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id
+	`
+
+	var userID int64
+	err := r.db.QueryRowContext(ctx, query, time.Now(), tokenHash, purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume token: %w", err)
+	}
+
+	return userID, nil
+}
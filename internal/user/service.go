@@ -1,28 +1,50 @@
 package user
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"ecommerce_project/internal/auth"
+	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/logger"
 	"ecommerce_project/pkg/utils"
 )
 
 type Service struct {
-	repo        *Repository
-	authService *auth.Service
+	repo          *Repository
+	authService   *auth.Service
+	notifications Notifier
+	baseURL       string
+	authConfig    *config.AuthConfig
 }
 
-func NewService(repo *Repository, authService *auth.Service) *Service {
+// Notifier sends the account emails to a user's current address. It is
+// implemented by notification.Service.
+type Notifier interface {
+	SendWelcome(ctx context.Context, userID int64, name string) error
+	SendEmailVerification(ctx context.Context, userID int64, name, verifyURL string, expiresIn time.Duration) error
+	SendPasswordReset(ctx context.Context, userID int64, resetURL string, expiresIn time.Duration) error
+}
+
+// NewService creates the user service. baseURL is the storefront URL that
+// email links point to.
+func NewService(repo *Repository, authService *auth.Service, notifications Notifier, baseURL string, authConfig *config.AuthConfig) *Service {
 	return &Service{
-		repo:        repo,
-		authService: authService,
+		repo:          repo,
+		authService:   authService,
+		notifications: notifications,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		authConfig:    authConfig,
 	}
 }
 
 // Signup creates a new user account
-func (s *Service) Signup(req *SignupRequest) (*User, error) {
+func (s *Service) Signup(ctx context.Context, req *SignupRequest) (*User, error) {
 	// Check if email already exists
-	exists, err := s.repo.EmailExists(req.Email)
+	exists, err := s.repo.EmailExists(ctx, req.Email)
 	if err != nil {
 		return nil, err
 	}
@@ -43,24 +65,35 @@ func (s *Service) Signup(req *SignupRequest) (*User, error) {
 		FirstName:     req.FirstName,
 		LastName:      req.LastName,
 		PhoneNumber:   req.PhoneNumber,
+		Locale:        req.Locale,
 		Role:          "customer",
 		IsActive:      true,
 		EmailVerified: false,
 	}
 
-	if err := s.repo.Create(user); err != nil {
+	if err := s.repo.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
+	// Emails are queued in the outbox and a failure to queue them must not
+	// fail the signup; the user can ask for a new verification link
+	if err := s.notifications.SendWelcome(ctx, user.ID, user.FirstName); err != nil {
+		logger.Error("Failed to queue welcome email", "user_id", user.ID, "error", err)
+	}
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		logger.Error("Failed to queue verification email", "user_id", user.ID, "error", err)
+	}
+
 	// Clear password before returning
 	user.Password = ""
 	return user, nil
 }
 
-// Login authenticates a user and returns tokens
-func (s *Service) Login(req *LoginRequest) (*LoginResponse, error) {
+// Login authenticates a user, starts a session for the device and returns
+// tokens
+func (s *Service) Login(ctx context.Context, req *LoginRequest, userAgent, ipAddress string) (*LoginResponse, error) {
 	// Get user by email
-	user, err := s.repo.GetByEmail(req.Email)
+	user, err := s.repo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		return nil, fmt.Errorf("invalid email or password")
 	}
@@ -70,20 +103,37 @@ func (s *Service) Login(req *LoginRequest) (*LoginResponse, error) {
 		return nil, fmt.Errorf("account is inactive")
 	}
 
+	// Refuse locked accounts before checking the password, so that a
+	// locked account does not reveal whether a guess was right. The error
+	// is the one unknown emails get, so that locks do not reveal which
+	// addresses are registered.
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, fmt.Errorf("invalid email or password")
+	}
+
 	// Verify password
 	if !utils.CheckPassword(req.Password, user.Password) {
+		if err := s.recordFailedLogin(ctx, user); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("invalid email or password")
 	}
 
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	// Generate tokens
-	token, err := s.authService.GenerateToken(user.ID, user.Email, user.Role)
+	session, refreshToken, err := s.authService.CreateSession(ctx, user.ID, userAgent, ipAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 
-	refreshToken, err := s.authService.GenerateRefreshToken(user.ID)
+	token, err := s.authService.GenerateToken(user.ID, user.Email, user.Role, session.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
 	// Clear password before returning
@@ -96,9 +146,43 @@ func (s *Service) Login(req *LoginRequest) (*LoginResponse, error) {
 	}, nil
 }
 
+// recordFailedLogin counts a failed login and locks the account once the
+// failures reach the lockout threshold. Each failure after an expired lock
+// doubles the next lock, up to the configured maximum.
+func (s *Service) recordFailedLogin(ctx context.Context, user *User) error {
+	attempts, err := s.repo.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	threshold := s.authConfig.LockoutThreshold
+	if threshold <= 0 || attempts < threshold {
+		return nil
+	}
+
+	lock := LockoutDuration(attempts-threshold, time.Duration(s.authConfig.LockoutSeconds)*time.Second, time.Duration(s.authConfig.LockoutMaxSeconds)*time.Second)
+	logger.Warn("Locking account after failed logins", "user_id", user.ID, "attempts", attempts, "duration", lock.String())
+
+	return s.repo.LockUntil(ctx, user.ID, time.Now().Add(lock))
+}
+
+// LockoutDuration returns how long an account is locked after the given
+// number of failures beyond the lockout threshold: base, doubled for every
+// further failure, capped at max
+func LockoutDuration(failuresBeyondThreshold int, base, max time.Duration) time.Duration {
+	lock := base
+	for i := 0; i < failuresBeyondThreshold && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		lock = max
+	}
+	return lock
+}
+
 // GetProfile retrieves a user's profile
-func (s *Service) GetProfile(userID int64) (*User, error) {
-	user, err := s.repo.GetByID(userID)
+func (s *Service) GetProfile(ctx context.Context, userID int64) (*User, error) {
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,8 +193,8 @@ func (s *Service) GetProfile(userID int64) (*User, error) {
 }
 
 // UpdateProfile updates a user's profile
-func (s *Service) UpdateProfile(userID int64, req *UpdateProfileRequest) (*User, error) {
-	user, err := s.repo.GetByID(userID)
+func (s *Service) UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) (*User, error) {
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -125,8 +209,11 @@ func (s *Service) UpdateProfile(userID int64, req *UpdateProfileRequest) (*User,
 	if req.PhoneNumber != "" {
 		user.PhoneNumber = req.PhoneNumber
 	}
+	if req.Locale != "" {
+		user.Locale = req.Locale
+	}
 
-	if err := s.repo.Update(user); err != nil {
+	if err := s.repo.Update(ctx, user); err != nil {
 		return nil, err
 	}
 
@@ -135,8 +222,8 @@ func (s *Service) UpdateProfile(userID int64, req *UpdateProfileRequest) (*User,
 }
 
 // ChangePassword changes a user's password
-func (s *Service) ChangePassword(userID int64, req *ChangePasswordRequest) error {
-	user, err := s.repo.GetByID(userID)
+func (s *Service) ChangePassword(ctx context.Context, userID int64, req *ChangePasswordRequest) error {
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
 		return err
 	}
@@ -152,25 +239,156 @@ func (s *Service) ChangePassword(userID int64, req *ChangePasswordRequest) error
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	return s.repo.UpdatePassword(userID, hashedPassword)
+	return s.repo.UpdatePassword(ctx, userID, hashedPassword)
 }
 
-// RefreshToken generates a new access token from refresh token
-func (s *Service) RefreshToken(refreshToken string) (string, error) {
-	userID, err := s.authService.ValidateRefreshToken(refreshToken)
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token cannot be used again.
+func (s *Service) RefreshToken(ctx context.Context, refreshToken, userAgent, ipAddress string) (*RefreshTokenResponse, error) {
+	rotated, newRefreshToken, err := s.authService.RotateRefreshToken(ctx, refreshToken, userAgent, ipAddress)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	user, err := s.repo.GetByID(userID)
+	user, err := s.repo.GetByID(ctx, rotated.UserID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	if !user.IsActive {
+		return nil, fmt.Errorf("account is inactive")
+	}
+
+	token, err := s.authService.GenerateToken(user.ID, user.Email, user.Role, rotated.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &RefreshTokenResponse{
+		Token:        token,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// Logout ends the session of a refresh token
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	return s.authService.RevokeRefreshToken(ctx, refreshToken)
+}
+
+// ListSessions retrieves the user's signed-in devices
+func (s *Service) ListSessions(ctx context.Context, userID, currentSessionID int64) ([]auth.Session, error) {
+	return s.authService.ListSessions(ctx, userID, currentSessionID)
+}
 
-	token, err := s.authService.GenerateToken(user.ID, user.Email, user.Role)
+// RevokeSession signs one of the user's devices out
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	return s.authService.RevokeSession(ctx, userID, sessionID)
+}
+
+// RevokeOtherSessions signs out every device except the current one
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentSessionID int64) error {
+	return s.authService.RevokeOtherSessions(ctx, userID, currentSessionID)
+}
+
+// ResendVerificationEmail sends a new email verification link to the user
+func (s *Service) ResendVerificationEmail(ctx context.Context, userID int64) error {
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return err
+	}
+
+	if user.EmailVerified {
+		return fmt.Errorf("email is already verified")
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail marks the email address of the token's user as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.repo.ConsumeToken(ctx, TokenEmailVerification, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	return s.repo.MarkEmailVerified(ctx, userID)
+}
+
+// ForgotPassword emails a password reset link. It succeeds whether or not
+// the email belongs to an account so that it cannot be used to find out
+// which addresses are registered.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil || !user.IsActive {
+		return nil
+	}
+
+	ttl := time.Duration(s.authConfig.PasswordResetTTLMinutes) * time.Minute
+	token, err := s.issueToken(ctx, user.ID, TokenPasswordReset, ttl)
+	if err != nil {
+		return err
+	}
+
+	if err := s.notifications.SendPasswordReset(ctx, user.ID, s.link("/reset-password", token), ttl); err != nil {
+		logger.Error("Failed to queue password reset email", "user_id", user.ID, "error", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a password reset token and signs
+// the user out everywhere
+func (s *Service) ResetPassword(ctx context.Context, req *ResetPasswordRequest) error {
+	userID, err := s.repo.ConsumeToken(ctx, TokenPasswordReset, utils.HashToken(req.Token))
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Setting the password also lifts a lock left by failed logins, so a
+	// locked out user can sign in again right after the reset
+	if err := s.repo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	// The reset link was delivered to the mailbox, which proves the user
+	// owns the address
+	if err := s.repo.MarkEmailVerified(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.authService.RevokeOtherSessions(ctx, userID, 0)
+}
+
+// sendVerificationEmail issues an email verification token and mails it
+func (s *Service) sendVerificationEmail(ctx context.Context, user *User) error {
+	ttl := time.Duration(s.authConfig.EmailVerificationTTLHours) * time.Hour
+	token, err := s.issueToken(ctx, user.ID, TokenEmailVerification, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.notifications.SendEmailVerification(ctx, user.ID, user.FirstName, s.link("/verify-email", token), ttl)
+}
+
+// issueToken creates a single-use token and stores its hash
+func (s *Service) issueToken(ctx context.Context, userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.CreateToken(ctx, userID, purpose, hash, time.Now().Add(ttl)); err != nil {
+		return "", err
 	}
 
 	return token, nil
 }
+
+// link builds a storefront URL that carries a token
+func (s *Service) link(path, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
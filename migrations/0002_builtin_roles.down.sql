@@ -0,0 +1,16 @@
+-- Role grants and role permissions are removed by ON DELETE CASCADE
+DELETE FROM roles WHERE name IN ('admin', 'inventory_manager', 'support');
+
+DELETE FROM permissions WHERE name IN (
+    'products:write',
+    'categories:write',
+    'orders:read',
+    'orders:fulfil',
+    'orders:cancel',
+    'payments:read',
+    'payments:refund',
+    'inventory:read',
+    'inventory:write',
+    'roles:manage',
+    'notifications:manage'
+);
@@ -0,0 +1,34 @@
+-- Built-in roles and permissions
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access to the admin API'),
+    ('inventory_manager', 'Manages stock levels and fulfils orders'),
+    ('support', 'Looks up orders and payments and cancels orders for customers')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('products:write', 'Create, update and delete products'),
+    ('categories:write', 'Create, update and delete categories'),
+    ('orders:read', 'List all orders'),
+    ('orders:fulfil', 'Confirm, ship and deliver orders'),
+    ('orders:cancel', 'Cancel orders'),
+    ('payments:read', 'View payments and refunds'),
+    ('payments:refund', 'Refund payments'),
+    ('inventory:read', 'View inventory'),
+    ('inventory:write', 'Update inventory'),
+    ('roles:manage', 'Grant and revoke roles'),
+    ('notifications:manage', 'Preview notification templates')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON
+    r.name = 'admin'
+    OR (r.name = 'inventory_manager' AND p.name IN ('inventory:read', 'inventory:write', 'orders:read', 'orders:fulfil'))
+    OR (r.name = 'support' AND p.name IN ('orders:read', 'orders:cancel', 'payments:read'))
+ON CONFLICT DO NOTHING;
+
+-- Users created with users.role = 'admin' before roles existed
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = u.role
+ON CONFLICT DO NOTHING;
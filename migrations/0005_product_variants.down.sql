@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_cart_items_variant;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE inventory_reservations DROP COLUMN IF EXISTS variant_id;
+
+-- Only the stock of default variants maps back to a product
+DELETE FROM inventory i USING product_variants v WHERE v.id = i.variant_id AND NOT v.is_default;
+DROP INDEX IF EXISTS idx_inventory_product;
+ALTER TABLE inventory DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE inventory ADD CONSTRAINT inventory_product_id_key UNIQUE (product_id);
+
+DROP TABLE IF EXISTS product_variant_option_values;
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_option_values;
+DROP TABLE IF EXISTS product_option_types;
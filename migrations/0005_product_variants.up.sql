@@ -0,0 +1,82 @@
+-- Product options, such as size and color, and their values
+CREATE TABLE IF NOT EXISTS product_option_types (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(product_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS product_option_values (
+    id BIGSERIAL PRIMARY KEY,
+    option_type_id BIGINT NOT NULL REFERENCES product_option_types(id) ON DELETE CASCADE,
+    value VARCHAR(50) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE(option_type_id, value)
+);
+
+-- Sellable variants of a product. Every product has a default variant
+-- without options; a NULL price falls back to the product price.
+-- option_key lists the sorted option value IDs so that a combination is
+-- sold by one variant only.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(100) UNIQUE NOT NULL,
+    price DECIMAL(10, 2),
+    image_urls TEXT[] NOT NULL DEFAULT '{}',
+    option_key VARCHAR(255) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(product_id, option_key)
+);
+
+CREATE TABLE IF NOT EXISTS product_variant_option_values (
+    variant_id BIGINT NOT NULL REFERENCES product_variants(id) ON DELETE CASCADE,
+    option_value_id BIGINT NOT NULL REFERENCES product_option_values(id) ON DELETE CASCADE,
+    PRIMARY KEY (variant_id, option_value_id)
+);
+
+INSERT INTO product_variants (product_id, sku, is_default, is_active, created_at, updated_at)
+SELECT id, sku, true, true, created_at, updated_at FROM products
+ON CONFLICT DO NOTHING;
+
+-- Stock is kept per variant
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS variant_id BIGINT REFERENCES product_variants(id) ON DELETE CASCADE;
+UPDATE inventory i SET variant_id = v.id
+FROM product_variants v
+WHERE v.product_id = i.product_id AND v.is_default AND i.variant_id IS NULL;
+DELETE FROM inventory WHERE variant_id IS NULL;
+ALTER TABLE inventory ALTER COLUMN variant_id SET NOT NULL;
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS inventory_product_id_key;
+
+INSERT INTO inventory (product_id, variant_id, quantity, reserved)
+SELECT v.product_id, v.id, 0, 0 FROM product_variants v
+WHERE NOT EXISTS (SELECT 1 FROM inventory i WHERE i.variant_id = v.id);
+
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS variant_id BIGINT REFERENCES product_variants(id) ON DELETE CASCADE;
+UPDATE inventory_reservations r SET variant_id = v.id
+FROM product_variants v
+WHERE v.product_id = r.product_id AND v.is_default AND r.variant_id IS NULL;
+
+-- Cart and order items refer to the variant sold
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id BIGINT REFERENCES product_variants(id) ON DELETE CASCADE;
+UPDATE cart_items c SET variant_id = v.id
+FROM product_variants v
+WHERE v.product_id = c.product_id AND v.is_default AND c.variant_id IS NULL;
+DELETE FROM cart_items WHERE variant_id IS NULL;
+ALTER TABLE cart_items ALTER COLUMN variant_id SET NOT NULL;
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id BIGINT REFERENCES product_variants(id);
+UPDATE order_items o SET variant_id = v.id
+FROM product_variants v
+WHERE v.product_id = o.product_id AND v.is_default AND o.variant_id IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inventory_variant ON inventory(variant_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_product ON inventory(product_id);
+CREATE INDEX IF NOT EXISTS idx_product_option_types_product ON product_option_types(product_id);
+CREATE INDEX IF NOT EXISTS idx_product_variant_option_values_value ON product_variant_option_values(option_value_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_variant ON cart_items(cart_id, variant_id);
@@ -0,0 +1,12 @@
+CREATE INDEX IF NOT EXISTS idx_inventory_product ON inventory(product_id);
+DROP INDEX IF EXISTS idx_inventory_product_variant;
+DROP INDEX IF EXISTS idx_products_active_created;
+
+CREATE INDEX IF NOT EXISTS idx_reviews_product ON reviews(product_id);
+DROP INDEX IF EXISTS idx_reviews_product_created;
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+DROP INDEX IF EXISTS idx_orders_status_created;
+DROP INDEX IF EXISTS idx_orders_user_created;
+DROP INDEX IF EXISTS idx_orders_created;
@@ -0,0 +1,16 @@
+-- Indexes matching the order of paginated lists, so that a page after a
+-- cursor is read by seeking instead of scanning the preceding rows. They
+-- replace the single-column indexes they start with.
+CREATE INDEX IF NOT EXISTS idx_orders_created ON orders(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_user_created ON orders(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_status_created ON orders(status, created_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_orders_user;
+DROP INDEX IF EXISTS idx_orders_status;
+
+CREATE INDEX IF NOT EXISTS idx_reviews_product_created ON reviews(product_id, created_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_reviews_product;
+
+CREATE INDEX IF NOT EXISTS idx_products_active_created ON products(created_at DESC, id DESC) WHERE is_active = true;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_product_variant ON inventory(product_id, variant_id);
+DROP INDEX IF EXISTS idx_inventory_product;
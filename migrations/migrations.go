@@ -0,0 +1,11 @@
+// Package migrations holds the versioned SQL migrations of the database
+// schema. Each migration is a pair of files, NNNN_name.up.sql and
+// NNNN_name.down.sql, applied in order of their version number.
+package migrations
+
+import "embed"
+
+// FS contains the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBucket rate limits by key. Each bucket holds up to capacity tokens,
+// starts full and regains one token every interval.
+type TokenBucket interface {
+	// Take removes a token from the bucket of key. When the bucket is
+	// empty it reports false and how long until a token is available.
+	Take(ctx context.Context, key string, capacity int, interval time.Duration) (bool, time.Duration, error)
+}
+
+// takeScript refills and takes from a bucket atomically, using the clock
+// of the Redis server so that API instances agree on the time
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / interval)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * interval)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity * interval / 1000) + 1000)
+
+return {allowed, wait}
+`)
+
+// Take removes a token from the bucket of key
+func (r *Redis) Take(ctx context.Context, key string, capacity int, interval time.Duration) (bool, time.Duration, error) {
+	result, err := takeScript.Run(ctx, r.client, []string{key}, capacity, interval.Microseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Microsecond, nil
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// refill is how long the bucket takes to fill up from empty
+	refill time.Duration
+}
+
+// bucketSweepInterval is how often Memory forgets buckets that are full
+// again, so that one-off clients do not accumulate
+const bucketSweepInterval = time.Minute
+
+// Take removes a token from the bucket of key
+func (m *Memory) Take(ctx context.Context, key string, capacity int, interval time.Duration) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.swept) >= bucketSweepInterval {
+		for k, b := range m.buckets {
+			if now.Sub(b.updated) >= b.refill {
+				delete(m.buckets, k)
+			}
+		}
+		m.swept = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), updated: now, refill: time.Duration(capacity) * interval}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(capacity), b.tokens+float64(now.Sub(b.updated))/float64(interval))
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	return false, time.Duration(math.Ceil((1 - b.tokens) * float64(interval))), nil
+}
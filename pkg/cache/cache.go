@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ecommerce_project/pkg/logger"
+)
+
+// ErrMiss is returned by Cache.Get when a key is not cached
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores values by key with an expiry. Redis backs it in production
+// and Memory in tests and single-instance setups.
+type Cache interface {
+	// Get returns the value of key, or ErrMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys; missing keys are ignored
+	Delete(ctx context.Context, keys ...string) error
+	// Incr increments the integer stored under key, starting from zero,
+	// and returns the new value. The key does not expire.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Remember decodes the cached JSON value of key into dest. On a miss it
+// calls load, which must fill dest, and caches dest for ttl. A failing
+// cache is logged and bypassed so that reads still reach the database.
+func Remember(ctx context.Context, c Cache, key string, ttl time.Duration, dest interface{}, load func() error) error {
+	if c == nil {
+		return load()
+	}
+
+	data, err := c.Get(ctx, key)
+	if err == nil {
+		if err := json.Unmarshal(data, dest); err == nil {
+			return nil
+		}
+		logger.Warn("Discarding undecodable cache entry", "key", key)
+	} else if !errors.Is(err, ErrMiss) {
+		logger.Warn("Cache read failed", "key", key, "error", err)
+	}
+
+	if err := load(); err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(dest)
+	if err != nil {
+		logger.Warn("Failed to encode cache entry", "key", key, "error", err)
+		return nil
+	}
+	if err := c.Set(ctx, key, data, ttl); err != nil {
+		logger.Warn("Cache write failed", "key", key, "error", err)
+	}
+
+	return nil
+}
+
+// Invalidate deletes keys, logging failures. Entries that could not be
+// deleted expire with their TTL.
+func Invalidate(ctx context.Context, c Cache, keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	if err := c.Delete(ctx, keys...); err != nil {
+		logger.Warn("Cache invalidation failed", "keys", keys, "error", err)
+	}
+}
+
+// Generation returns the current value of a generation counter. Embedding
+// it in keys lets Bump invalidate a whole family of entries, such as every
+// filtered product listing, at once.
+func Generation(ctx context.Context, c Cache, key string) string {
+	if c == nil {
+		return "0"
+	}
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrMiss) {
+			logger.Warn("Cache read failed", "key", key, "error", err)
+		}
+		return "0"
+	}
+	return string(data)
+}
+
+// Bump advances a generation counter, orphaning the entries keyed by its
+// previous value
+func Bump(ctx context.Context, c Cache, key string) {
+	if c == nil {
+		return
+	}
+	if _, err := c.Incr(ctx, key); err != nil {
+		logger.Warn("Cache invalidation failed", "keys", []string{key}, "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Memory is an in-process Cache and TokenBucket. Entries are not shared between
+// instances, so it suits tests and single-instance deployments.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewMemory creates an empty in-memory cache
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry), buckets: make(map[string]*bucket)}
+}
+
+// Get returns the value of key, or ErrMiss
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, ErrMiss
+	}
+
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores value under key for ttl; a ttl of zero never expires
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	m.entries[key] = entry
+
+	return nil
+}
+
+// Delete removes keys
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+
+	return nil
+}
+
+// Incr increments the integer stored under key
+func (m *Memory) Incr(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var value int64
+	if entry, ok := m.entries[key]; ok {
+		var err error
+		if value, err = strconv.ParseInt(string(entry.value), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	value++
+	m.entries[key] = memoryEntry{value: []byte(strconv.FormatInt(value, 10))}
+
+	return value, nil
+}
@@ -18,6 +18,10 @@ func NewConnection(cfg config.RedisConfig) (*redis.Client, error) {
 		Addr:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
 		Password: cfg.Password,
 		DB:       cfg.DB,
+		// Fail fast so that an unreachable Redis only costs cache hits
+		DialTimeout:  2 * time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
 	})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -30,6 +34,41 @@ func NewConnection(cfg config.RedisConfig) (*redis.Client, error) {
 	return client, nil
 }
 
+// Redis is a Cache and TokenBucket stored in Redis, shared by all API
+// instances
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis creates a cache using client
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// Get returns the value of key, or ErrMiss
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+// Set stores value under key for ttl
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete removes keys
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Incr increments the integer stored under key
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
+}
+
 // Get returns the Redis client instance
 func Get() *redis.Client {
 	return client
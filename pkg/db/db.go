@@ -1,50 +1,144 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/lib/pq"
 
 	"ecommerce_project/internal/config"
 )
 
-var db *sql.DB
+// DB is the connection pool of the primary database together with the
+// pools of its read replicas
+type DB struct {
+	*sql.DB
+	replicas []*sql.DB
+	next     atomic.Uint32
+}
+
+// PoolHealth reports whether a pool answered a ping and its statistics
+type PoolHealth struct {
+	Name  string
+	Err   error
+	Stats sql.DBStats
+}
+
+// New wraps the pool of a primary database and the pools of its read
+// replicas
+func New(primary *sql.DB, replicas ...*sql.DB) *DB {
+	return &DB{DB: primary, replicas: replicas}
+}
+
+// NewConnection creates a new database connection, and one for every
+// configured read replica
+func NewConnection(cfg config.DatabaseConfig) (*DB, error) {
+	primary, err := open(cfg, cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, err
+	}
+	database := New(primary)
+
+	for _, host := range cfg.ReplicaHosts {
+		replicaHost, replicaPort := host, cfg.Port
+		if h, p, err := net.SplitHostPort(host); err == nil {
+			replicaHost, replicaPort = h, p
+		}
+
+		replica, err := open(cfg, replicaHost, replicaPort)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("replica %s: %w", host, err)
+		}
+		database.replicas = append(database.replicas, replica)
+	}
+
+	if cfg.AutoMigrate {
+		migrator, err := NewDefaultMigrator(primary)
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+		if _, err := migrator.Up(0); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
 
-// NewConnection creates a new database connection
-func NewConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
+	return database, nil
+}
+
+// open connects to one server and applies the pool settings
+func open(cfg config.DatabaseConfig, host, port string) (*sql.DB, error) {
 	connStr := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
+		host, port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
 
-	var err error
-	db, err = sql.Open("postgres", connStr)
+	// Queries are cancelled through their context when a request ends; the
+	// statement timeout also bounds queries whose caller keeps waiting
+	if cfg.QueryTimeout > 0 {
+		connStr += fmt.Sprintf(" statement_timeout=%d", cfg.QueryTimeout*1000)
+	}
+
+	conn, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// Set connection pool settings
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	conn.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
+
 	// Test connection
-	if err = db.Ping(); err != nil {
+	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
+	return conn, nil
+}
 
-	return db, nil
+// Reader returns the pool for read-only queries that tolerate replication
+// lag. Replicas are used in turn; without replicas it is the primary.
+func (d *DB) Reader() *sql.DB {
+	if len(d.replicas) == 0 {
+		return d.DB
+	}
+	n := d.next.Add(1)
+	return d.replicas[int(n-1)%len(d.replicas)]
 }
 
-// Close closes the database connection
-func Close() error {
-	if db != nil {
-		return db.Close()
+// Health pings the primary and every replica and returns their pool
+// statistics, primary first
+func (d *DB) Health(ctx context.Context) []PoolHealth {
+	pools := append([]*sql.DB{d.DB}, d.replicas...)
+	health := make([]PoolHealth, len(pools))
+
+	for i, pool := range pools {
+		name := "primary"
+		if i > 0 {
+			name = fmt.Sprintf("replica_%d", i)
+		}
+		health[i] = PoolHealth{Name: name, Err: pool.PingContext(ctx), Stats: pool.Stats()}
 	}
-	return nil
+
+	return health
 }
 
-// Get returns the database instance
-func Get() *sql.DB {
-	return db
+// Close closes the primary and replica connections
+func (d *DB) Close() error {
+	err := d.DB.Close()
+	for _, replica := range d.replicas {
+		if closeErr := replica.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
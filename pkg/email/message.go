@@ -0,0 +1,232 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// base64LineLength is the maximum line length of base64 encoded parts
+const base64LineLength = 76
+
+// Message is an email to send. At least one of HTMLBody and TextBody must
+// be set; with both, clients choose the part they can display.
+type Message struct {
+	To          []string
+	Subject     string
+	HTMLBody    string
+	TextBody    string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email, such as an invoice PDF
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// build renders msg as an RFC 5322 message sent by from. Headers are
+// written in a fixed order and non-ASCII text is encoded per RFC 2047.
+func build(from *mail.Address, msg *Message) ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("email has no recipients")
+	}
+	if msg.HTMLBody == "" && msg.TextBody == "" {
+		return nil, fmt.Errorf("email has no body")
+	}
+
+	to := make([]string, 0, len(msg.To))
+	for _, recipient := range msg.To {
+		addr, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, addr.String())
+	}
+
+	messageID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	body, contentType, err := buildBody(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from.String())
+	writeHeader(&buf, "To", strings.Join(to, ", "))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+	writeHeader(&buf, "Content-Type", contentType)
+	if !strings.HasPrefix(contentType, "multipart/") {
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// buildBody returns the body of msg and its Content-Type. A single body is
+// sent as is; HTML with a text alternative is wrapped in
+// multipart/alternative, plain text first as RFC 2046 requires; attachments
+// wrap everything in multipart/mixed.
+func buildBody(msg *Message) ([]byte, string, error) {
+	content, contentType, err := buildContent(msg)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(msg.Attachments) == 0 {
+		return content, contentType, nil
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := textproto.MIMEHeader{"Content-Type": {contentType}}
+	if !strings.HasPrefix(contentType, "multipart/") {
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+	}
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, "", err
+	}
+
+	for _, attachment := range msg.Attachments {
+		if err := writeAttachment(mw, attachment); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "multipart/mixed; boundary=" + mw.Boundary(), nil
+}
+
+// buildContent returns the readable part of msg: quoted-printable text or
+// HTML, or a multipart/alternative of both
+func buildContent(msg *Message) ([]byte, string, error) {
+	if msg.TextBody == "" || msg.HTMLBody == "" {
+		contentType, content := `text/html; charset="utf-8"`, msg.HTMLBody
+		if msg.HTMLBody == "" {
+			contentType, content = `text/plain; charset="utf-8"`, msg.TextBody
+		}
+
+		encoded, err := quotedPrintable(content)
+		return encoded, contentType, err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	if err := writeTextPart(mw, `text/plain; charset="utf-8"`, msg.TextBody); err != nil {
+		return nil, "", err
+	}
+	if err := writeTextPart(mw, `text/html; charset="utf-8"`, msg.HTMLBody); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "multipart/alternative; boundary=" + mw.Boundary(), nil
+}
+
+// writeTextPart adds a quoted-printable encoded part, which keeps
+// non-ASCII text and long lines within SMTP limits
+func writeTextPart(mw *multipart.Writer, contentType, content string) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded, err := quotedPrintable(content)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(encoded)
+	return err
+}
+
+// writeAttachment adds a base64 encoded attachment part
+func writeAttachment(mw *multipart.Writer, attachment Attachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": attachment.Filename})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > base64LineLength {
+		if _, err := part.Write([]byte(encoded[:base64LineLength] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[base64LineLength:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// quotedPrintable encodes content as quoted-printable
+func quotedPrintable(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHeader writes a header line. Values are stripped of line breaks so
+// that they cannot inject further headers.
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+}
+
+// newMessageID returns a unique Message-ID in the domain of the sender
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
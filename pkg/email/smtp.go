@@ -1,14 +1,35 @@
 package email
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"time"
 
 	"ecommerce_project/internal/config"
 )
 
+// smtpTimeout bounds connecting and every message sent over a connection
+const smtpTimeout = 30 * time.Second
+
+// ErrRejected is returned when the SMTP server permanently refuses a
+// recipient or a message with a 5xx reply, which retrying will not fix
+var ErrRejected = errors.New("email rejected")
+
+// connection is an SMTP session together with its network connection, so
+// that the deadline can be extended for every message sent over it
+type connection struct {
+	*smtp.Client
+	conn net.Conn
+}
+
 type SMTPClient struct {
-	config *config.EmailConfig
+	config    *config.EmailConfig
+	tlsConfig *tls.Config
 }
 
 // NewSMTPClient creates a new SMTP client
@@ -16,45 +37,205 @@ func NewSMTPClient(config *config.EmailConfig) *SMTPClient {
 	return &SMTPClient{config: config}
 }
 
-// SendEmail sends an email via SMTP
-func (c *SMTPClient) SendEmail(to, subject, body string) error {
-	from := c.config.FromEmail
-	password := c.config.SMTPPassword
+// SetTLSConfig replaces the TLS settings used for STARTTLS and implicit
+// TLS, for example to trust a private CA
+func (c *SMTPClient) SetTLSConfig(tlsConfig *tls.Config) {
+	c.tlsConfig = tlsConfig
+}
+
+// SendEmail sends an email via SMTP. With a textBody the email is sent as
+// multipart/alternative so that clients without HTML show the text.
+func (c *SMTPClient) SendEmail(to, subject, htmlBody, textBody string) error {
+	return c.Send(&Message{
+		To:       []string{to},
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+	})
+}
+
+// Send sends a message over a new connection
+func (c *SMTPClient) Send(msg *Message) error {
+	client, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := c.deliver(client, msg); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// SendBulk sends messages reusing one connection for up to SMTPBatchSize
+// messages. A rejected message does not stop the others; the failures are
+// returned together.
+func (c *SMTPClient) SendBulk(messages []*Message) error {
+	batchSize := c.config.SMTPBatchSize
+	if batchSize <= 0 {
+		batchSize = len(messages)
+	}
+
+	var errs []error
+	var client *connection
+	sent := 0
 
-	// Setup headers
-	headers := make(map[string]string)
-	headers["From"] = fmt.Sprintf("%s <%s>", c.config.FromName, from)
-	headers["To"] = to
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
+	for _, msg := range messages {
+		if client != nil && sent >= batchSize {
+			client.Quit()
+			client = nil
+		}
+		if client == nil {
+			var err error
+			if client, err = c.dial(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			sent = 0
+		}
+
+		sent++
+		if err := c.deliver(client, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send email to %v: %w", msg.To, err))
 
-	// Compose message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+			// Start the next message on a clean transaction, or on a new
+			// connection if this one broke
+			if client.Reset() != nil {
+				client.Close()
+				client = nil
+			}
+		}
 	}
-	message += "\r\n" + body
 
-	// Authentication
-	auth := smtp.PlainAuth("", from, password, c.config.SMTPHost)
+	if client != nil {
+		client.Quit()
+	}
 
-	// Send email
-	addr := fmt.Sprintf("%s:%s", c.config.SMTPHost, c.config.SMTPPort)
-	err := smtp.SendMail(addr, auth, from, []string{to}, []byte(message))
+	return errors.Join(errs...)
+}
+
+// SendBulkEmail sends the same email to multiple recipients, one message
+// per recipient so that they do not see each other
+func (c *SMTPClient) SendBulkEmail(recipients []string, subject, htmlBody, textBody string) error {
+	messages := make([]*Message, 0, len(recipients))
+	for _, to := range recipients {
+		messages = append(messages, &Message{
+			To:       []string{to},
+			Subject:  subject,
+			HTMLBody: htmlBody,
+			TextBody: textBody,
+		})
+	}
+
+	return c.SendBulk(messages)
+}
+
+// dial connects to the SMTP server, secures the connection according to
+// the TLS mode and authenticates
+func (c *SMTPClient) dial() (*connection, error) {
+	host := c.config.SMTPHost
+	addr := net.JoinHostPort(host, c.config.SMTPPort)
+
+	tlsConfig := &tls.Config{ServerName: host}
+	if c.tlsConfig != nil {
+		tlsConfig = c.tlsConfig.Clone()
+	}
+
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if c.config.SMTPTLSMode == config.SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	if err := c.secure(client, tlsConfig); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &connection{Client: client, conn: conn}, nil
+}
+
+// secure runs STARTTLS when required and authenticates
+func (c *SMTPClient) secure(client *smtp.Client, tlsConfig *tls.Config) error {
+	if c.config.SMTPTLSMode == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	username := c.config.SMTPUsername
+	if username == "" && c.config.SMTPPassword != "" {
+		username = c.config.FromEmail
+	}
+	if username == "" {
+		return nil
+	}
+
+	auth := smtp.PlainAuth("", username, c.config.SMTPPassword, c.config.SMTPHost)
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
 	}
 
 	return nil
 }
 
-// SendBulkEmail sends emails to multiple recipients
-func (c *SMTPClient) SendBulkEmail(recipients []string, subject, body string) error {
-	for _, to := range recipients {
-		if err := c.SendEmail(to, subject, body); err != nil {
-			return err
+// deliver sends one message over an open connection
+func (c *SMTPClient) deliver(client *connection, msg *Message) error {
+	from := &mail.Address{Name: c.config.FromName, Address: c.config.FromEmail}
+
+	raw, err := build(from, msg)
+	if err != nil {
+		return err
+	}
+
+	client.conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, to := range msg.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return deliveryError(err)
 		}
 	}
+
+	w, err := client.Data()
+	if err != nil {
+		return deliveryError(err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return deliveryError(err)
+	}
+
 	return nil
 }
+
+// deliveryError wraps an error replied to a recipient or a message. A
+// permanent 5xx reply is reported as ErrRejected.
+func deliveryError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return fmt.Errorf("failed to send email: %w", err)
+}
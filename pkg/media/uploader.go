@@ -0,0 +1,146 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+
+	"ecommerce_project/pkg/logger"
+	"ecommerce_project/pkg/storage"
+)
+
+// ThumbnailSize is a thumbnail generated for every uploaded image
+type ThumbnailSize struct {
+	Name string
+	// Pixels is the longest side of the thumbnail
+	Pixels int
+}
+
+// ThumbnailSizes are the thumbnails generated for uploaded images, from the
+// smallest to the largest
+var ThumbnailSizes = []ThumbnailSize{
+	{Name: "small", Pixels: 160},
+	{Name: "medium", Pixels: 480},
+	{Name: "large", Pixels: 1200},
+}
+
+// Upload describes a stored image and its thumbnails
+type Upload struct {
+	URL         string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	// Thumbnails holds the URL of each thumbnail by size name
+	Thumbnails map[string]string
+	// Keys are the storage keys of the image and its thumbnails
+	Keys []string
+}
+
+// Uploader validates uploaded images and stores them with their thumbnails
+type Uploader struct {
+	storage  storage.Storage
+	maxBytes int64
+}
+
+// NewUploader creates an uploader accepting files of up to maxBytes
+func NewUploader(store storage.Storage, maxBytes int64) *Uploader {
+	return &Uploader{storage: store, maxBytes: maxBytes}
+}
+
+// MaxBytes returns the size limit of uploaded files
+func (u *Uploader) MaxBytes() int64 {
+	return u.maxBytes
+}
+
+// Upload checks that data is a JPEG, PNG or GIF image within the size
+// limits and stores it under prefix along with its thumbnails. Nothing is
+// left in storage if it fails.
+func (u *Uploader) Upload(ctx context.Context, prefix string, data []byte) (*Upload, error) {
+	if int64(len(data)) > u.maxBytes {
+		return nil, fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, u.maxBytes>>20)
+	}
+
+	contentType, err := DetectType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &Upload{
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Thumbnails:  map[string]string{},
+	}
+
+	key := fmt.Sprintf("%s/%s.%s", prefix, name, extensions[contentType])
+	if err := u.put(ctx, upload, key, contentType, data); err != nil {
+		return nil, err
+	}
+	upload.URL = u.storage.URL(key)
+
+	// Convert the image once and scale each thumbnail from the next larger
+	// one, so that only one full size copy of the image is made
+	scaled := image.Image(toRGBA(img))
+	for i := len(ThumbnailSizes) - 1; i >= 0; i-- {
+		size := ThumbnailSizes[i]
+		scaled = Fit(scaled, size.Pixels)
+
+		thumbnail, thumbnailType, err := Encode(scaled, contentType)
+		if err != nil {
+			u.Delete(ctx, upload.Keys)
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s/%s_%s.%s", prefix, name, size.Name, extensions[thumbnailType])
+		if err := u.put(ctx, upload, key, thumbnailType, thumbnail); err != nil {
+			u.Delete(ctx, upload.Keys)
+			return nil, err
+		}
+		upload.Thumbnails[size.Name] = u.storage.URL(key)
+	}
+
+	return upload, nil
+}
+
+// Delete removes stored files. Failures are logged rather than returned,
+// as the files are no longer referenced.
+func (u *Uploader) Delete(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := u.storage.Delete(ctx, key); err != nil {
+			logger.Warn("Failed to delete stored file", "key", key, "error", err)
+		}
+	}
+}
+
+// put stores a file and records its key on the upload
+func (u *Uploader) put(ctx context.Context, upload *Upload, key, contentType string, data []byte) error {
+	if err := u.storage.Put(ctx, key, contentType, data); err != nil {
+		return err
+	}
+	upload.Keys = append(upload.Keys, key)
+	return nil
+}
+
+// randomName returns an unguessable file name, so that keys are never
+// reused and stored files can be cached indefinitely
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate file name: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,155 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"ecommerce_project/pkg/utils"
+)
+
+const (
+	// DefaultLimit is the page size when a request does not set one
+	DefaultLimit = 20
+	// MaxLimit caps the page size of every list
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued by a list
+// with the same ordering
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is the part of a list a client asked for. A page after a cursor is
+// read by seeking to the last item of the previous page, which stays fast
+// however deep the page is; an offset page skips Offset items instead.
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// Cursor marks the last item of a page by its sort key and ID, the ID
+// breaking ties between items with the same key
+type Cursor struct {
+	Key string `json:"k"`
+	ID  int64  `json:"id"`
+}
+
+// Parse reads the limit, offset and cursor query parameters. The limit
+// defaults to defaultLimit and is capped at MaxLimit; offset and cursor
+// are mutually exclusive.
+func Parse(query url.Values, defaultLimit int) (*Page, error) {
+	page := &Page{Limit: defaultLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("limit must be a positive integer")
+		}
+		page.Limit = parsed
+	}
+	if page.Limit > MaxLimit {
+		page.Limit = MaxLimit
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+		page.Offset = parsed
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if page.Offset > 0 {
+			return nil, fmt.Errorf("use either offset or cursor")
+		}
+		decoded, err := Decode(cursor)
+		if err != nil {
+			return nil, err
+		}
+		page.Cursor = decoded
+	}
+
+	return page, nil
+}
+
+// FetchLimit is the number of items to read for the page: one more than
+// the limit, to tell whether a next page exists
+func (p *Page) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// HasMore reports whether n items read with FetchLimit include a next page
+func (p *Page) HasMore(n int) bool {
+	return n > p.Limit
+}
+
+// Meta describes the page for the response. next is nil on the last page.
+func (p *Page) Meta(total int, next *Cursor) utils.Pagination {
+	meta := utils.Pagination{Limit: p.Limit, Offset: p.Offset, Total: total}
+	if next != nil {
+		meta.HasMore = true
+		meta.NextCursor = next.Encode()
+	}
+	return meta
+}
+
+// OffsetMeta describes a page of n items from a list that is only paged
+// by offset, such as search hits ordered by relevance
+func (p *Page) OffsetMeta(total, n int) utils.Pagination {
+	return utils.Pagination{Limit: p.Limit, Offset: p.Offset, Total: total, HasMore: p.Offset+n < total}
+}
+
+// TimeCursor creates a cursor for a list ordered by a timestamp
+func TimeCursor(t time.Time, id int64) *Cursor {
+	return &Cursor{Key: t.UTC().Format(time.RFC3339Nano), ID: id}
+}
+
+// IntCursor creates a cursor for a list ordered by an integer
+func IntCursor(n, id int64) *Cursor {
+	return &Cursor{Key: strconv.FormatInt(n, 10), ID: id}
+}
+
+// Time returns the key of a cursor created by TimeCursor
+func (c *Cursor) Time() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, c.Key)
+	if err != nil {
+		return time.Time{}, ErrInvalidCursor
+	}
+	return t, nil
+}
+
+// Int returns the key of a cursor created by IntCursor
+func (c *Cursor) Int() (int64, error) {
+	n, err := strconv.ParseInt(c.Key, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return n, nil
+}
+
+// Encode returns the opaque form of a cursor given to clients
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor returned by Encode
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
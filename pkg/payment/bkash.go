@@ -6,28 +6,98 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// BkashSandboxURL is the tokenized checkout sandbox API
+	BkashSandboxURL = "https://tokenized.sandbox.bka.sh/v1.2.0-beta"
+	// BkashProductionURL is the tokenized checkout production API
+	BkashProductionURL = "https://tokenized.pay.bka.sh/v1.2.0-beta"
+
+	// bkashSuccessCode is the statusCode bKash returns for successful calls
+	bkashSuccessCode = "0000"
+
+	// tokenExpiryMargin renews the grant token slightly before bKash expires it
+	tokenExpiryMargin = time.Minute
 )
 
 type BkashClient struct {
-	appKey    string
-	appSecret string
-	username  string
-	password  string
-	baseURL   string
+	appKey     string
+	appSecret  string
+	username   string
+	password   string
+	baseURL    string
+	httpClient *http.Client
+
+	mu             sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
+}
+
+// BkashCreateResponse is the response of a create payment call
+type BkashCreateResponse struct {
+	PaymentID             string `json:"paymentID"`
+	BkashURL              string `json:"bkashURL"`
+	Amount                string `json:"amount"`
+	Currency              string `json:"currency"`
+	TransactionStatus     string `json:"transactionStatus"`
+	MerchantInvoiceNumber string `json:"merchantInvoiceNumber"`
+	StatusCode            string `json:"statusCode"`
+	StatusMessage         string `json:"statusMessage"`
+}
+
+// BkashExecuteResponse is the response of an execute payment call
+type BkashExecuteResponse struct {
+	PaymentID             string `json:"paymentID"`
+	TrxID                 string `json:"trxID"`
+	Amount                string `json:"amount"`
+	Currency              string `json:"currency"`
+	TransactionStatus     string `json:"transactionStatus"` // Completed, Initiated, ...
+	MerchantInvoiceNumber string `json:"merchantInvoiceNumber"`
+	CustomerMsisdn        string `json:"customerMsisdn"`
+	StatusCode            string `json:"statusCode"`
+	StatusMessage         string `json:"statusMessage"`
+}
+
+// BkashRefundResponse is the response of a refund call
+type BkashRefundResponse struct {
+	OriginalTrxID     string `json:"originalTrxID"`
+	RefundTrxID       string `json:"refundTrxID"`
+	TransactionStatus string `json:"transactionStatus"`
+	Amount            string `json:"amount"`
+	Currency          string `json:"currency"`
+	Charge            string `json:"charge"`
+	CompletedTime     string `json:"completedTime"`
+	StatusCode        string `json:"statusCode"`
+	StatusMessage     string `json:"statusMessage"`
 }
 
-// NewBkashClient creates a new bKash client
-func NewBkashClient(appKey, appSecret, username, password string) *BkashClient {
+// Completed reports whether bKash settled the payment
+func (r *BkashExecuteResponse) Completed() bool {
+	return r.StatusCode == bkashSuccessCode && r.TransactionStatus == "Completed"
+}
+
+// NewBkashClient creates a new bKash client. baseURL selects the sandbox or
+// production API; it defaults to the sandbox when empty.
+func NewBkashClient(appKey, appSecret, username, password, baseURL string) *BkashClient {
+	if baseURL == "" {
+		baseURL = BkashSandboxURL
+	}
+
 	return &BkashClient{
-		appKey:    appKey,
-		appSecret: appSecret,
-		username:  username,
-		password:  password,
-		baseURL:   "https://tokenized.sandbox.bka.sh/v1.2.0-beta", // Sandbox URL
+		appKey:     appKey,
+		appSecret:  appSecret,
+		username:   username,
+		password:   password,
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
-// GrantToken requests a grant token from bKash
+// GrantToken requests a new grant token from bKash and caches it until it
+// expires
 func (c *BkashClient) GrantToken() (string, error) {
 	url := fmt.Sprintf("%s/tokenized/checkout/token/grant", c.baseURL)
 
@@ -50,126 +120,148 @@ func (c *BkashClient) GrantToken() (string, error) {
 	req.Header.Set("username", c.username)
 	req.Header.Set("password", c.password)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	var result struct {
+		IDToken       string `json:"id_token"`
+		ExpiresIn     int64  `json:"expires_in"`
+		StatusCode    string `json:"statusCode"`
+		StatusMessage string `json:"statusMessage"`
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	if err := c.do(req, &result); err != nil {
 		return "", err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", err
+	if result.IDToken == "" {
+		return "", fmt.Errorf("failed to get token from bKash: %s", result.StatusMessage)
 	}
 
-	if token, ok := result["id_token"].(string); ok {
-		return token, nil
-	}
+	c.mu.Lock()
+	c.token = result.IDToken
+	c.tokenExpiresAt = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - tokenExpiryMargin)
+	c.mu.Unlock()
 
-	return "", fmt.Errorf("failed to get token from bKash")
+	return result.IDToken, nil
 }
 
-// CreatePayment creates a bKash payment
-func (c *BkashClient) CreatePayment(amount float64, invoiceNumber string) (map[string]interface{}, error) {
-	token, err := c.GrantToken()
-	if err != nil {
-		return nil, err
-	}
-
-	url := fmt.Sprintf("%s/tokenized/checkout/create", c.baseURL)
-
+// CreatePayment creates a bKash payment. bKash redirects the customer to
+// callbackURL with the paymentID and status once they finish on bKashURL.
+func (c *BkashClient) CreatePayment(amount float64, invoiceNumber, callbackURL string) (*BkashCreateResponse, error) {
 	payload := map[string]interface{}{
 		"mode":                  "0011",
 		"payerReference":        " ",
-		"callbackURL":           "https://example.com/callback",
-		"amount":                amount,
+		"callbackURL":           callbackURL,
+		"amount":                fmt.Sprintf("%.2f", amount),
 		"currency":              "BDT",
 		"intent":                "sale",
 		"merchantInvoiceNumber": invoiceNumber,
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
+	result := &BkashCreateResponse{}
+	if err := c.post("/tokenized/checkout/create", payload, result); err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if result.StatusCode != bkashSuccessCode {
+		return nil, fmt.Errorf("bKash create payment failed: %s", result.StatusMessage)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", token)
-	req.Header.Set("X-APP-Key", c.appKey)
+	return result, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// ExecutePayment executes a bKash payment after the customer authorised it
+func (c *BkashClient) ExecutePayment(paymentID string) (*BkashExecuteResponse, error) {
+	payload := map[string]string{
+		"paymentID": paymentID,
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	result := &BkashExecuteResponse{}
+	if err := c.post("/tokenized/checkout/execute", payload, result); err != nil {
 		return nil, err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	return result, nil
+}
+
+// RefundPayment refunds part or all of an executed bKash payment. trxID is
+// the transaction ID returned when the payment was executed.
+func (c *BkashClient) RefundPayment(paymentID, trxID string, amount float64, reason string) (*BkashRefundResponse, error) {
+	payload := map[string]string{
+		"paymentID": paymentID,
+		"trxID":     trxID,
+		"amount":    fmt.Sprintf("%.2f", amount),
+		"sku":       "refund",
+		"reason":    reason,
+	}
+
+	result := &BkashRefundResponse{}
+	if err := c.post("/tokenized/checkout/payment/refund", payload, result); err != nil {
 		return nil, err
 	}
 
+	if result.RefundTrxID == "" || result.TransactionStatus != "Completed" {
+		return nil, fmt.Errorf("bKash refund failed: %s", result.StatusMessage)
+	}
+
 	return result, nil
 }
 
-// ExecutePayment executes a bKash payment
-func (c *BkashClient) ExecutePayment(paymentID string) (map[string]interface{}, error) {
-	token, err := c.GrantToken()
-	if err != nil {
-		return nil, err
+// cachedToken returns the cached grant token, requesting a new one when it
+// is missing or expired
+func (c *BkashClient) cachedToken() (string, error) {
+	c.mu.Lock()
+	token, expiresAt := c.token, c.tokenExpiresAt
+	c.mu.Unlock()
+
+	if token != "" && time.Now().Before(expiresAt) {
+		return token, nil
 	}
 
-	url := fmt.Sprintf("%s/tokenized/checkout/execute", c.baseURL)
+	return c.GrantToken()
+}
 
-	payload := map[string]string{
-		"paymentID": paymentID,
+// post sends an authorised checkout API request and decodes the response
+func (c *BkashClient) post(path string, payload interface{}, out interface{}) error {
+	token, err := c.cachedToken()
+	if err != nil {
+		return err
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", token)
 	req.Header.Set("X-APP-Key", c.appKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return c.do(req, out)
+}
+
+// do sends a request and decodes its JSON response into out
+func (c *BkashClient) do(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("bKash request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return result, nil
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode bKash response: %w", err)
+	}
+
+	return nil
 }
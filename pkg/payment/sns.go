@@ -0,0 +1,259 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1"   // SignatureVersion 1
+	_ "crypto/sha256" // SignatureVersion 2
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SNSNotification is the type of a message published to the topic
+	SNSNotification = "Notification"
+	// SNSSubscriptionConfirmation is the type of the message SNS sends when
+	// the endpoint is subscribed to a topic
+	SNSSubscriptionConfirmation = "SubscriptionConfirmation"
+	// SNSUnsubscribeConfirmation is the type of the message SNS sends when
+	// the endpoint is unsubscribed from a topic
+	SNSUnsubscribeConfirmation = "UnsubscribeConfirmation"
+
+	// maxSNSCertBytes bounds the size of a downloaded signing certificate
+	maxSNSCertBytes = 64 << 10
+)
+
+// snsHost matches the hosts SNS serves signing certificates and
+// subscription URLs from
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSMessage is a message delivered by Amazon SNS to an HTTPS endpoint.
+// bKash publishes its payment notifications through SNS.
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	UnsubscribeURL   string `json:"UnsubscribeURL"`
+}
+
+// ParseSNSMessage decodes the body of an SNS delivery
+func ParseSNSMessage(payload []byte) (*SNSMessage, error) {
+	var msg SNSMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("invalid SNS message: %w", err)
+	}
+	if msg.Type == "" || msg.MessageID == "" {
+		return nil, fmt.Errorf("invalid SNS message: missing Type or MessageId")
+	}
+	return &msg, nil
+}
+
+// StringToSign builds the canonical string SNS signs for the message type
+func (m *SNSMessage) StringToSign() (string, error) {
+	var fields [][2]string
+	switch m.Type {
+	case SNSNotification:
+		fields = [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+		// Subject is only signed when the message has one
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [][2]string{{"Timestamp", m.Timestamp}, {"TopicArn", m.TopicArn}, {"Type", m.Type}}...)
+	case SNSSubscriptionConfirmation, SNSUnsubscribeConfirmation:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+			{"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp},
+			{"Token", m.Token},
+			{"TopicArn", m.TopicArn},
+			{"Type", m.Type},
+		}
+	default:
+		return "", fmt.Errorf("unknown SNS message type %q", m.Type)
+	}
+
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(field[0])
+		b.WriteByte('\n')
+		b.WriteString(field[1])
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// SNSVerifier verifies the signatures of SNS messages against the signing
+// certificates published by SNS, which it caches by URL
+type SNSVerifier struct {
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewSNSVerifier creates an SNS verifier. httpClient downloads signing
+// certificates and confirms subscriptions; a client with a 30 second
+// timeout is used when it is nil.
+func NewSNSVerifier(httpClient *http.Client) *SNSVerifier {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &SNSVerifier{
+		httpClient: httpClient,
+		certs:      make(map[string]*x509.Certificate),
+	}
+}
+
+// Verify checks that the message was signed by SNS. The signing
+// certificate must be served over HTTPS by an SNS host, so that a forged
+// message cannot point at a certificate of its own.
+func (v *SNSVerifier) Verify(msg *SNSMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported SNS signature version %q", ErrInvalidSignature, msg.SignatureVersion)
+	}
+
+	if err := checkSNSURL(msg.SigningCertURL); err != nil {
+		return fmt.Errorf("%w: signing certificate %v", ErrInvalidSignature, err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed SNS signature", ErrInvalidSignature)
+	}
+
+	stringToSign, err := msg.StringToSign()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	cert, err := v.certificate(msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: SNS signing certificate has no RSA key", ErrInvalidSignature)
+	}
+
+	h := hash.New()
+	h.Write([]byte(stringToSign))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// ConfirmSubscription confirms the subscription of the endpoint to a topic
+// by visiting the SubscribeURL of a verified SubscriptionConfirmation
+func (v *SNSVerifier) ConfirmSubscription(msg *SNSMessage) error {
+	if msg.Type != SNSSubscriptionConfirmation {
+		return fmt.Errorf("SNS message %s is not a subscription confirmation", msg.MessageID)
+	}
+	if err := checkSNSURL(msg.SubscribeURL); err != nil {
+		return fmt.Errorf("invalid SNS subscribe URL: %w", err)
+	}
+
+	resp, err := v.httpClient.Get(msg.SubscribeURL)
+	if err != nil {
+		return fmt.Errorf("failed to confirm SNS subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to confirm SNS subscription: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// certificate returns the signing certificate at certURL, downloading it on
+// first use
+func (v *SNSVerifier) certificate(certURL string) (*x509.Certificate, error) {
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+
+	if !ok {
+		var err error
+		cert, err = v.downloadCertificate(certURL)
+		if err != nil {
+			return nil, err
+		}
+
+		v.mu.Lock()
+		v.certs[certURL] = cert
+		v.mu.Unlock()
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w: SNS signing certificate is not valid at this time", ErrInvalidSignature)
+	}
+	return cert, nil
+}
+
+func (v *SNSVerifier) downloadCertificate(certURL string) (*x509.Certificate, error) {
+	resp, err := v.httpClient.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download SNS signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download SNS signing certificate: status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSNSCertBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download SNS signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: SNS signing certificate is not a PEM certificate", ErrInvalidSignature)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid SNS signing certificate: %v", ErrInvalidSignature, err)
+	}
+	return cert, nil
+}
+
+// checkSNSURL checks that rawURL is an HTTPS URL on an SNS host
+func checkSNSURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if u.Scheme != "https" || u.Port() != "" || !snsHost.MatchString(u.Hostname()) {
+		return fmt.Errorf("URL %q is not served by Amazon SNS", rawURL)
+	}
+	return nil
+}
@@ -5,20 +5,37 @@ import (
 
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/paymentintent"
+	"github.com/stripe/stripe-go/v76/refund"
 )
 
 type StripeClient struct {
 	secretKey string
+	intents   paymentintent.Client
+	refunds   refund.Client
 }
 
-// NewStripeClient creates a new Stripe client
-func NewStripeClient(secretKey string) *StripeClient {
-	stripe.Key = secretKey
-	return &StripeClient{secretKey: secretKey}
+// NewStripeClient creates a new Stripe client. baseURL overrides the Stripe
+// API endpoint, for example to point at a local fake server in tests; leave
+// it empty to use the real API.
+func NewStripeClient(secretKey, baseURL string) *StripeClient {
+	backend := stripe.GetBackend(stripe.APIBackend)
+	if baseURL != "" {
+		backend = stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+			URL:               stripe.String(baseURL),
+			MaxNetworkRetries: stripe.Int64(0),
+		})
+	}
+
+	return &StripeClient{
+		secretKey: secretKey,
+		intents:   paymentintent.Client{B: backend, Key: secretKey},
+		refunds:   refund.Client{B: backend, Key: secretKey},
+	}
 }
 
-// CreatePaymentIntent creates a Stripe payment intent
-func (c *StripeClient) CreatePaymentIntent(amount int64, currency string) (*stripe.PaymentIntent, error) {
+// CreatePaymentIntent creates a Stripe payment intent. Amount is in the
+// smallest currency unit.
+func (c *StripeClient) CreatePaymentIntent(amount int64, currency string, metadata map[string]string) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{
 		Amount:   stripe.Int64(amount),
 		Currency: stripe.String(currency),
@@ -26,8 +43,11 @@ func (c *StripeClient) CreatePaymentIntent(amount int64, currency string) (*stri
 			Enabled: stripe.Bool(true),
 		},
 	}
+	for key, value := range metadata {
+		params.AddMetadata(key, value)
+	}
 
-	pi, err := paymentintent.New(params)
+	pi, err := c.intents.New(params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment intent: %w", err)
 	}
@@ -37,7 +57,7 @@ func (c *StripeClient) CreatePaymentIntent(amount int64, currency string) (*stri
 
 // GetPaymentIntent retrieves a Stripe payment intent
 func (c *StripeClient) GetPaymentIntent(id string) (*stripe.PaymentIntent, error) {
-	pi, err := paymentintent.Get(id, nil)
+	pi, err := c.intents.Get(id, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payment intent: %w", err)
 	}
@@ -47,7 +67,7 @@ func (c *StripeClient) GetPaymentIntent(id string) (*stripe.PaymentIntent, error
 
 // ConfirmPaymentIntent confirms a Stripe payment intent
 func (c *StripeClient) ConfirmPaymentIntent(id string) (*stripe.PaymentIntent, error) {
-	pi, err := paymentintent.Confirm(id, nil)
+	pi, err := c.intents.Confirm(id, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to confirm payment intent: %w", err)
 	}
@@ -57,10 +77,29 @@ func (c *StripeClient) ConfirmPaymentIntent(id string) (*stripe.PaymentIntent, e
 
 // CancelPaymentIntent cancels a Stripe payment intent
 func (c *StripeClient) CancelPaymentIntent(id string) (*stripe.PaymentIntent, error) {
-	pi, err := paymentintent.Cancel(id, nil)
+	pi, err := c.intents.Cancel(id, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to cancel payment intent: %w", err)
 	}
 
 	return pi, nil
 }
+
+// CreateRefund refunds part or all of a succeeded payment intent. Amount is
+// in the smallest currency unit.
+func (c *StripeClient) CreateRefund(paymentIntentID string, amount int64, metadata map[string]string) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Amount:        stripe.Int64(amount),
+	}
+	for key, value := range metadata {
+		params.AddMetadata(key, value)
+	}
+
+	r, err := c.refunds.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	return r, nil
+}
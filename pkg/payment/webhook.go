@@ -0,0 +1,31 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/webhook"
+)
+
+// ErrInvalidSignature is returned when a webhook signature does not match
+// its payload
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// ConstructStripeEvent verifies the Stripe-Signature header of a webhook
+// against the endpoint secret and decodes the event. Events signed more
+// than five minutes ago are rejected to prevent replays.
+func ConstructStripeEvent(payload []byte, signatureHeader, secret string) (stripe.Event, error) {
+	if secret == "" {
+		return stripe.Event{}, fmt.Errorf("stripe webhook secret not configured")
+	}
+
+	event, err := webhook.ConstructEventWithOptions(payload, signatureHeader, secret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return stripe.Event{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,328 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// recordSize is the aes128gcm record size. Payloads are sent as a
+	// single record.
+	recordSize = 4096
+	// MaxPayloadSize is the largest payload push services accept: their
+	// 4096 byte limit covers the 86 byte header, the padding delimiter and
+	// the authentication tag
+	MaxPayloadSize = 4096 - 86 - 1 - 16
+
+	// vapidTokenLifetime is how long a VAPID token is valid; push services
+	// reject tokens valid for more than 24 hours
+	vapidTokenLifetime = 12 * time.Hour
+)
+
+// serviceHosts are the push services of the major browsers. Subscriptions
+// are only accepted for these hosts and their subdomains, so that the
+// server cannot be made to send requests to arbitrary addresses.
+var serviceHosts = []string{
+	"fcm.googleapis.com",                // Chrome, Edge on Android, Opera
+	"android.googleapis.com",            // older Chrome subscriptions
+	"updates.push.services.mozilla.com", // Firefox
+	"push.apple.com",                    // Safari
+	"notify.windows.com",                // Edge on Windows
+}
+
+// ErrSubscriptionGone is returned when the push service reports that the
+// subscription expired or was removed by the user
+var ErrSubscriptionGone = errors.New("push subscription is no longer valid")
+
+// Subscription is a browser push subscription as returned by
+// PushSubscription.toJSON()
+type Subscription struct {
+	Endpoint string
+	P256dh   string // base64url encoded public key of the browser
+	Auth     string // base64url encoded authentication secret
+}
+
+// Client sends Web Push messages (RFC 8030) encrypted with aes128gcm
+// (RFC 8291) and authenticated with VAPID (RFC 8292)
+type Client struct {
+	publicKey  string
+	privateKey *ecdsa.PrivateKey
+	subject    string
+	ttl        time.Duration
+	httpClient *http.Client
+}
+
+// NewClient creates a Web Push client from a base64url encoded VAPID key
+// pair. subject is a mailto: or https: URL push services can use to contact
+// the sender. Messages that cannot be delivered within ttl are dropped by
+// the push service.
+func NewClient(publicKey, privateKey, subject string, ttl time.Duration) (*Client, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := key.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	if base64.RawURLEncoding.EncodeToString(public.PublicKey().Bytes()) != publicKey {
+		return nil, fmt.Errorf("VAPID public key does not match the private key")
+	}
+
+	return &Client{
+		publicKey:  publicKey,
+		privateKey: key,
+		subject:    subject,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// GenerateVAPIDKeys creates a new base64url encoded VAPID key pair
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (c *Client) PublicKey() string {
+	return c.publicKey
+}
+
+// Send encrypts payload for the subscription and posts it to its push
+// service
+func (c *Client) Send(sub *Subscription, payload []byte) error {
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.vapidToken(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(c.ttl.Seconds())))
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, c.publicKey))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrSubscriptionGone
+	}
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("push service responded with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// Encrypt encrypts payload for the subscription with the aes128gcm content
+// encoding of RFC 8291
+func Encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("push payload of %d bytes exceeds %d bytes", len(payload), MaxPayloadSize)
+	}
+
+	uaPublicBytes, err := decodeKey(sub.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(sub.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// Combine the ECDH secret with the browser's auth secret, then derive
+	// the content encryption key and nonce
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublic...)
+	ikm, err := deriveKey(authSecret, sharedSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := deriveKey(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := deriveKey(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0x02 marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// vapidToken signs a VAPID JWT for the push service of endpoint
+func (c *Client) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": c.subject,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(c.privateKey)
+}
+
+// deriveKey runs HKDF-SHA256 over secret with salt and info
+func deriveKey(salt, secret, info []byte, length int) ([]byte, error) {
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// parsePrivateKey decodes a base64url encoded P-256 private scalar
+func parsePrivateKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	raw, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	// The uncompressed public point is 0x04 || X || Y
+	public := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}, nil
+}
+
+// decodeKey decodes base64url keys with or without padding
+func decodeKey(s string) ([]byte, error) {
+	if key, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return key, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// Validate checks that the endpoint belongs to a known push service and that
+// the subscription keys can be used for encryption
+func (s *Subscription) Validate() error {
+	if err := validateEndpoint(s.Endpoint); err != nil {
+		return err
+	}
+
+	key, err := decodeKey(s.P256dh)
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(key); err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	auth, err := decodeKey(s.Auth)
+	if err != nil || len(auth) != 16 {
+		return fmt.Errorf("invalid auth secret")
+	}
+
+	return nil
+}
+
+// validateEndpoint accepts https URLs on the default port of a known push
+// service
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return fmt.Errorf("invalid push endpoint")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, service := range serviceHosts {
+		if host == service || strings.HasSuffix(host, "."+service) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("push endpoint %s is not a supported push service", host)
+}
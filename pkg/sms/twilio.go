@@ -0,0 +1,92 @@
+package sms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TwilioAPIURL is the Twilio REST API
+const TwilioAPIURL = "https://api.twilio.com"
+
+// ErrRejected is returned when Twilio refuses a message for a reason that
+// retrying will not fix, such as an invalid or unsubscribed number
+var ErrRejected = errors.New("sms rejected")
+
+type TwilioClient struct {
+	accountSID string
+	authToken  string
+	from       string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewTwilioClient creates a new Twilio client that sends messages from the
+// given number. baseURL defaults to the Twilio API when empty.
+func NewTwilioClient(accountSID, authToken, from, baseURL string) *TwilioClient {
+	if baseURL == "" {
+		baseURL = TwilioAPIURL
+	}
+
+	return &TwilioClient{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SendSMS sends a text message to a phone number in E.164 format
+func (c *TwilioClient) SendSMS(to, body string) error {
+	form := url.Values{
+		"To":   {to},
+		"From": {c.from},
+		"Body": {body},
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", c.baseURL, url.PathEscape(c.accountSID))
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.accountSID, c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 400 {
+		return nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var apiErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(respBody, &apiErr); err != nil || apiErr.Message == "" {
+		return fmt.Errorf("twilio request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	// Other 4xx responses mean the message itself is bad; 401, 429 and 5xx
+	// can succeed later
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %s (code %d)", ErrRejected, apiErr.Message, apiErr.Code)
+	}
+
+	return fmt.Errorf("twilio request failed with status %d: %s", resp.StatusCode, apiErr.Message)
+}
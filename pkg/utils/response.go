@@ -48,12 +48,14 @@ type PaginatedResponse struct {
 	Pagination Pagination  `json:"pagination"`
 }
 
-// Pagination represents pagination metadata
+// Pagination represents pagination metadata. NextCursor requests the page
+// after this one and is empty on the last page.
 type Pagination struct {
-	CurrentPage int `json:"current_page"`
-	PerPage     int `json:"per_page"`
-	Total       int `json:"total"`
-	TotalPages  int `json:"total_pages"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // PaginatedSuccessResponse sends a paginated success response
@@ -14,6 +14,10 @@ go build -o bin/api cmd/api/main.go
 echo "Building background workers..."
 go build -o bin/worker cmd/worker/main.go
 
+# Build migration command
+echo "Building migration command..."
+go build -o bin/migrate cmd/migrate/main.go
+
 # Build seed script
 echo "Building seed script..."
 go build -o bin/seed scripts/seed_data.go
@@ -23,4 +27,5 @@ echo ""
 echo "Binaries created:"
 echo "  - bin/api       (API server)"
 echo "  - bin/worker    (Background workers)"
+echo "  - bin/migrate   (Database migrations)"
 echo "  - bin/seed      (Database seeder)"
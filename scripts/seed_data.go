@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	"math/rand"
 	"time"
@@ -52,6 +51,18 @@ func seedUsers(db *sql.DB) {
 
 		if err != nil {
 			log.Printf("Error inserting user %s: %v", u.Email, err)
+			continue
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u JOIN roles r ON r.name = u.role
+			WHERE u.email = $1
+			ON CONFLICT DO NOTHING
+		`, u.Email)
+
+		if err != nil {
+			log.Printf("Error granting role to user %s: %v", u.Email, err)
 		}
 	}
 
@@ -116,15 +127,26 @@ func seedProducts(db *sql.DB) {
 		}
 	}
 
+	// Every product is sold through a default variant until it gets options
+	_, err := db.Exec(`
+		INSERT INTO product_variants (product_id, sku, is_default, is_active)
+		SELECT id, sku, true, true FROM products
+		ON CONFLICT DO NOTHING
+	`)
+
+	if err != nil {
+		log.Printf("Error inserting default variants: %v", err)
+	}
+
 	log.Println("Products seeded")
 }
 
 func seedInventory(db *sql.DB) {
-	// Add inventory for all products
+	// Add inventory for all variants
 	_, err := db.Exec(`
-		INSERT INTO inventory (product_id, quantity, reserved)
-		SELECT id, $1, 0 FROM products
-		ON CONFLICT (product_id) DO NOTHING
+		INSERT INTO inventory (product_id, variant_id, quantity, reserved)
+		SELECT product_id, id, $1, 0 FROM product_variants
+		ON CONFLICT (variant_id) DO NOTHING
 	`, rand.Intn(100)+10)
 
 	if err != nil {
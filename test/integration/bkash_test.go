@@ -0,0 +1,69 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"ecommerce_project/pkg/payment"
+)
+
+// TestBkashCheckoutFlow tests create and execute against a fake bKash
+// server and checks that the grant token is reused between calls
+func TestBkashCheckoutFlow(t *testing.T) {
+	var grants int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tokenized/checkout/token/grant", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&grants, 1)
+		w.Write([]byte(`{"id_token":"token-1","expires_in":3600,"statusCode":"0000","statusMessage":"Successful"}`))
+	})
+	mux.HandleFunc("/tokenized/checkout/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token-1" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		if body["callbackURL"] != "https://shop.test/callback" {
+			t.Errorf("callbackURL = %s", body["callbackURL"])
+		}
+		if body["amount"] != "120.50" {
+			t.Errorf("amount = %s, want 120.50", body["amount"])
+		}
+
+		w.Write([]byte(`{"paymentID":"TR001","bkashURL":"https://sandbox.bka.sh/pay/TR001","transactionStatus":"Initiated","statusCode":"0000","statusMessage":"Successful"}`))
+	})
+	mux.HandleFunc("/tokenized/checkout/execute", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"paymentID":"TR001","trxID":"AB12CD","transactionStatus":"Completed","statusCode":"0000","statusMessage":"Successful"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := payment.NewBkashClient("key", "secret", "user", "pass", server.URL)
+
+	created, err := client.CreatePayment(120.5, "ORD-1", "https://shop.test/callback")
+	if err != nil {
+		t.Fatalf("CreatePayment failed: %v", err)
+	}
+	if created.PaymentID != "TR001" || created.BkashURL == "" {
+		t.Errorf("unexpected create response: %+v", created)
+	}
+
+	executed, err := client.ExecutePayment(created.PaymentID)
+	if err != nil {
+		t.Fatalf("ExecutePayment failed: %v", err)
+	}
+	if !executed.Completed() || executed.TrxID != "AB12CD" {
+		t.Errorf("unexpected execute response: %+v", executed)
+	}
+
+	if n := atomic.LoadInt32(&grants); n != 1 {
+		t.Errorf("grant token requested %d times, want 1", n)
+	}
+}
@@ -0,0 +1,211 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+
+	"ecommerce_project/pkg/push"
+)
+
+// browser is the receiving side of a push subscription
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return &browser{key: key, auth: auth}
+}
+
+func (b *browser) subscription(endpoint string) *push.Subscription {
+	return &push.Subscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(b.auth),
+	}
+}
+
+// decrypt reverses the aes128gcm encoding of RFC 8291 like a browser does
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != 4096 {
+		t.Fatalf("record size = %d, want 4096", rs)
+	}
+	idLen := int(body[20])
+	asPublicBytes := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		t.Fatalf("invalid sender key: %v", err)
+	}
+	shared, err := b.key.ECDH(asPublic)
+	if err != nil {
+		t.Fatalf("ECDH failed: %v", err)
+	}
+
+	expand := func(salt, secret, info []byte, n int) []byte {
+		out := make([]byte, n)
+		io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out)
+		return out
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), b.key.PublicKey().Bytes()...), asPublicBytes...)
+	ikm := expand(b.auth, shared, keyInfo, 32)
+	cek := expand(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := expand(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+// TestWebPushSend sends a notification to a fake push service and checks
+// that the browser can decrypt it and that the VAPID token verifies
+func TestWebPushSend(t *testing.T) {
+	publicKey, privateKey, err := push.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("failed to generate VAPID keys: %v", err)
+	}
+
+	b := newBrowser(t)
+	payload := []byte(`{"title":"Your Order Has Shipped","body":"Your order ORD-1 has shipped.","url":"/orders/ORD-1"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q", r.Header.Get("Content-Encoding"))
+		}
+		if r.Header.Get("TTL") != "3600" {
+			t.Errorf("TTL = %q, want 3600", r.Header.Get("TTL"))
+		}
+
+		// Authorization: vapid t=<jwt>, k=<public key>
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid ")
+		parts := strings.Split(auth, ", ")
+		if len(parts) != 2 || parts[1] != "k="+publicKey {
+			t.Fatalf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+
+		raw, _ := base64.RawURLEncoding.DecodeString(publicKey)
+		verifyKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(raw[1:33]),
+			Y:     new(big.Int).SetBytes(raw[33:]),
+		}
+		token, err := jwt.Parse(strings.TrimPrefix(parts[0], "t="), func(*jwt.Token) (interface{}, error) {
+			return verifyKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("http://"+r.Host))
+		if err != nil || !token.Valid {
+			t.Fatalf("invalid VAPID token: %v", err)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if got := b.decrypt(t, body); !bytes.Equal(got, payload) {
+			t.Errorf("decrypted payload = %s", got)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client, err := push.NewClient(publicKey, privateKey, "mailto:ops@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	if err := client.Send(b.subscription(server.URL+"/push/abc"), payload); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+}
+
+// TestWebPushSubscriptionGone checks that expired subscriptions are
+// reported so that they can be deleted
+func TestWebPushSubscriptionGone(t *testing.T) {
+	publicKey, privateKey, _ := push.GenerateVAPIDKeys()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	client, err := push.NewClient(publicKey, privateKey, "mailto:ops@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	err = client.Send(newBrowser(t).subscription(server.URL), []byte(`{}`))
+	if !errors.Is(err, push.ErrSubscriptionGone) {
+		t.Fatalf("expected ErrSubscriptionGone, got %v", err)
+	}
+}
+
+// TestWebPushKeyMismatch rejects a VAPID public key that does not belong
+// to the private key
+func TestWebPushKeyMismatch(t *testing.T) {
+	_, privateKey, _ := push.GenerateVAPIDKeys()
+	otherPublic, _, _ := push.GenerateVAPIDKeys()
+
+	if _, err := push.NewClient(otherPublic, privateKey, "mailto:ops@example.com", time.Hour); err == nil {
+		t.Fatal("expected an error for mismatched VAPID keys")
+	}
+}
+
+func TestSubscriptionValidateEndpoint(t *testing.T) {
+	b := newBrowser(t)
+
+	tests := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", true},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", true},
+		{"https://web.push.apple.com/abc", true},
+		{"https://db5p.notify.windows.com/w/?token=abc", true},
+		{"http://fcm.googleapis.com/fcm/send/abc", false},
+		{"https://fcm.googleapis.com:8443/fcm/send/abc", false},
+		{"https://fcm.googleapis.com.attacker.example/abc", false},
+		{"https://127.0.0.1/abc", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://localhost/abc", false},
+	}
+
+	for _, tt := range tests {
+		err := b.subscription(tt.endpoint).Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) error = %v, want valid %v", tt.endpoint, err, tt.valid)
+		}
+	}
+}
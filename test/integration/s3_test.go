@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecommerce_project/pkg/storage"
+)
+
+// TestS3PutAndDelete stores and deletes an object on a fake S3-compatible
+// server with path-style addressing
+func TestS3PutAndDelete(t *testing.T) {
+	var methods []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+
+		if r.URL.Path != "/media-bucket/products/1/photo.jpg" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/") {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+
+		if r.Method == http.MethodPut {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "jpeg data" || r.Header.Get("Content-Type") != "image/jpeg" {
+				t.Errorf("unexpected object %q of type %q", body, r.Header.Get("Content-Type"))
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s3, err := storage.NewS3(server.URL, "us-east-1", "media-bucket", "access-key", "secret-key", true, "https://cdn.example.com")
+	if err != nil {
+		t.Fatalf("NewS3 failed: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s3.Put(ctx, "products/1/photo.jpg", "image/jpeg", []byte("jpeg data")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s3.Delete(ctx, "products/1/photo.jpg"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if strings.Join(methods, ",") != "PUT,DELETE" {
+		t.Errorf("unexpected requests %v", methods)
+	}
+	if got := s3.URL("products/1/photo.jpg"); got != "https://cdn.example.com/products/1/photo.jpg" {
+		t.Errorf("unexpected URL %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package integration
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecommerce_project/pkg/sms"
+)
+
+// TestTwilioSendSMS sends a message to a fake Twilio API
+func TestTwilioSendSMS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "AC123" || pass != "token" {
+			t.Errorf("unexpected basic auth %q:%q", user, pass)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if r.PostForm.Get("To") != "+8801700000000" || r.PostForm.Get("From") != "+15550000000" || r.PostForm.Get("Body") != "Your order has shipped." {
+			t.Errorf("unexpected form %v", r.PostForm)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+	}))
+	defer server.Close()
+
+	client := sms.NewTwilioClient("AC123", "token", "+15550000000", server.URL)
+	if err := client.SendSMS("+8801700000000", "Your order has shipped."); err != nil {
+		t.Fatalf("SendSMS failed: %v", err)
+	}
+}
+
+// TestTwilioRejectedNumber checks that invalid numbers are reported as
+// permanent failures
+func TestTwilioRejectedNumber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":21211,"message":"The 'To' number is not a valid phone number.","status":400}`))
+	}))
+	defer server.Close()
+
+	client := sms.NewTwilioClient("AC123", "token", "+15550000000", server.URL)
+	err := client.SendSMS("12345", "hi")
+	if !errors.Is(err, sms.ErrRejected) {
+		t.Fatalf("expected ErrRejected, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/config"
+	"ecommerce_project/pkg/email"
+)
+
+// smtpServer is a minimal in-process SMTP server recording what it receives
+type smtpServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu          sync.Mutex
+	connections int
+	usernames   []string
+	messages    []*smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	tls  bool
+	data []byte
+}
+
+// newSMTPServer starts a server on a random local port. With a tlsConfig
+// it offers STARTTLS.
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &smtpServer{listener: listener, tlsConfig: tlsConfig}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+func (s *smtpServer) port() string {
+	return strings.TrimPrefix(s.listener.Addr().String(), "127.0.0.1:")
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	secure := false
+	var current *smtpMessage
+
+	text.PrintfLine("220 localhost ESMTP test")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			extensions := []string{"250-localhost", "250-8BITMIME"}
+			if s.tlsConfig != nil && !secure {
+				extensions = append(extensions, "250-STARTTLS")
+			}
+			extensions = append(extensions, "250 AUTH PLAIN")
+			for _, ext := range extensions {
+				text.PrintfLine("%s", ext)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			fields := strings.Split(string(decoded), "\x00")
+			if len(fields) == 3 {
+				s.mu.Lock()
+				s.usernames = append(s.usernames, fields[1])
+				s.mu.Unlock()
+			}
+			text.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			current = &smtpMessage{from: arg, tls: secure}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			if strings.Contains(arg, "reject") {
+				text.PrintfLine("550 No such user")
+				continue
+			}
+			if strings.Contains(arg, "busy") {
+				text.PrintfLine("451 Try again later")
+				continue
+			}
+			current.to = append(current.to, arg)
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			current.data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = nil
+			text.PrintfLine("250 OK")
+		case "RSET":
+			current = nil
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// selfSignedTLS returns server and client TLS configs for a certificate
+// valid for 127.0.0.1
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+func newSMTPConfig(s *smtpServer, tlsMode string) *config.EmailConfig {
+	return &config.EmailConfig{
+		SMTPHost:      "127.0.0.1",
+		SMTPPort:      s.port(),
+		SMTPUsername:  "mailer",
+		SMTPPassword:  "secret",
+		SMTPTLSMode:   tlsMode,
+		SMTPBatchSize: 100,
+		FromEmail:     "noreply@shop.test",
+		FromName:      "Shop",
+	}
+}
+
+// TestSMTPSendWithAttachment sends a multipart email with a non-ASCII
+// subject and a PDF attachment over STARTTLS
+func TestSMTPSendWithAttachment(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	server := newSMTPServer(t, serverTLS)
+
+	client := email.NewSMTPClient(newSMTPConfig(server, config.SMTPTLSStartTLS))
+	client.SetTLSConfig(clientTLS)
+
+	pdf := []byte("%PDF-1.4 invoice")
+	err := client.Send(&email.Message{
+		To:       []string{"customer@example.com"},
+		Subject:  "অর্ডার নিশ্চিতকরণ",
+		HTMLBody: "<p>Thanks for your order</p>",
+		TextBody: "Thanks for your order",
+		Attachments: []email.Attachment{
+			{Filename: "invoice-ORD-1.pdf", ContentType: "application/pdf", Data: pdf},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if len(server.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(server.messages))
+	}
+	received := server.messages[0]
+	if !received.tls {
+		t.Error("message was not sent over TLS")
+	}
+	if len(server.usernames) != 1 || server.usernames[0] != "mailer" {
+		t.Errorf("expected to authenticate as mailer, got %v", server.usernames)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(received.data)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "অর্ডার নিশ্চিতকরণ" {
+		t.Errorf("subject = %q (%v), raw %q", subject, err, msg.Header.Get("Subject"))
+	}
+	if msg.Header.Get("Message-ID") == "" || !strings.HasSuffix(msg.Header.Get("Message-ID"), "@shop.test>") {
+		t.Errorf("unexpected Message-ID %q", msg.Header.Get("Message-ID"))
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("invalid Date header: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read body part: %v", err)
+	}
+	if !strings.HasPrefix(body.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("unexpected body Content-Type %q", body.Header.Get("Content-Type"))
+	}
+
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment: %v", err)
+	}
+	if attachment.FileName() != "invoice-ORD-1.pdf" {
+		t.Errorf("filename = %q", attachment.FileName())
+	}
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if err != nil || string(data) != string(pdf) {
+		t.Errorf("attachment = %q (%v)", data, err)
+	}
+}
+
+// TestSMTPSendBulkReusesConnections sends batches over one connection each
+// and reports rejected recipients without stopping the others
+func TestSMTPSendBulkReusesConnections(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := newSMTPConfig(server, config.SMTPTLSNone)
+	cfg.SMTPBatchSize = 2
+	client := email.NewSMTPClient(cfg)
+
+	recipients := []string{"a@example.com", "b@example.com", "reject@example.com", "c@example.com", "d@example.com"}
+	err := client.SendBulkEmail(recipients, "Sale", "<p>Sale</p>", "Sale")
+	if err == nil || !strings.Contains(err.Error(), "reject@example.com") {
+		t.Fatalf("expected an error for the rejected recipient, got %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.connections != 3 {
+		t.Errorf("expected 3 connections, got %d", server.connections)
+	}
+	if len(server.messages) != 4 {
+		t.Errorf("expected 4 messages, got %d", len(server.messages))
+	}
+}
+
+// TestSMTPRejectedRecipient reports a recipient refused with a 5xx reply as
+// rejected, and one refused with a 4xx reply as a failure worth retrying
+func TestSMTPRejectedRecipient(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	client := email.NewSMTPClient(newSMTPConfig(server, config.SMTPTLSNone))
+
+	err := client.SendEmail("reject@example.com", "Hello", "<p>Hello</p>", "")
+	if !errors.Is(err, email.ErrRejected) {
+		t.Errorf("expected ErrRejected for a 550 reply, got %v", err)
+	}
+
+	err = client.SendEmail("busy@example.com", "Hello", "<p>Hello</p>", "")
+	if err == nil || errors.Is(err, email.ErrRejected) {
+		t.Errorf("expected a retryable error for a 451 reply, got %v", err)
+	}
+}
+
+// TestSMTPRequiresStartTLS refuses to send in plaintext when STARTTLS is
+// required but not offered
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	client := email.NewSMTPClient(newSMTPConfig(server, config.SMTPTLSStartTLS))
+	err := client.SendEmail("customer@example.com", "Hello", "<p>Hello</p>", "")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+
+	if len(server.messages) != 0 {
+		t.Errorf("expected no messages, got %d", len(server.messages))
+	}
+}
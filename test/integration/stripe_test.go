@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecommerce_project/pkg/payment"
+)
+
+// newFakeStripe starts a local HTTP server that answers the PaymentIntent
+// endpoints the way the Stripe API does
+func newFakeStripe(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/payment_intents", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test_fake" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if got := r.PostForm.Get("amount"); got != "2599" {
+			t.Errorf("amount = %s, want 2599", got)
+		}
+		if got := r.PostForm.Get("currency"); got != "usd" {
+			t.Errorf("currency = %s, want usd", got)
+		}
+		if got := r.PostForm.Get("metadata[order_id]"); got != "42" {
+			t.Errorf("metadata[order_id] = %s, want 42", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"pi_123","object":"payment_intent","amount":2599,"currency":"usd","client_secret":"pi_123_secret_abc","status":"requires_payment_method"}`))
+	})
+	mux.HandleFunc("/v1/refunds", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if got := r.PostForm.Get("payment_intent"); got != "pi_123" {
+			t.Errorf("payment_intent = %s, want pi_123", got)
+		}
+		if got := r.PostForm.Get("amount"); got != "1000" {
+			t.Errorf("amount = %s, want 1000", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"re_123","object":"refund","amount":1000,"payment_intent":"pi_123","status":"succeeded"}`))
+	})
+	mux.HandleFunc("/v1/payment_intents/pi_123/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"pi_123","object":"payment_intent","status":"canceled"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestStripePaymentIntentFlow tests creating and cancelling a PaymentIntent
+// against a fake Stripe server
+func TestStripePaymentIntentFlow(t *testing.T) {
+	server := newFakeStripe(t)
+	client := payment.NewStripeClient("sk_test_fake", server.URL)
+
+	pi, err := client.CreatePaymentIntent(2599, "usd", map[string]string{"order_id": "42"})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent failed: %v", err)
+	}
+	if pi.ID != "pi_123" || pi.ClientSecret != "pi_123_secret_abc" {
+		t.Errorf("unexpected payment intent: id=%s client_secret=%s", pi.ID, pi.ClientSecret)
+	}
+
+	cancelled, err := client.CancelPaymentIntent(pi.ID)
+	if err != nil {
+		t.Fatalf("CancelPaymentIntent failed: %v", err)
+	}
+	if cancelled.Status != "canceled" {
+		t.Errorf("status = %s, want canceled", cancelled.Status)
+	}
+}
+
+// TestStripeRefund tests a partial refund against a fake Stripe server
+func TestStripeRefund(t *testing.T) {
+	server := newFakeStripe(t)
+	client := payment.NewStripeClient("sk_test_fake", server.URL)
+
+	refund, err := client.CreateRefund("pi_123", 1000, map[string]string{"refund_id": "1"})
+	if err != nil {
+		t.Fatalf("CreateRefund failed: %v", err)
+	}
+	if refund.ID != "re_123" || refund.Status != "succeeded" {
+		t.Errorf("unexpected refund: id=%s status=%s", refund.ID, refund.Status)
+	}
+}
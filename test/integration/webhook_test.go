@@ -0,0 +1,234 @@
+package integration
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v76/webhook"
+
+	"ecommerce_project/pkg/payment"
+)
+
+// TestStripeWebhookSignature tests that only correctly signed Stripe events
+// are accepted
+func TestStripeWebhookSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","object":"event","type":"payment_intent.succeeded","data":{"object":{"id":"pi_123","object":"payment_intent","amount":2599}}}`)
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  "whsec_test",
+	})
+
+	event, err := payment.ConstructStripeEvent(signed.Payload, signed.Header, "whsec_test")
+	if err != nil {
+		t.Fatalf("ConstructStripeEvent failed: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != "payment_intent.succeeded" {
+		t.Errorf("unexpected event: id=%s type=%s", event.ID, event.Type)
+	}
+
+	_, err = payment.ConstructStripeEvent(signed.Payload, signed.Header, "whsec_other")
+	if !errors.Is(err, payment.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for wrong secret, got %v", err)
+	}
+
+	tampered := []byte(`{"id":"evt_1","object":"event","type":"payment_intent.succeeded","data":{"object":{"id":"pi_123","object":"payment_intent","amount":1}}}`)
+	_, err = payment.ConstructStripeEvent(tampered, signed.Header, "whsec_test")
+	if !errors.Is(err, payment.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for tampered payload, got %v", err)
+	}
+}
+
+// snsCertURL is where the test serves its SNS signing certificate
+const snsCertURL = "https://sns.ap-southeast-1.amazonaws.com/SimpleNotificationService-test.pem"
+
+// snsTransport serves the signing certificate and records the URLs fetched
+type snsTransport struct {
+	certPEM []byte
+	fetched []string
+}
+
+func (t *snsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.fetched = append(t.fetched, req.URL.String())
+	body := []byte("ok")
+	if req.URL.String() == snsCertURL {
+		body = t.certPEM
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+}
+
+// newSNSSigner creates a key and a self-signed certificate standing in for
+// the SNS signing certificate
+func newSNSSigner(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// signSNS signs msg the way SNS does for its signature version
+func signSNS(t *testing.T, key *rsa.PrivateKey, msg *payment.SNSMessage) {
+	t.Helper()
+
+	stringToSign, err := msg.StringToSign()
+	if err != nil {
+		t.Fatalf("StringToSign failed: %v", err)
+	}
+
+	hash := crypto.SHA256
+	if msg.SignatureVersion == "1" {
+		hash = crypto.SHA1
+	}
+	h := hash.New()
+	h.Write([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+// TestBkashSNSSignature tests the verification of the SNS messages bKash
+// delivers its notifications as
+func TestBkashSNSSignature(t *testing.T) {
+	key, certPEM := newSNSSigner(t)
+
+	for _, version := range []string{"1", "2"} {
+		transport := &snsTransport{certPEM: certPEM}
+		verifier := payment.NewSNSVerifier(&http.Client{Transport: transport})
+
+		msg := &payment.SNSMessage{
+			Type:             payment.SNSNotification,
+			MessageID:        "9c4f1c4e-1b6e-5c7a-9d7b-1f2e3d4c5b6a",
+			TopicArn:         "arn:aws:sns:ap-southeast-1:123456789012:bkash",
+			Message:          `{"paymentID":"TR001","trxID":"AB12CD","transactionStatus":"Completed","amount":"120.50"}`,
+			Timestamp:        "2024-01-01T00:00:00.000Z",
+			SignatureVersion: version,
+			SigningCertURL:   snsCertURL,
+		}
+		signSNS(t, key, msg)
+
+		if err := verifier.Verify(msg); err != nil {
+			t.Errorf("v%s: valid message rejected: %v", version, err)
+		}
+
+		tampered := *msg
+		tampered.Message = `{"paymentID":"TR001","trxID":"AB12CD","transactionStatus":"Completed","amount":"1.00"}`
+		if err := verifier.Verify(&tampered); !errors.Is(err, payment.ErrInvalidSignature) {
+			t.Errorf("v%s: expected ErrInvalidSignature for tampered message, got %v", version, err)
+		}
+
+		withSubject := *msg
+		withSubject.Subject = "bKash"
+		if err := verifier.Verify(&withSubject); !errors.Is(err, payment.ErrInvalidSignature) {
+			t.Errorf("v%s: expected ErrInvalidSignature for added subject, got %v", version, err)
+		}
+
+		if len(transport.fetched) != 1 {
+			t.Errorf("v%s: expected the certificate to be downloaded once, got %v", version, transport.fetched)
+		}
+	}
+}
+
+// TestBkashSNSCertificateHost tests that signing certificates are only
+// downloaded from SNS over HTTPS
+func TestBkashSNSCertificateHost(t *testing.T) {
+	key, certPEM := newSNSSigner(t)
+
+	for _, certURL := range []string{
+		"http://sns.ap-southeast-1.amazonaws.com/cert.pem",
+		"https://sns.ap-southeast-1.amazonaws.com.example.com/cert.pem",
+		"https://example.com/sns.ap-southeast-1.amazonaws.com/cert.pem",
+		"https://s3.amazonaws.com/cert.pem",
+		"https://sns.ap-southeast-1.amazonaws.com:8443/cert.pem",
+	} {
+		transport := &snsTransport{certPEM: certPEM}
+		verifier := payment.NewSNSVerifier(&http.Client{Transport: transport})
+
+		msg := &payment.SNSMessage{
+			Type:             payment.SNSNotification,
+			MessageID:        "1",
+			TopicArn:         "arn:aws:sns:ap-southeast-1:123456789012:bkash",
+			Message:          "{}",
+			Timestamp:        "2024-01-01T00:00:00.000Z",
+			SignatureVersion: "1",
+			SigningCertURL:   certURL,
+		}
+		signSNS(t, key, msg)
+
+		if err := verifier.Verify(msg); !errors.Is(err, payment.ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", certURL, err)
+		}
+		if len(transport.fetched) != 0 {
+			t.Errorf("%s: certificate should not be downloaded, fetched %v", certURL, transport.fetched)
+		}
+	}
+}
+
+// TestBkashSNSSubscriptionConfirmation tests that subscriptions are
+// confirmed by visiting an SNS subscribe URL only
+func TestBkashSNSSubscriptionConfirmation(t *testing.T) {
+	key, certPEM := newSNSSigner(t)
+	transport := &snsTransport{certPEM: certPEM}
+	verifier := payment.NewSNSVerifier(&http.Client{Transport: transport})
+
+	subscribeURL := "https://sns.ap-southeast-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=arn:aws:sns:ap-southeast-1:123456789012:bkash&Token=abc"
+	payload := []byte(`{
+		"Type": "SubscriptionConfirmation",
+		"MessageId": "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		"Token": "abc",
+		"TopicArn": "arn:aws:sns:ap-southeast-1:123456789012:bkash",
+		"Message": "You have chosen to subscribe to the topic.",
+		"SubscribeURL": "` + subscribeURL + `",
+		"Timestamp": "2024-01-01T00:00:00.000Z",
+		"SignatureVersion": "2",
+		"SigningCertURL": "` + snsCertURL + `"
+	}`)
+
+	msg, err := payment.ParseSNSMessage(payload)
+	if err != nil {
+		t.Fatalf("ParseSNSMessage failed: %v", err)
+	}
+	signSNS(t, key, msg)
+
+	if err := verifier.Verify(msg); err != nil {
+		t.Fatalf("valid confirmation rejected: %v", err)
+	}
+	if err := verifier.ConfirmSubscription(msg); err != nil {
+		t.Fatalf("ConfirmSubscription failed: %v", err)
+	}
+	if last := transport.fetched[len(transport.fetched)-1]; last != subscribeURL {
+		t.Errorf("expected the subscribe URL to be visited, got %s", last)
+	}
+
+	foreign := *msg
+	foreign.SubscribeURL = "https://example.com/confirm"
+	if err := verifier.ConfirmSubscription(&foreign); err == nil {
+		t.Error("expected a subscribe URL outside SNS to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ecommerce_project/pkg/cache"
+	"ecommerce_project/pkg/logger"
+)
+
+// TestRememberLoadsOnce serves the second read from the cache and reloads
+// after invalidation
+func TestRememberLoadsOnce(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	store := cache.NewMemory()
+
+	loads := 0
+	read := func() []string {
+		var names []string
+		err := cache.Remember(ctx, store, "categories:list", time.Minute, &names, func() error {
+			loads++
+			names = []string{"Books", "Games"}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Remember failed: %v", err)
+		}
+		return names
+	}
+
+	read()
+	if names := read(); len(names) != 2 || names[1] != "Games" {
+		t.Errorf("unexpected cached value %v", names)
+	}
+	if loads != 1 {
+		t.Errorf("expected 1 load, got %d", loads)
+	}
+
+	cache.Invalidate(ctx, store, "categories:list")
+	read()
+	if loads != 2 {
+		t.Errorf("expected a reload after invalidation, got %d loads", loads)
+	}
+}
+
+// TestRememberDoesNotCacheErrors returns load errors without caching
+func TestRememberDoesNotCacheErrors(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	store := cache.NewMemory()
+
+	notFound := errors.New("product not found")
+	var value string
+	err := cache.Remember(ctx, store, "product:1", time.Minute, &value, func() error { return notFound })
+	if !errors.Is(err, notFound) {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+	if _, err := store.Get(ctx, "product:1"); !errors.Is(err, cache.ErrMiss) {
+		t.Errorf("expected a miss, got %v", err)
+	}
+}
+
+// TestMemoryExpiryAndGenerations expires entries and advances generation
+// counters
+func TestMemoryExpiryAndGenerations(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	store := cache.NewMemory()
+
+	if err := store.Set(ctx, "short", []byte("x"), time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Get(ctx, "short"); !errors.Is(err, cache.ErrMiss) {
+		t.Errorf("expected the entry to expire, got %v", err)
+	}
+
+	if gen := cache.Generation(ctx, store, "products:list:generation"); gen != "0" {
+		t.Errorf("initial generation = %q", gen)
+	}
+	cache.Bump(ctx, store, "products:list:generation")
+	cache.Bump(ctx, store, "products:list:generation")
+	if gen := cache.Generation(ctx, store, "products:list:generation"); gen != "2" {
+		t.Errorf("generation = %q, want 2", gen)
+	}
+}
@@ -0,0 +1,159 @@
+package user
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ecommerce_project/internal/config"
+)
+
+// writeConfig writes YAML files into a temporary directory, points
+// CONFIG_FILE at app.yaml and clears variables that would override it
+func writeConfig(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "app.yaml"))
+	for _, key := range []string{"ENVIRONMENT", "DB_HOST", "DB_PORT", "DB_PASSWORD", "JWT_SECRET", "STRIPE_SECRET_KEY", "STRIPE_WEBHOOK_SECRET", "STRIPE_API_BASE_URL", "BKASH_APP_KEY", "BKASH_BASE_URL", "NOTIFICATION_SINK"} {
+		t.Setenv(key, "")
+	}
+}
+
+// TestLoadMergesProfileAndEnvironment applies app.yaml, then the profile
+// of the environment, then environment variables
+func TestLoadMergesProfileAndEnvironment(t *testing.T) {
+	writeConfig(t, map[string]string{
+		"app.yaml": `
+server:
+  port: "9000"
+database:
+  host: localhost
+  password: postgres
+jwt:
+  secret: your-secret-key-change-in-production
+`,
+		"app.staging.yaml": `
+database:
+  host: staging-db
+jwt:
+  secret: a-staging-secret-that-is-long-enough
+`,
+	})
+	t.Setenv("ENVIRONMENT", "staging")
+	t.Setenv("DB_PORT", "6543")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Server.Port != "9000" {
+		t.Errorf("server port = %q, want the value from app.yaml", cfg.Server.Port)
+	}
+	if cfg.Database.Host != "staging-db" {
+		t.Errorf("database host = %q, want the value from the profile", cfg.Database.Host)
+	}
+	if cfg.Database.Port != "6543" {
+		t.Errorf("database port = %q, want the value from the environment", cfg.Database.Port)
+	}
+	if cfg.Redis.Host != "localhost" || cfg.Database.MaxOpenConns != 25 {
+		t.Errorf("defaults were not kept: %+v %+v", cfg.Redis, cfg.Database)
+	}
+}
+
+// TestLoadRejectsPlaceholdersInProduction refuses the example JWT secret
+// and missing payment keys in production
+func TestLoadRejectsPlaceholdersInProduction(t *testing.T) {
+	writeConfig(t, map[string]string{
+		"app.yaml": `
+database:
+  password: postgres
+jwt:
+  secret: your-secret-key-change-in-production
+payment:
+  stripe_secret_key: sk_test_...
+`,
+	})
+	t.Setenv("ENVIRONMENT", "production")
+
+	_, err := config.Load()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"JWT_SECRET", "STRIPE_SECRET_KEY", "STRIPE_WEBHOOK_SECRET"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected an error about %s, got %v", key, err)
+		}
+	}
+
+	// The same file is fine for development
+	t.Setenv("ENVIRONMENT", "development")
+	if _, err := config.Load(); err != nil {
+		t.Errorf("Load failed in development: %v", err)
+	}
+}
+
+// TestLoadRejectsSandboxGatewaysInProduction refuses the bKash sandbox and
+// Stripe API hosts other than Stripe's in production
+func TestLoadRejectsSandboxGatewaysInProduction(t *testing.T) {
+	writeConfig(t, map[string]string{
+		"app.yaml": `
+server:
+  environment: production
+database:
+  password: a-production-password
+jwt:
+  secret: a-production-secret-that-is-long-enough
+notification:
+  sink: live
+payment:
+  stripe_secret_key: sk_live_abc
+  stripe_webhook_secret: whsec_abc
+  stripe_api_base_url: http://localhost:12111
+  bkash_app_key: app-key
+  bkash_app_secret: app-secret
+  bkash_username: merchant
+  bkash_password: merchant-password
+  bkash_base_url: https://tokenized.sandbox.bka.sh/v1.2.0-beta
+  bkash_callback_url: https://api.example.com/api/v1/payments/bkash/callback
+  bkash_webhook_topic_arn: arn:aws:sns:ap-southeast-1:123456789012:bkash
+`,
+	})
+
+	_, err := config.Load()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"STRIPE_API_BASE_URL", "BKASH_BASE_URL"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected an error about %s, got %v", key, err)
+		}
+	}
+
+	t.Setenv("STRIPE_API_BASE_URL", "https://api.stripe.com")
+	t.Setenv("BKASH_BASE_URL", "https://tokenized.pay.bka.sh/v1.2.0-beta")
+	if _, err := config.Load(); err != nil {
+		t.Errorf("Load failed with the production gateways: %v", err)
+	}
+}
+
+// TestLoadRejectsUnknownKeys reports misspelled settings instead of
+// ignoring them
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	writeConfig(t, map[string]string{
+		"app.yaml": `
+database:
+  pasword: postgres
+`,
+	})
+
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "pasword") {
+		t.Fatalf("expected an error about the unknown key, got %v", err)
+	}
+}
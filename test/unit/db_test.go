@@ -0,0 +1,145 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecommerce_project/internal/app"
+	"ecommerce_project/pkg/db"
+	"ecommerce_project/pkg/logger"
+)
+
+// poolConnector opens connections to a fake server that is either
+// reachable or not
+type poolConnector struct {
+	down bool
+}
+
+func (c *poolConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.down {
+		return nil, errors.New("connection refused")
+	}
+	return &poolConn{}, nil
+}
+func (c *poolConnector) Driver() driver.Driver { return nil }
+
+type poolConn struct{}
+
+func (c *poolConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *poolConn) Close() error                   { return nil }
+func (c *poolConn) Begin() (driver.Tx, error)      { return nil, errors.New("not supported") }
+func (c *poolConn) Ping(ctx context.Context) error { return nil }
+
+// newPool returns a pool of a fake server
+func newPool(t *testing.T, down bool) *sql.DB {
+	pool := sql.OpenDB(&poolConnector{down: down})
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+// TestReaderWithoutReplicas reads from the primary
+func TestReaderWithoutReplicas(t *testing.T) {
+	primary := newPool(t, false)
+	database := db.New(primary)
+
+	for i := 0; i < 3; i++ {
+		if database.Reader() != primary {
+			t.Fatalf("read %d did not use the primary", i)
+		}
+	}
+}
+
+// TestReaderWithOneReplica reads from the replica only
+func TestReaderWithOneReplica(t *testing.T) {
+	primary, replica := newPool(t, false), newPool(t, false)
+	database := db.New(primary, replica)
+
+	for i := 0; i < 3; i++ {
+		if database.Reader() != replica {
+			t.Fatalf("read %d did not use the replica", i)
+		}
+	}
+}
+
+// TestReaderWithReplicas uses the replicas in turn
+func TestReaderWithReplicas(t *testing.T) {
+	primary := newPool(t, false)
+	replicas := []*sql.DB{newPool(t, false), newPool(t, false), newPool(t, false)}
+	database := db.New(primary, replicas...)
+
+	for i := 0; i < 2*len(replicas); i++ {
+		if got := database.Reader(); got != replicas[i%len(replicas)] {
+			t.Fatalf("read %d used the wrong pool", i)
+		}
+	}
+}
+
+// TestDBHealth pings every pool, primary first
+func TestDBHealth(t *testing.T) {
+	database := db.New(newPool(t, false), newPool(t, true), newPool(t, false))
+
+	health := database.Health(context.Background())
+	if len(health) != 3 {
+		t.Fatalf("expected 3 pools, got %d", len(health))
+	}
+
+	want := []struct {
+		name string
+		up   bool
+	}{{"primary", true}, {"replica_1", false}, {"replica_2", true}}
+	for i, w := range want {
+		if health[i].Name != w.name || (health[i].Err == nil) != w.up {
+			t.Errorf("pool %d is %s with error %v, want %s up=%v", i, health[i].Name, health[i].Err, w.name, w.up)
+		}
+	}
+}
+
+// TestHealthHandlerStatus reports each pool as up or down, degrades when a
+// replica is down and fails when the primary is
+func TestHealthHandlerStatus(t *testing.T) {
+	logger.Init()
+
+	tests := []struct {
+		name        string
+		primaryDown bool
+		replicaDown bool
+		code        int
+		status      string
+		pools       []string
+	}{
+		{"all up", false, false, http.StatusOK, "healthy", []string{"up", "up"}},
+		{"replica down", false, true, http.StatusOK, "degraded", []string{"up", "down"}},
+		{"primary down", true, false, http.StatusServiceUnavailable, "unhealthy", []string{"down", "up"}},
+	}
+
+	for _, tt := range tests {
+		database := db.New(newPool(t, tt.primaryDown), newPool(t, tt.replicaDown))
+
+		rec := httptest.NewRecorder()
+		app.NewHealthHandler(database, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		var response app.HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: invalid response: %v", tt.name, err)
+		}
+		if rec.Code != tt.code || response.Status != tt.status {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, rec.Code, response.Status, tt.code, tt.status)
+		}
+		if len(response.Database) != len(tt.pools) {
+			t.Fatalf("%s: expected %d pools, got %d", tt.name, len(tt.pools), len(response.Database))
+		}
+		for i, status := range tt.pools {
+			if response.Database[i].Status != status {
+				t.Errorf("%s: pool %s is %s, want %s", tt.name, response.Database[i].Name, response.Database[i].Status, status)
+			}
+		}
+	}
+}
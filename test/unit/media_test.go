@@ -0,0 +1,110 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ecommerce_project/pkg/media"
+	"ecommerce_project/pkg/storage"
+)
+
+// encodePNG returns a width x height PNG image
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestFitKeepsAspectRatio scales the longest side down to the thumbnail
+// size and never scales up
+func TestFitKeepsAspectRatio(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+
+	if got := media.Fit(src, 160).Bounds(); got.Dx() != 160 || got.Dy() != 80 {
+		t.Errorf("thumbnail is %dx%d, want 160x80", got.Dx(), got.Dy())
+	}
+	if got := media.Fit(src, 1200).Bounds(); got.Dx() != 800 || got.Dy() != 400 {
+		t.Errorf("thumbnail is %dx%d, want the original 800x400", got.Dx(), got.Dy())
+	}
+}
+
+// TestFitFromLargerThumbnail scales a thumbnail from a larger one, as the
+// uploader does, and gets the same pixels as scaling the original
+func TestFitFromLargerThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 960, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 960; x++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x / 4), G: uint8(y / 2), B: 200, A: 255})
+		}
+	}
+
+	direct := media.Fit(src, 160).(*image.RGBA)
+	derived := media.Fit(media.Fit(src, 480), 160).(*image.RGBA)
+	if derived.Bounds() != direct.Bounds() {
+		t.Fatalf("derived thumbnail is %v, want %v", derived.Bounds(), direct.Bounds())
+	}
+	for i := range direct.Pix {
+		if diff := int(direct.Pix[i]) - int(derived.Pix[i]); diff < -1 || diff > 1 {
+			t.Fatalf("pixel byte %d is %d, want %d", i, derived.Pix[i], direct.Pix[i])
+		}
+	}
+}
+
+// TestUploaderStoresThumbnails uploads an image to local storage and
+// serves it back, and rejects files that are not images or too large
+func TestUploaderStoresThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	local := storage.NewLocal(dir, "")
+	uploader := media.NewUploader(local, 1<<20)
+	ctx := context.Background()
+
+	upload, err := uploader.Upload(ctx, "products/1", encodePNG(t, 600, 300))
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if upload.ContentType != "image/png" || upload.Width != 600 || upload.Height != 300 {
+		t.Errorf("unexpected upload %+v", upload)
+	}
+	if len(upload.Keys) != len(media.ThumbnailSizes)+1 || len(upload.Thumbnails) != len(media.ThumbnailSizes) {
+		t.Fatalf("expected the original and %d thumbnails, got %v", len(media.ThumbnailSizes), upload.Keys)
+	}
+	if !strings.HasPrefix(upload.URL, storage.LocalPrefix+"products/1/") {
+		t.Errorf("unexpected URL %q", upload.URL)
+	}
+
+	server := httptest.NewServer(http.StripPrefix(storage.LocalPrefix, local.Handler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + upload.Thumbnails["small"])
+	if err != nil {
+		t.Fatalf("failed to get thumbnail: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("thumbnail served with %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	uploader.Delete(ctx, upload.Keys)
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(upload.Keys[0]))); !os.IsNotExist(err) {
+		t.Errorf("expected the original to be deleted, got %v", err)
+	}
+
+	if _, err := uploader.Upload(ctx, "products/1", []byte("<html></html>")); !errors.Is(err, media.ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+	if _, err := uploader.Upload(ctx, "products/1", make([]byte, 2<<20)); !errors.Is(err, media.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
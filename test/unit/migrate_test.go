@@ -0,0 +1,89 @@
+package user
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"ecommerce_project/migrations"
+	"ecommerce_project/pkg/db"
+)
+
+// TestLoadMigrations pairs up and down files and sorts them by version
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_wishlists.up.sql":    {Data: []byte("CREATE TABLE wishlists ();")},
+		"0002_add_wishlists.down.sql":  {Data: []byte("DROP TABLE wishlists;")},
+		"0001_initial_schema.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+		"0001_initial_schema.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations.go":                {Data: []byte("package migrations")},
+	}
+
+	loaded, err := db.LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+
+	if len(loaded) != 2 || loaded[0].Version != 1 || loaded[1].Version != 2 {
+		t.Fatalf("unexpected migrations %+v", loaded)
+	}
+	if loaded[1].Name != "add_wishlists" || loaded[1].Down != "DROP TABLE wishlists;" {
+		t.Errorf("unexpected migration %+v", loaded[1])
+	}
+}
+
+// TestLoadMigrationsRejectsInvalidFiles requires a down file for every up
+// file and well-formed names
+func TestLoadMigrationsRejectsInvalidFiles(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_initial_schema.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"invalid name": {
+			"initial_schema.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"mismatched names": {
+			"0001_initial_schema.up.sql": {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql":        {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range cases {
+		if _, err := db.LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestEmbeddedMigrations checks that the shipped migrations load
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(loaded) == 0 || loaded[0].Version != 1 {
+		t.Fatalf("unexpected migrations %+v", loaded)
+	}
+}
+
+// TestCreateMigration numbers new files after the highest version
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	up, down, err := db.CreateMigration(dir, "Add Wishlists")
+	if err != nil {
+		t.Fatalf("CreateMigration failed: %v", err)
+	}
+	if filepath.Base(up) != "0001_add_wishlists.up.sql" || filepath.Base(down) != "0001_add_wishlists.down.sql" {
+		t.Errorf("unexpected files %s, %s", up, down)
+	}
+
+	up, _, err = db.CreateMigration(dir, "add-reviews")
+	if err != nil {
+		t.Fatalf("CreateMigration failed: %v", err)
+	}
+	if !strings.HasSuffix(up, "0002_add_reviews.up.sql") {
+		t.Errorf("unexpected file %s", up)
+	}
+}
@@ -0,0 +1,61 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/notification"
+	"ecommerce_project/pkg/email"
+)
+
+// TestRetryDelay doubles the delay after every failure up to an hour
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := notification.RetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("RetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// fakeMailer fails every email with err
+type fakeMailer struct {
+	err error
+}
+
+func (f *fakeMailer) SendEmail(to, subject, htmlBody, textBody string) error {
+	return f.err
+}
+
+// TestEmailChannelUndeliverable dead-letters emails the SMTP server rejects
+// and leaves other failures to be retried
+func TestEmailChannelUndeliverable(t *testing.T) {
+	msg := &notification.OutboxMessage{Recipient: "customer@example.com", Subject: "Hello", Body: "<p>Hello</p>"}
+
+	rejected := notification.NewEmailChannel(&fakeMailer{err: fmt.Errorf("%w: 550 No such user", email.ErrRejected)})
+	if err := rejected.Send(context.Background(), msg); !errors.Is(err, notification.ErrUndeliverable) {
+		t.Errorf("expected ErrUndeliverable, got %v", err)
+	}
+
+	failed := notification.NewEmailChannel(&fakeMailer{err: errors.New("failed to connect to SMTP server")})
+	if err := failed.Send(context.Background(), msg); err == nil || errors.Is(err, notification.ErrUndeliverable) {
+		t.Errorf("expected a retryable error, got %v", err)
+	}
+}
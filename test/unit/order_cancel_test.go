@@ -0,0 +1,342 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/order"
+)
+
+// orderDB is an in-memory stand-in for Postgres that answers the queries
+// the order repository runs while placing and cancelling an order. A
+// rolled back transaction restores the state it started with.
+type orderDB struct {
+	order      *order.Order
+	history    []string
+	committed  int
+	rolledBack int
+	snapshot   *orderDB
+}
+
+// copyState returns a copy of the order and history of the database
+func (d *orderDB) copyState() *orderDB {
+	c := &orderDB{history: append([]string{}, d.history...)}
+	if d.order != nil {
+		o := *d.order
+		o.Items = append([]order.OrderItem{}, d.order.Items...)
+		c.order = &o
+	}
+	return c
+}
+
+func (d *orderDB) Connect(ctx context.Context) (driver.Conn, error) { return &orderConn{db: d}, nil }
+func (d *orderDB) Driver() driver.Driver                            { return nil }
+
+type orderConn struct {
+	db *orderDB
+}
+
+func (c *orderConn) Prepare(query string) (driver.Stmt, error) {
+	return &orderStmt{db: c.db, query: query}, nil
+}
+func (c *orderConn) Close() error { return nil }
+
+func (c *orderConn) Begin() (driver.Tx, error) {
+	c.db.snapshot = c.db.copyState()
+	return c, nil
+}
+
+func (c *orderConn) Commit() error {
+	c.db.committed++
+	c.db.snapshot = nil
+	return nil
+}
+
+func (c *orderConn) Rollback() error {
+	c.db.rolledBack++
+	c.db.order, c.db.history = c.db.snapshot.order, c.db.snapshot.history
+	c.db.snapshot = nil
+	return nil
+}
+
+type orderStmt struct {
+	db    *orderDB
+	query string
+}
+
+func (s *orderStmt) Close() error  { return nil }
+func (s *orderStmt) NumInput() int { return -1 }
+
+// paymentStatusList matches the payment statuses a query selects orders by
+var paymentStatusList = regexp.MustCompile(`payment_status IN \(([^)]*)\)`)
+
+func (s *orderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "WITH cancelled AS") {
+		return s.cancelUnpaid(args)
+	}
+	if !strings.Contains(s.query, "UPDATE orders SET status") {
+		return nil, fmt.Errorf("unexpected exec: %s", s.query)
+	}
+
+	// UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4
+	if args[3] != s.db.order.Status {
+		return driver.RowsAffected(0), nil
+	}
+	s.db.order.Status = args[0].(string)
+	return driver.RowsAffected(1), nil
+}
+
+// cancelUnpaid applies CancelUnpaid to the order if it is pending and its
+// payment status is one the query lists
+func (s *orderStmt) cancelUnpaid(args []driver.Value) (driver.Result, error) {
+	o := s.db.order
+	match := paymentStatusList.FindStringSubmatch(s.query)
+	if match == nil {
+		return nil, fmt.Errorf("unexpected cancel query: %s", s.query)
+	}
+	if o.Status != order.StatusPending || !strings.Contains(match[1], "'"+o.PaymentStatus+"'") {
+		return driver.RowsAffected(0), nil
+	}
+
+	o.Status = order.StatusCancelled
+	s.db.history = append(s.db.history, "pending->cancelled")
+	return driver.RowsAffected(1), nil
+}
+
+func (s *orderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	o := s.db.order
+	switch {
+	case strings.Contains(s.query, "FROM orders"):
+		return &orderRows{
+			columns: make([]string, 13),
+			values: [][]driver.Value{{
+				o.ID, o.UserID, o.OrderNumber, o.Status, o.PaymentStatus, o.Subtotal, o.Tax,
+				o.ShippingCost, o.Total, o.ShippingAddress, o.BillingAddress, time.Now(), time.Now(),
+			}},
+		}, nil
+	case strings.Contains(s.query, "FROM order_items"):
+		rows := &orderRows{columns: make([]string, 8)}
+		for _, item := range o.Items {
+			rows.values = append(rows.values, []driver.Value{
+				item.ID, o.ID, item.ProductID, item.VariantID, int64(item.Quantity), item.Price, item.Subtotal, time.Now(),
+			})
+		}
+		return rows, nil
+	case strings.Contains(s.query, "INSERT INTO orders"):
+		// INSERT INTO orders (user_id, order_number, status, payment_status, ...)
+		s.db.order = &order.Order{
+			ID:            7,
+			UserID:        args[0].(int64),
+			OrderNumber:   args[1].(string),
+			Status:        args[2].(string),
+			PaymentStatus: args[3].(string),
+			Total:         args[7].(float64),
+		}
+		return &orderRows{
+			columns: make([]string, 3),
+			values:  [][]driver.Value{{s.db.order.ID, time.Now(), time.Now()}},
+		}, nil
+	case strings.Contains(s.query, "INSERT INTO order_items"):
+		// INSERT INTO order_items (order_id, product_id, variant_id, quantity, price, subtotal, created_at)
+		item := order.OrderItem{
+			ID:        int64(len(o.Items) + 1),
+			ProductID: args[1].(int64),
+			VariantID: args[2].(int64),
+			Quantity:  int(args[3].(int64)),
+			Price:     args[4].(float64),
+		}
+		o.Items = append(o.Items, item)
+		return &orderRows{
+			columns: make([]string, 2),
+			values:  [][]driver.Value{{item.ID, time.Now()}},
+		}, nil
+	case strings.Contains(s.query, "INSERT INTO order_status_history"):
+		s.db.history = append(s.db.history, fmt.Sprintf("%v->%v", args[1], args[2]))
+		return &orderRows{
+			columns: make([]string, 2),
+			values:  [][]driver.Value{{int64(len(s.db.history)), time.Now()}},
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+type orderRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *orderRows) Columns() []string { return r.columns }
+func (r *orderRows) Close() error      { return nil }
+
+func (r *orderRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeInventory records what the order service returns to inventory
+type fakeInventory struct {
+	hasReservations bool
+	released        bool
+	restockedOrder  bool
+	restocked       map[int64]int
+	expired         []int64
+	reserved        map[int64]int
+	reserveErr      error
+}
+
+func (f *fakeInventory) CheckStock(ctx context.Context, variantID int64, quantity int) (bool, error) {
+	return true, nil
+}
+func (f *fakeInventory) Reserve(ctx context.Context, orderID, variantID int64, quantity int, expiresAt time.Time) error {
+	if f.reserveErr != nil {
+		return f.reserveErr
+	}
+	f.reserved[variantID] += quantity
+	return nil
+}
+func (f *fakeInventory) CommitReservations(ctx context.Context, orderID int64) error { return nil }
+func (f *fakeInventory) ReleaseReservations(ctx context.Context, orderID int64) error {
+	f.released = true
+	return nil
+}
+func (f *fakeInventory) RestockReservations(ctx context.Context, orderID int64) error {
+	f.restockedOrder = true
+	return nil
+}
+func (f *fakeInventory) HasReservations(ctx context.Context, orderID int64) (bool, error) {
+	return f.hasReservations, nil
+}
+func (f *fakeInventory) LockActiveReservations(ctx context.Context, orderID int64) (bool, error) {
+	return f.hasReservations, nil
+}
+func (f *fakeInventory) ExpiredReservationOrders(ctx context.Context) ([]int64, error) {
+	return f.expired, nil
+}
+func (f *fakeInventory) Restock(ctx context.Context, variantID int64, quantity int) error {
+	f.restocked[variantID] += quantity
+	return nil
+}
+func (f *fakeInventory) WithTx(tx *sql.Tx) order.InventoryRepository { return f }
+
+// fakePayments records the orders whose payments were cancelled
+type fakePayments struct {
+	cancelled []int64
+}
+
+func (f *fakePayments) CancelOrderPayment(ctx context.Context, orderID int64, reason string) error {
+	f.cancelled = append(f.cancelled, orderID)
+	return nil
+}
+
+func newCancelService(o *order.Order, inventory *fakeInventory, payments *fakePayments) (*order.Service, *orderDB) {
+	state := &orderDB{order: o}
+	conn := sql.OpenDB(state)
+	return order.NewService(conn, order.NewRepository(conn), nil, inventory, payments, nil, nil, time.Minute), state
+}
+
+func testOrder(status string) *order.Order {
+	return &order.Order{
+		ID:            7,
+		UserID:        3,
+		Status:        status,
+		PaymentStatus: "paid",
+		Items: []order.OrderItem{
+			{ID: 1, ProductID: 10, VariantID: 100, Quantity: 2},
+			{ID: 2, ProductID: 11, VariantID: 101, Quantity: 1},
+		},
+	}
+}
+
+// TestCancelReleasesReservationsAndVoidsPayment returns reserved stock and
+// cancels the order's payment
+func TestCancelReleasesReservationsAndVoidsPayment(t *testing.T) {
+	inventory := &fakeInventory{hasReservations: true, restocked: map[int64]int{}}
+	payments := &fakePayments{}
+	service, state := newCancelService(testOrder(order.StatusConfirmed), inventory, payments)
+
+	if err := service.Cancel(context.Background(), 7, 3, ""); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	if state.order.Status != order.StatusCancelled {
+		t.Errorf("order status = %s, want cancelled", state.order.Status)
+	}
+	if len(state.history) != 1 || state.history[0] != "confirmed->cancelled" {
+		t.Errorf("history = %v, want [confirmed->cancelled]", state.history)
+	}
+	if !inventory.released || !inventory.restockedOrder {
+		t.Errorf("reservations released = %v, restocked = %v, want both", inventory.released, inventory.restockedOrder)
+	}
+	if len(inventory.restocked) != 0 {
+		t.Errorf("items restocked individually: %v", inventory.restocked)
+	}
+	if len(payments.cancelled) != 1 || payments.cancelled[0] != 7 {
+		t.Errorf("cancelled payments = %v, want [7]", payments.cancelled)
+	}
+}
+
+// TestCancelRestocksItemsWithoutReservations restocks orders placed before
+// stock was reserved item by item
+func TestCancelRestocksItemsWithoutReservations(t *testing.T) {
+	inventory := &fakeInventory{restocked: map[int64]int{}}
+	payments := &fakePayments{}
+	service, _ := newCancelService(testOrder(order.StatusPending), inventory, payments)
+
+	if err := service.Cancel(context.Background(), 7, 3, "changed my mind"); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	if inventory.restocked[100] != 2 || inventory.restocked[101] != 1 {
+		t.Errorf("restocked = %v, want map[100:2 101:1]", inventory.restocked)
+	}
+	if len(payments.cancelled) != 1 {
+		t.Errorf("cancelled payments = %v, want one", payments.cancelled)
+	}
+}
+
+// TestCancelRejectsShippedOrder leaves stock and payment of orders that can
+// no longer be cancelled alone
+func TestCancelRejectsShippedOrder(t *testing.T) {
+	inventory := &fakeInventory{hasReservations: true, restocked: map[int64]int{}}
+	payments := &fakePayments{}
+	service, state := newCancelService(testOrder(order.StatusShipped), inventory, payments)
+
+	if err := service.Cancel(context.Background(), 7, 3, ""); err == nil {
+		t.Fatal("expected cancelling a shipped order to fail")
+	}
+
+	if state.order.Status != order.StatusShipped {
+		t.Errorf("order status = %s, want shipped", state.order.Status)
+	}
+	if inventory.released || inventory.restockedOrder || len(inventory.restocked) != 0 {
+		t.Error("stock was returned for a shipped order")
+	}
+	if len(payments.cancelled) != 0 {
+		t.Errorf("cancelled payments = %v, want none", payments.cancelled)
+	}
+}
+
+// TestCancelRejectsOtherUsersOrder hides orders of other customers
+func TestCancelRejectsOtherUsersOrder(t *testing.T) {
+	inventory := &fakeInventory{restocked: map[int64]int{}}
+	payments := &fakePayments{}
+	service, _ := newCancelService(testOrder(order.StatusPending), inventory, payments)
+
+	if err := service.Cancel(context.Background(), 7, 4, ""); err == nil {
+		t.Fatal("expected cancelling another user's order to fail")
+	}
+	if len(payments.cancelled) != 0 || len(inventory.restocked) != 0 {
+		t.Error("another user's order was cancelled")
+	}
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/order"
+)
+
+// fakeCart is a cart with fixed items that records whether it was cleared
+type fakeCart struct {
+	items   []order.CartItem
+	cleared bool
+}
+
+func (f *fakeCart) GetOrCreate(ctx context.Context, userID int64) (*order.Cart, error) {
+	return &order.Cart{ID: 1}, nil
+}
+func (f *fakeCart) GetItems(ctx context.Context, cartID int64) ([]order.CartItem, error) {
+	return f.items, nil
+}
+func (f *fakeCart) Clear(ctx context.Context, cartID int64) error {
+	f.cleared = true
+	return nil
+}
+func (f *fakeCart) WithTx(tx *sql.Tx) order.CartRepository { return f }
+
+// allowCheckout lets every user place orders
+type allowCheckout struct{}
+
+func (allowCheckout) CanCheckout(ctx context.Context, userID int64) error { return nil }
+
+// fakeNotifier records the orders it was told about
+type fakeNotifier struct {
+	placed []int64
+}
+
+func (f *fakeNotifier) OrderPlaced(ctx context.Context, o *order.Order) error {
+	f.placed = append(f.placed, o.ID)
+	return nil
+}
+func (f *fakeNotifier) OrderShipped(ctx context.Context, o *order.Order) error { return nil }
+func (f *fakeNotifier) WithTx(tx *sql.Tx) order.Notifier                       { return f }
+
+func newCreateService(cart *fakeCart, inventory *fakeInventory, notifier *fakeNotifier) (*order.Service, *orderDB) {
+	state := &orderDB{}
+	conn := sql.OpenDB(state)
+	return order.NewService(conn, order.NewRepository(conn), cart, inventory, &fakePayments{}, allowCheckout{}, notifier, time.Minute), state
+}
+
+func testCart() *fakeCart {
+	return &fakeCart{items: []order.CartItem{
+		{ProductID: 10, VariantID: 100, Quantity: 2, Price: 5},
+		{ProductID: 11, VariantID: 101, Quantity: 1, Price: 20},
+	}}
+}
+
+// TestCreatePlacesOrderInOneTransaction stores the order and its items,
+// reserves their stock and clears the cart together
+func TestCreatePlacesOrderInOneTransaction(t *testing.T) {
+	cart := testCart()
+	inventory := &fakeInventory{reserved: map[int64]int{}}
+	notifier := &fakeNotifier{}
+	service, state := newCreateService(cart, inventory, notifier)
+
+	placed, err := service.Create(context.Background(), 3, &order.CreateOrderRequest{ShippingAddressID: 1, BillingAddressID: 1})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if state.committed != 1 || state.rolledBack != 0 {
+		t.Errorf("commits = %d, rollbacks = %d, want 1 and 0", state.committed, state.rolledBack)
+	}
+	if placed.Status != order.StatusPending || len(placed.Items) != 2 {
+		t.Errorf("placed order %+v, want pending with 2 items", placed)
+	}
+	if inventory.reserved[100] != 2 || inventory.reserved[101] != 1 {
+		t.Errorf("reserved = %v, want map[100:2 101:1]", inventory.reserved)
+	}
+	if !cart.cleared {
+		t.Error("cart was not cleared")
+	}
+	if len(notifier.placed) != 1 {
+		t.Errorf("placed notifications = %v, want one", notifier.placed)
+	}
+}
+
+// TestCreateRollsBackWhenReservationFails leaves no order behind and keeps
+// the cart when stock cannot be reserved
+func TestCreateRollsBackWhenReservationFails(t *testing.T) {
+	cart := testCart()
+	inventory := &fakeInventory{reserved: map[int64]int{}, reserveErr: errors.New("out of stock")}
+	notifier := &fakeNotifier{}
+	service, state := newCreateService(cart, inventory, notifier)
+
+	if _, err := service.Create(context.Background(), 3, &order.CreateOrderRequest{ShippingAddressID: 1, BillingAddressID: 1}); err == nil {
+		t.Fatal("expected Create to fail when stock cannot be reserved")
+	}
+
+	if state.rolledBack != 1 || state.committed != 0 {
+		t.Errorf("commits = %d, rollbacks = %d, want 0 and 1", state.committed, state.rolledBack)
+	}
+	if state.order != nil || len(state.history) != 0 {
+		t.Errorf("order %+v and history %v survived the rollback", state.order, state.history)
+	}
+	if cart.cleared {
+		t.Error("cart was cleared")
+	}
+	if len(notifier.placed) != 0 {
+		t.Errorf("placed notifications = %v, want none", notifier.placed)
+	}
+}
@@ -0,0 +1,69 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"ecommerce_project/internal/order"
+	"ecommerce_project/pkg/logger"
+)
+
+// TestExpireReservationsCancelsUnpaidOrders cancels pending orders whose
+// reservations expired, whether no payment was made or the last one
+// failed, and cancels their open payments
+func TestExpireReservationsCancelsUnpaidOrders(t *testing.T) {
+	logger.Init()
+
+	for _, paymentStatus := range []string{"pending", "failed"} {
+		o := testOrder(order.StatusPending)
+		o.PaymentStatus = paymentStatus
+		inventory := &fakeInventory{hasReservations: true, expired: []int64{o.ID}, restocked: map[int64]int{}}
+		payments := &fakePayments{}
+		service, state := newCancelService(o, inventory, payments)
+
+		cancelled, err := service.ExpireReservations(context.Background())
+		if err != nil {
+			t.Fatalf("ExpireReservations failed: %v", err)
+		}
+
+		if cancelled != 1 || state.order.Status != order.StatusCancelled {
+			t.Errorf("payment %s: cancelled %d orders, order status %s; want 1, cancelled", paymentStatus, cancelled, state.order.Status)
+		}
+		if !inventory.released {
+			t.Errorf("payment %s: reservations were not released", paymentStatus)
+		}
+		if inventory.restockedOrder || len(inventory.restocked) != 0 {
+			t.Errorf("payment %s: reserved stock was restocked", paymentStatus)
+		}
+		if len(payments.cancelled) != 1 || payments.cancelled[0] != o.ID {
+			t.Errorf("payment %s: cancelled payments = %v, want [%d]", paymentStatus, payments.cancelled, o.ID)
+		}
+	}
+}
+
+// TestExpireReservationsSkipsPaidOrders leaves orders that were paid after
+// they were found alone
+func TestExpireReservationsSkipsPaidOrders(t *testing.T) {
+	logger.Init()
+
+	o := testOrder(order.StatusPending)
+	o.PaymentStatus = "paid"
+	inventory := &fakeInventory{hasReservations: true, expired: []int64{o.ID}, restocked: map[int64]int{}}
+	payments := &fakePayments{}
+	service, state := newCancelService(o, inventory, payments)
+
+	cancelled, err := service.ExpireReservations(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireReservations failed: %v", err)
+	}
+
+	if cancelled != 0 || state.order.Status != order.StatusPending {
+		t.Errorf("cancelled %d orders, order status %s; want 0, pending", cancelled, state.order.Status)
+	}
+	if inventory.released {
+		t.Error("reservations of a paid order were released")
+	}
+	if len(payments.cancelled) != 0 {
+		t.Errorf("cancelled payments = %v, want none", payments.cancelled)
+	}
+}
@@ -0,0 +1,37 @@
+package user
+
+import (
+	"testing"
+
+	"ecommerce_project/internal/order"
+)
+
+// TestValidateTransition allows only the transitions of the order lifecycle
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{order.StatusPending, order.StatusConfirmed, true},
+		{order.StatusPending, order.StatusCancelled, true},
+		{order.StatusConfirmed, order.StatusShipped, true},
+		{order.StatusConfirmed, order.StatusCancelled, true},
+		{order.StatusShipped, order.StatusDelivered, true},
+		{order.StatusPending, order.StatusShipped, false},
+		{order.StatusPending, order.StatusDelivered, false},
+		{order.StatusConfirmed, order.StatusPending, false},
+		{order.StatusShipped, order.StatusCancelled, false},
+		{order.StatusDelivered, order.StatusCancelled, false},
+		{order.StatusCancelled, order.StatusPending, false},
+		{order.StatusPending, order.StatusPending, false},
+		{order.StatusPending, "refunded", false},
+		{"unknown", order.StatusConfirmed, false},
+	}
+
+	for _, tt := range tests {
+		err := order.ValidateTransition(tt.from, tt.to)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateTransition(%q, %q) error = %v, want valid %v", tt.from, tt.to, err, tt.valid)
+		}
+	}
+}
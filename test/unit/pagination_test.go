@@ -0,0 +1,63 @@
+package user
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"ecommerce_project/pkg/pagination"
+)
+
+// TestPaginationParse applies the default and maximum page sizes and
+// rejects malformed or conflicting parameters
+func TestPaginationParse(t *testing.T) {
+	page, err := pagination.Parse(url.Values{}, pagination.DefaultLimit)
+	if err != nil || page.Limit != pagination.DefaultLimit || page.Offset != 0 || page.Cursor != nil {
+		t.Fatalf("unexpected default page %+v, %v", page, err)
+	}
+
+	page, err = pagination.Parse(url.Values{"limit": {"5000"}, "offset": {"40"}}, pagination.DefaultLimit)
+	if err != nil || page.Limit != pagination.MaxLimit || page.Offset != 40 {
+		t.Errorf("unexpected page %+v, %v", page, err)
+	}
+
+	cursor := pagination.TimeCursor(time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC), 421).Encode()
+	for name, query := range map[string]url.Values{
+		"zero limit":        {"limit": {"0"}},
+		"negative offset":   {"offset": {"-1"}},
+		"offset and cursor": {"offset": {"20"}, "cursor": {cursor}},
+		"garbled cursor":    {"cursor": {"not-a-cursor"}},
+	} {
+		if _, err := pagination.Parse(query, pagination.DefaultLimit); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestPaginationCursorRoundTrip decodes the cursor of a page back to the
+// key and ID of its last item
+func TestPaginationCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 10, 17, 9, 30, 0, 123456000, time.UTC)
+	page := &pagination.Page{Limit: 20}
+
+	meta := page.Meta(134, pagination.TimeCursor(createdAt, 421))
+	if !meta.HasMore || meta.Total != 134 || meta.NextCursor == "" {
+		t.Fatalf("unexpected pagination %+v", meta)
+	}
+
+	next, err := pagination.Parse(url.Values{"cursor": {meta.NextCursor}}, pagination.DefaultLimit)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if after, err := next.Cursor.Time(); err != nil || !after.Equal(createdAt) || next.Cursor.ID != 421 {
+		t.Errorf("cursor decoded to %v, %d, %v", after, next.Cursor.ID, err)
+	}
+	if _, err := next.Cursor.Int(); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a cursor of another list, got %v", err)
+	}
+
+	if last := page.Meta(134, nil); last.HasMore || last.NextCursor != "" {
+		t.Errorf("unexpected last page %+v", last)
+	}
+}
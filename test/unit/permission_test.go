@@ -0,0 +1,87 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecommerce_project/internal/auth"
+	"ecommerce_project/pkg/logger"
+)
+
+// fakePermissions grants the permissions listed for each user
+type fakePermissions struct {
+	grants map[int64][]string
+	err    error
+}
+
+func (f *fakePermissions) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, p := range f.grants[userID] {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	permissions := &fakePermissions{grants: map[int64][]string{
+		1: {"products:write", "inventory:write"},
+		2: {"inventory:write"},
+	}}
+	middleware := auth.NewMiddleware(auth.NewService(nil, "secret", 1, 30), permissions)
+
+	handler := middleware.RequirePermission("products:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name     string
+		userID   interface{}
+		expected int
+	}{
+		{"granted", int64(1), http.StatusOK},
+		{"missing permission", int64(2), http.StatusForbidden},
+		{"unauthenticated", nil, http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/api/v1/admin/products", nil)
+		if tc.userID != nil {
+			req = req.WithContext(context.WithValue(req.Context(), "user_id", tc.userID))
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.expected {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.expected)
+		}
+	}
+}
+
+func TestRequirePermissionLookupError(t *testing.T) {
+	logger.Init()
+
+	permissions := &fakePermissions{err: errors.New("database unavailable")}
+	middleware := auth.NewMiddleware(auth.NewService(nil, "secret", 1, 30), permissions)
+
+	handler := middleware.RequirePermission("products:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not run when the permission check fails")
+	}))
+
+	req := httptest.NewRequest("POST", "/api/v1/admin/products", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "user_id", int64(1)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
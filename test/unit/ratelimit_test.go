@@ -0,0 +1,120 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/app"
+	"ecommerce_project/internal/config"
+	"ecommerce_project/internal/user"
+	"ecommerce_project/pkg/cache"
+	"ecommerce_project/pkg/logger"
+)
+
+// failingBucket simulates an unreachable Redis
+type failingBucket struct{}
+
+func (failingBucket) Take(ctx context.Context, key string, capacity int, interval time.Duration) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func newLimitedHandler(buckets cache.TokenBucket, trustProxy bool) http.Handler {
+	limiter := app.NewRateLimiter(buckets, &config.RateLimitConfig{
+		Enabled:    true,
+		TrustProxy: trustProxy,
+		Policies: map[string]config.RateLimitPolicy{
+			"login": {Requests: 3, Period: 60, Key: config.RateLimitKeyIP},
+		},
+	})
+	return limiter.Limit("login")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func login(handler http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestRateLimitPerIP allows a burst per client IP and then answers 429
+// with Retry-After
+func TestRateLimitPerIP(t *testing.T) {
+	logger.Init()
+	handler := newLimitedHandler(cache.NewMemory(), false)
+
+	for i := 0; i < 3; i++ {
+		if rec := login(handler, "203.0.113.1:5000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, rec.Code)
+		}
+	}
+
+	rec := login(handler, "203.0.113.1:5001", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "20" {
+		t.Errorf("Retry-After = %q, want 20", retry)
+	}
+
+	if rec := login(handler, "198.51.100.7:5000", ""); rec.Code != http.StatusOK {
+		t.Errorf("another client was limited: %d", rec.Code)
+	}
+}
+
+// TestRateLimitTrustedProxy keys by the address the proxy appended, so
+// that clients cannot escape the limit with a forged header
+func TestRateLimitTrustedProxy(t *testing.T) {
+	logger.Init()
+	handler := newLimitedHandler(cache.NewMemory(), true)
+
+	for i := 0; i < 3; i++ {
+		forged := "10.0.0." + strconv.Itoa(i) + ", 203.0.113.9"
+		if rec := login(handler, "192.0.2.1:443", forged); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, rec.Code)
+		}
+	}
+	if rec := login(handler, "192.0.2.1:443", "10.0.0.9, 203.0.113.9"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", rec.Code)
+	}
+}
+
+// TestRateLimitFallsBackToMemory keeps limiting while the store fails
+func TestRateLimitFallsBackToMemory(t *testing.T) {
+	logger.Init()
+	handler := newLimitedHandler(failingBucket{}, false)
+
+	codes := []int{}
+	for i := 0; i < 4; i++ {
+		codes = append(codes, login(handler, "203.0.113.1:5000", "").Code)
+	}
+	if codes[2] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("unexpected status codes %v", codes)
+	}
+}
+
+// TestLockoutDuration doubles the lock for every failure beyond the
+// threshold, up to the maximum
+func TestLockoutDuration(t *testing.T) {
+	cases := map[int]time.Duration{
+		0: time.Minute,
+		1: 2 * time.Minute,
+		3: 8 * time.Minute,
+		9: time.Hour,
+	}
+	for beyond, want := range cases {
+		if got := user.LockoutDuration(beyond, time.Minute, time.Hour); got != want {
+			t.Errorf("LockoutDuration(%d) = %v, want %v", beyond, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/rbac"
+)
+
+// rbacDB is an in-memory stand-in for Postgres that holds the admin role
+// grants and records whether they were locked inside the transaction that
+// revoked one
+type rbacDB struct {
+	admins      []int64
+	inTx        bool
+	lockedInTx  bool
+	deletedInTx bool
+	committed   int
+	rolledBack  int
+}
+
+func (d *rbacDB) Connect(ctx context.Context) (driver.Conn, error) { return &rbacConn{db: d}, nil }
+func (d *rbacDB) Driver() driver.Driver                            { return nil }
+
+type rbacConn struct {
+	db *rbacDB
+}
+
+func (c *rbacConn) Prepare(query string) (driver.Stmt, error) {
+	return &rbacStmt{db: c.db, query: query}, nil
+}
+func (c *rbacConn) Close() error { return nil }
+
+func (c *rbacConn) Begin() (driver.Tx, error) {
+	c.db.inTx = true
+	return c, nil
+}
+
+func (c *rbacConn) Commit() error {
+	c.db.inTx = false
+	c.db.committed++
+	return nil
+}
+
+func (c *rbacConn) Rollback() error {
+	c.db.inTx = false
+	c.db.rolledBack++
+	return nil
+}
+
+type rbacStmt struct {
+	db    *rbacDB
+	query string
+}
+
+func (s *rbacStmt) Close() error  { return nil }
+func (s *rbacStmt) NumInput() int { return -1 }
+
+func (s *rbacStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.Contains(s.query, "DELETE FROM user_roles") {
+		return nil, fmt.Errorf("unexpected exec: %s", s.query)
+	}
+
+	// DELETE FROM user_roles WHERE user_id = $1 AND role_id = ...
+	s.db.deletedInTx = s.db.inTx
+	admins := s.db.admins[:0]
+	for _, id := range s.db.admins {
+		if id != args[0].(int64) {
+			admins = append(admins, id)
+		}
+	}
+	s.db.admins = admins
+	return driver.RowsAffected(1), nil
+}
+
+func (s *rbacStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.Contains(s.query, "SELECT id FROM roles"):
+		return &orderRows{columns: []string{"id"}, values: [][]driver.Value{{int64(1)}}}, nil
+	case strings.Contains(s.query, "FOR UPDATE"):
+		s.db.lockedInTx = s.db.inTx
+		rows := &orderRows{columns: []string{"user_id"}}
+		for _, id := range s.db.admins {
+			rows.values = append(rows.values, []driver.Value{id})
+		}
+		return rows, nil
+	case strings.Contains(s.query, "WHERE ur.user_id = $1"):
+		rows := &orderRows{columns: make([]string, 4)}
+		for _, id := range s.db.admins {
+			if id == args[0].(int64) {
+				rows.values = append(rows.values, []driver.Value{id, rbac.RoleAdmin, nil, time.Now()})
+			}
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+// newRBACService creates an RBAC service backed by db
+func newRBACService(db *rbacDB) *rbac.Service {
+	conn := sql.OpenDB(db)
+	return rbac.NewService(conn, rbac.NewRepository(conn))
+}
+
+// TestRevokeLastAdmin tests that the last admin keeps the admin role and
+// that the admin grants are locked in the transaction that checks them
+func TestRevokeLastAdmin(t *testing.T) {
+	db := &rbacDB{admins: []int64{1}}
+
+	if _, err := newRBACService(db).RevokeRole(context.Background(), 1, rbac.RoleAdmin); err == nil {
+		t.Fatal("expected revoking the last admin to fail")
+	}
+	if len(db.admins) != 1 {
+		t.Error("the last admin should keep the admin role")
+	}
+	if !db.lockedInTx {
+		t.Error("expected the admin grants to be locked inside the transaction")
+	}
+	if db.rolledBack != 1 {
+		t.Errorf("expected the transaction to be rolled back, got %d rollbacks", db.rolledBack)
+	}
+}
+
+// TestRevokeAdmin tests that an admin can be revoked while another remains,
+// with the lock and the delete in the same transaction
+func TestRevokeAdmin(t *testing.T) {
+	db := &rbacDB{admins: []int64{1, 2}}
+
+	roles, err := newRBACService(db).RevokeRole(context.Background(), 2, rbac.RoleAdmin)
+	if err != nil {
+		t.Fatalf("RevokeRole failed: %v", err)
+	}
+	if len(roles) != 0 {
+		t.Errorf("expected user 2 to have no roles, got %v", roles)
+	}
+	if len(db.admins) != 1 || db.admins[0] != 1 {
+		t.Errorf("expected user 1 to remain the only admin, got %v", db.admins)
+	}
+	if !db.lockedInTx || !db.deletedInTx {
+		t.Error("expected the lock and the delete to run inside the transaction")
+	}
+	if db.committed != 1 {
+		t.Errorf("expected one commit, got %d", db.committed)
+	}
+}
@@ -0,0 +1,47 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"ecommerce_project/internal/product"
+)
+
+// fakeSearch records the query it receives
+type fakeSearch struct {
+	query *product.SearchQuery
+}
+
+func (f *fakeSearch) Search(ctx context.Context, query *product.SearchQuery) (*product.SearchResult, error) {
+	f.query = query
+	return &product.SearchResult{Hits: []*product.SearchHit{}}, nil
+}
+
+// TestProductSearchNormalizesQuery trims the text, requires it and bounds
+// the page size before calling the search engine
+func TestProductSearchNormalizesQuery(t *testing.T) {
+	engine := &fakeSearch{}
+	service := product.NewService(nil, engine, nil, nil, 0)
+	ctx := context.Background()
+
+	if _, err := service.Search(ctx, &product.SearchQuery{Text: "   "}); err == nil {
+		t.Error("expected an error for a blank search")
+	}
+	if engine.query != nil {
+		t.Error("blank search reached the engine")
+	}
+
+	if _, err := service.Search(ctx, &product.SearchQuery{Text: " lptop ", Limit: 500, Offset: -3}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if engine.query.Text != "lptop" || engine.query.Limit != 100 || engine.query.Offset != 0 {
+		t.Errorf("unexpected query %+v", engine.query)
+	}
+
+	if _, err := service.Search(ctx, &product.SearchQuery{Text: "laptop"}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if engine.query.Limit != 20 {
+		t.Errorf("default limit = %d, want 20", engine.query.Limit)
+	}
+}
@@ -0,0 +1,101 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/notification"
+)
+
+func newRenderer(t *testing.T) *notification.Renderer {
+	renderer, err := notification.NewRenderer("https://shop.test/", "en", "USD")
+	if err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+	return renderer
+}
+
+// TestRenderOrderConfirmation renders the English template with an HTML
+// part, a text alternative and a formatted amount
+func TestRenderOrderConfirmation(t *testing.T) {
+	msg, err := newRenderer(t).Render(notification.TemplateOrderConfirmation, "en", map[string]interface{}{
+		"OrderNumber": "ORD-1",
+		"Total":       1234.5,
+		"URL":         "https://shop.test/orders/ORD-1",
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	if msg.Subject != "Order Confirmation" {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.HTML, "$ 1,234.50") || !strings.Contains(msg.Text, "$ 1,234.50") {
+		t.Errorf("amount not formatted:\n%s\n%s", msg.HTML, msg.Text)
+	}
+	if strings.Contains(msg.Text, "<") {
+		t.Errorf("text alternative contains HTML: %s", msg.Text)
+	}
+}
+
+// TestRenderLocale picks the user's language, falls back from a regional
+// locale to its base language and formats amounts for the locale
+func TestRenderLocale(t *testing.T) {
+	renderer := newRenderer(t)
+
+	msg, err := renderer.Render(notification.TemplateOrderConfirmation, "bn-BD", map[string]interface{}{
+		"OrderNumber": "ORD-1",
+		"Total":       1234.5,
+		"Currency":    "BDT",
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Locale != "bn" {
+		t.Errorf("locale = %q, want bn", msg.Locale)
+	}
+	if !strings.Contains(msg.Text, "৳ ১,২৩৪.৫০") {
+		t.Errorf("amount not formatted for bn: %s", msg.Text)
+	}
+
+	msg, err = renderer.Render(notification.TemplatePasswordReset, "fr", map[string]interface{}{
+		"URL":       "https://shop.test/reset-password?token=abc",
+		"ExpiresIn": time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Locale != "en" || !strings.Contains(msg.Text, "expire in 1 hour") {
+		t.Errorf("expected English fallback, got %s: %s", msg.Locale, msg.Text)
+	}
+}
+
+// TestRenderEscapesHTML escapes user data in the HTML part only
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := newRenderer(t).Render(notification.TemplateWelcome, "en", map[string]interface{}{
+		"Name": `<script>alert("x")</script>`,
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Errorf("HTML part not escaped: %s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<script>") {
+		t.Errorf("text part should contain the name verbatim: %s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, `href="https://shop.test/"`) {
+		t.Errorf("link does not use the base URL: %s", msg.HTML)
+	}
+}
+
+// TestRenderUnknownTemplate returns ErrTemplateNotFound
+func TestRenderUnknownTemplate(t *testing.T) {
+	_, err := newRenderer(t).Render("missing", "en", nil)
+	if !errors.Is(err, notification.ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
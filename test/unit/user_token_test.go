@@ -0,0 +1,240 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce_project/internal/auth"
+	"ecommerce_project/internal/config"
+	users "ecommerce_project/internal/user"
+	"ecommerce_project/pkg/utils"
+)
+
+// tokenRow is a row of user_tokens
+type tokenRow struct {
+	userID    int64
+	purpose   string
+	hash      string
+	expiresAt time.Time
+	usedAt    *time.Time
+}
+
+// tokenDB is an in-memory stand-in for Postgres that answers the queries
+// run while consuming email verification and password reset tokens
+type tokenDB struct {
+	tokens          []*tokenRow
+	verified        map[int64]bool
+	passwords       map[int64]string
+	sessionsRevoked int
+}
+
+func newTokenDB() *tokenDB {
+	return &tokenDB{verified: map[int64]bool{}, passwords: map[int64]string{}}
+}
+
+// addToken stores a token of user 1 that expires after ttl
+func (d *tokenDB) addToken(token, purpose string, ttl time.Duration) {
+	d.tokens = append(d.tokens, &tokenRow{
+		userID:    1,
+		purpose:   purpose,
+		hash:      utils.HashToken(token),
+		expiresAt: time.Now().Add(ttl),
+	})
+}
+
+func (d *tokenDB) Connect(ctx context.Context) (driver.Conn, error) { return &tokenConn{db: d}, nil }
+func (d *tokenDB) Driver() driver.Driver                            { return nil }
+
+type tokenConn struct {
+	db *tokenDB
+}
+
+func (c *tokenConn) Prepare(query string) (driver.Stmt, error) {
+	return &tokenStmt{db: c.db, query: query}, nil
+}
+func (c *tokenConn) Close() error              { return nil }
+func (c *tokenConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("transactions not supported") }
+
+type tokenStmt struct {
+	db    *tokenDB
+	query string
+}
+
+func (s *tokenStmt) Close() error  { return nil }
+func (s *tokenStmt) NumInput() int { return -1 }
+
+func (s *tokenStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.Contains(s.query, "SET email_verified = true"):
+		// UPDATE users SET email_verified = true, updated_at = $1 WHERE id = $2
+		s.db.verified[args[1].(int64)] = true
+	case strings.Contains(s.query, "SET password"):
+		// UPDATE users SET password = $1, ... WHERE id = $3
+		s.db.passwords[args[2].(int64)] = args[0].(string)
+	case strings.Contains(s.query, "UPDATE user_sessions"):
+		s.db.sessionsRevoked++
+	default:
+		return nil, fmt.Errorf("unexpected exec: %s", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *tokenStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.Contains(s.query, "UPDATE user_tokens") {
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+
+	// UPDATE user_tokens SET used_at = $1 WHERE token_hash = $2 AND
+	// purpose = $3 AND used_at IS NULL AND expires_at > $1 RETURNING user_id.
+	// Used and expired tokens are only skipped if the query says so.
+	skipUsed := strings.Contains(s.query, "used_at IS NULL")
+	skipExpired := strings.Contains(s.query, "expires_at > $1")
+
+	now := args[0].(time.Time)
+	rows := &orderRows{columns: []string{"user_id"}}
+	for _, token := range s.db.tokens {
+		if token.hash != args[1] || token.purpose != args[2] {
+			continue
+		}
+		if (skipUsed && token.usedAt != nil) || (skipExpired && !token.expiresAt.After(now)) {
+			continue
+		}
+		token.usedAt = &now
+		rows.values = append(rows.values, []driver.Value{token.userID})
+	}
+	return rows, nil
+}
+
+// newTokenService creates a user service backed by db
+func newTokenService(db *tokenDB) *users.Service {
+	conn := sql.OpenDB(db)
+	authService := auth.NewService(auth.NewRepository(conn), "secret", 15, 30)
+	return users.NewService(users.NewRepository(conn), authService, nil, "https://shop.example.com", &config.AuthConfig{})
+}
+
+// TestConsumeTokenSingleUse tests that a token works once and only for the
+// purpose it was issued for
+func TestConsumeTokenSingleUse(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenEmailVerification, time.Hour)
+	repo := users.NewRepository(sql.OpenDB(db))
+	ctx := context.Background()
+
+	if _, err := repo.ConsumeToken(ctx, users.TokenPasswordReset, utils.HashToken("tok")); !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for another purpose, got %v", err)
+	}
+
+	userID, err := repo.ConsumeToken(ctx, users.TokenEmailVerification, utils.HashToken("tok"))
+	if err != nil {
+		t.Fatalf("ConsumeToken failed: %v", err)
+	}
+	if userID != 1 {
+		t.Errorf("expected user 1, got %d", userID)
+	}
+
+	if _, err := repo.ConsumeToken(ctx, users.TokenEmailVerification, utils.HashToken("tok")); !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a used token, got %v", err)
+	}
+}
+
+// TestConsumeTokenExpired tests that an expired token is rejected
+func TestConsumeTokenExpired(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenPasswordReset, -time.Minute)
+	repo := users.NewRepository(sql.OpenDB(db))
+
+	if _, err := repo.ConsumeToken(context.Background(), users.TokenPasswordReset, utils.HashToken("tok")); !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+	if db.tokens[0].usedAt != nil {
+		t.Error("expired token should not be marked used")
+	}
+}
+
+// TestVerifyEmailTokenReuse tests that a verification link cannot be used
+// twice
+func TestVerifyEmailTokenReuse(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenEmailVerification, time.Hour)
+	service := newTokenService(db)
+	ctx := context.Background()
+
+	if err := service.VerifyEmail(ctx, "tok"); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if !db.verified[1] {
+		t.Error("expected the email to be verified")
+	}
+
+	if err := service.VerifyEmail(ctx, "tok"); !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken on reuse, got %v", err)
+	}
+}
+
+// TestVerifyEmailExpiredToken tests that an expired verification link does
+// not verify the email
+func TestVerifyEmailExpiredToken(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenEmailVerification, -time.Minute)
+	service := newTokenService(db)
+
+	if err := service.VerifyEmail(context.Background(), "tok"); !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+	if db.verified[1] {
+		t.Error("expired token should not verify the email")
+	}
+}
+
+// TestResetPasswordTokenReuse tests that a reset link sets the password
+// once and cannot be replayed to set it again
+func TestResetPasswordTokenReuse(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenPasswordReset, time.Hour)
+	service := newTokenService(db)
+	ctx := context.Background()
+
+	if err := service.ResetPassword(ctx, &users.ResetPasswordRequest{Token: "tok", NewPassword: "first-password"}); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	first := db.passwords[1]
+	if first == "" {
+		t.Fatal("expected the password to be set")
+	}
+	if db.sessionsRevoked != 1 {
+		t.Errorf("expected the sessions to be revoked once, got %d", db.sessionsRevoked)
+	}
+
+	err := service.ResetPassword(ctx, &users.ResetPasswordRequest{Token: "tok", NewPassword: "second-password"})
+	if !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken on reuse, got %v", err)
+	}
+	if db.passwords[1] != first {
+		t.Error("a reused token should not change the password")
+	}
+}
+
+// TestResetPasswordExpiredToken tests that an expired reset link does not
+// change the password
+func TestResetPasswordExpiredToken(t *testing.T) {
+	db := newTokenDB()
+	db.addToken("tok", users.TokenPasswordReset, -time.Minute)
+	service := newTokenService(db)
+
+	err := service.ResetPassword(context.Background(), &users.ResetPasswordRequest{Token: "tok", NewPassword: "new-password"})
+	if !errors.Is(err, users.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+	if _, ok := db.passwords[1]; ok {
+		t.Error("expired token should not change the password")
+	}
+	if db.sessionsRevoked != 0 {
+		t.Error("expired token should not revoke sessions")
+	}
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"testing"
+
+	"ecommerce_project/internal/product"
+)
+
+// TestMatchOptions requires one known value for every option of a product
+func TestMatchOptions(t *testing.T) {
+	options := []product.OptionType{
+		{Name: "Size", Values: []product.OptionValue{{ID: 1, Value: "S"}, {ID: 2, Value: "M"}}},
+		{Name: "Color", Values: []product.OptionValue{{ID: 3, Value: "Red"}, {ID: 4, Value: "Blue"}}},
+	}
+
+	selected, err := product.MatchOptions(options, map[string]string{"Color": "Blue", "Size": "M"})
+	if err != nil {
+		t.Fatalf("MatchOptions failed: %v", err)
+	}
+	if len(selected) != 2 || selected[0].OptionValueID != 2 || selected[1].OptionValueID != 4 {
+		t.Errorf("unexpected selection %+v", selected)
+	}
+
+	invalid := []map[string]string{
+		{"Size": "M"},
+		{"Size": "XL", "Color": "Red"},
+		{"Size": "M", "Color": "Red", "Fit": "Slim"},
+	}
+	for _, chosen := range invalid {
+		if _, err := product.MatchOptions(options, chosen); err == nil {
+			t.Errorf("expected an error for %v", chosen)
+		}
+	}
+}
+
+// TestOptionKey ignores the order of option values
+func TestOptionKey(t *testing.T) {
+	if product.OptionKey([]int64{4, 2}) != product.OptionKey([]int64{2, 4}) {
+		t.Error("option keys differ by order")
+	}
+	if product.OptionKey(nil) != "" {
+		t.Error("the default variant should have an empty key")
+	}
+}